@@ -2,24 +2,38 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"expvar"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
+	"go-starter/docs"
+	"go-starter/internal/audit"
 	"go-starter/internal/config"
+	"go-starter/internal/emailcheck"
+	"go-starter/internal/features"
 	"go-starter/internal/handlers"
+	"go-starter/internal/i18n"
 	"go-starter/internal/logger"
 	"go-starter/internal/middleware"
+	"go-starter/internal/migrations"
 	"go-starter/internal/repositories"
 	"go-starter/internal/services"
+	"go-starter/internal/stats"
+	"go-starter/internal/tlsx"
 	"go-starter/pkg/database"
 
-	_ "go-starter/docs"
-
 	"github.com/gorilla/mux"
+	"github.com/pires/go-proxyproto"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"go.uber.org/zap"
 )
@@ -29,6 +43,11 @@ import (
 // @description RESTful API with JWT authentication, rate limiting, and PostgreSQL
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT access token, sent as "Bearer <token>"
+// @securityDefinitions.basic BasicAuth
 func main() {
 	// Load configuration
 	cfg, err := config.Load()
@@ -38,7 +57,13 @@ func main() {
 	}
 
 	// Initialize logger
-	if err := logger.Init(cfg.Logger.Level, cfg.IsProduction()); err != nil {
+	if err := logger.Init(logger.Config{
+		Level:              cfg.Logger.Level,
+		Format:             cfg.Logger.Format,
+		IsProduction:       cfg.IsProduction(),
+		SamplingInitial:    cfg.Logger.SamplingInitial,
+		SamplingThereafter: cfg.Logger.SamplingThereafter,
+	}); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
@@ -48,84 +73,646 @@ func main() {
 		zap.String("env", cfg.Env),
 		zap.String("port", cfg.Server.Port),
 	)
+	logger.Info("effective configuration", zap.Any("config", cfg.Redacted()))
+
+	// Reloaded on SIGHUP; subscribers are registered once their components exist
+	watcher := config.NewWatcher(cfg)
+
+	// Missing translations fall back to the configured default locale
+	i18n.SetDefaultLocale(cfg.Locale.Default)
 
 	// Initialize database
 	db, err := database.New(database.Config{
-		DSN:             cfg.GetDSN(),
-		MaxOpenConns:    25,
-		MaxIdleConns:    25,
-		ConnMaxLifetime: 5 * time.Minute,
-		ConnMaxIdleTime: 5 * time.Minute,
+		DSN:                cfg.GetDSN(),
+		ReplicaDSNs:        cfg.Database.ReplicaDSNs,
+		MaxConns:           cfg.Database.Pool.MaxOpenConns,
+		MinConns:           cfg.Database.Pool.MinConns,
+		MaxConnLifetime:    cfg.Database.Pool.ConnMaxLifetime,
+		MaxConnIdleTime:    cfg.Database.Pool.ConnMaxIdleTime,
+		HealthCheckPeriod:  cfg.Database.Pool.HealthCheckPeriod,
+		StatsInterval:      cfg.Database.Pool.StatsInterval,
+		PingRetries:        5,
+		PingBaseDelay:      500 * time.Millisecond,
+		SlowQueryThreshold: cfg.Database.SlowQueryThreshold,
+		StatementTimeout:   cfg.Database.StatementTimeout,
+		ContextLogger:      logger.FromContext,
 	}, logger.Get())
 	if err != nil {
 		logger.Fatal("failed to connect to database", zap.Error(err))
 	}
 	defer db.Close()
+	expvar.Publish("db_pool", expvar.Func(func() interface{} {
+		return db.Stats()
+	}))
+	expvar.Publish("db_retries", expvar.Func(func() interface{} {
+		return database.RetryStats()
+	}))
+
+	if cfg.Database.AutoMigrate {
+		err := migrations.Up(context.Background(), db.DB, func(version uint, name string) {
+			logger.Info("applied migration", zap.Uint("version", version), zap.String("name", name))
+		})
+		if err != nil {
+			logger.Fatal("failed to migrate database", zap.Error(err))
+		}
+	}
+	expectedSchemaVersion, err := migrations.Latest()
+	if err != nil {
+		logger.Fatal("failed to read embedded migrations", zap.Error(err))
+	}
+	checkSchemaVersion(db.DB, expectedSchemaVersion, cfg.Database.SchemaCheck == "fail")
 
 	// Initialize repositories
-	userRepo := repositories.NewUserRepository(db.DB)
+	userRepo := repositories.NewUserRepository(db, cfg.Database.StatementTimeout)
+
+	// Audit trail of authentication events
+	auditSink, err := newAuditSink(cfg.Audit, db)
+	if err != nil {
+		logger.Fatal("failed to initialize audit sink", zap.Error(err))
+	}
+	auditor := audit.NewRecorder(auditSink, middleware.GetClientIPFromContext)
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, cfg.JWT.Secret)
+	authService := services.NewAuthService(userRepo, cfg.JWT.Secret, cfg.JWT.PreviousSecrets, cfg.JWT.AccessTTL, cfg.JWT.RefreshTTL, auditor)
+	// Registrations and their audit events, and deletions and their token
+	// revocations, commit together
+	authService.SetTransactor(db)
+	// Share user changes between instances, so tokens of a user deleted on one
+	// instance are rejected by the others without waiting for their cached
+	// revocation to expire. The listener stops when db is closed.
+	authService.SetNotifier(db)
+	go db.Listen(context.Background(), services.UserChangedChannel, func(payload string) {
+		if err := authService.UserChanged(context.Background(), payload); err != nil {
+			logger.Warn("failed to handle user change", zap.String("payload", payload), zap.Error(err))
+		}
+	})
+	// Admins can't delete their own accounts through the admin API
+	authService.SetAdminUserIDs(cfg.BasicAuth.UserIDs)
+	if cfg.EmailValidation.MX {
+		authService.SetEmailChecker(emailcheck.New(cfg.EmailValidation.MXTimeout, cfg.EmailValidation.MXCacheTTL))
+	}
+
+	// Feature flags gate dark-launched routes and are reloaded with the configuration
+	featureFlags, err := features.New(cfg.Features, middleware.GetUserIDFromContext)
+	if err != nil {
+		logger.Fatal("invalid feature flags", zap.Error(err))
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(authService)
-	healthHandler := handlers.NewHealthHandler(db)
+	authHandler := handlers.NewAuthHandler(authService, cfg.Server.ResponseEnvelope)
+	userHandler := handlers.NewUserHandler(authService, cfg.Server.ResponseEnvelope)
+	// Readiness fails and in-flight requests are counted while shutting down
+	drainer := middleware.NewDrainer()
+	healthHandler := handlers.NewHealthHandler(db, cfg.Database.HealthWarnLatency, cfg.Database.HealthMaxLatency, drainer.Draining, handlers.ReadinessConfig{
+		MinSchemaVersion: expectedSchemaVersion,
+		AcquireTimeout:   cfg.Database.ReadyAcquireTimeout,
+		QueryCheck:       cfg.Database.ReadyQueryCheck,
+	})
+
+	// Per-client request statistics for operators
+	var clientStats *stats.ClientCollector
+	var requestRecorder middleware.RequestRecorder
+	if cfg.Stats.Enabled {
+		clientStats = stats.NewClientCollector(cfg.Stats.MaxClients, cfg.Stats.HalfLife)
+		requestRecorder = clientStats
+	}
 
 	// Create router
 	router := mux.NewRouter()
 
 	// Apply global middleware
-	router.Use(middleware.LoggerMiddleware())
-	router.Use(middleware.SecurityHeadersMiddleware(cfg.IsProduction()))
-	router.Use(middleware.RateLimitMiddleware(cfg.RateLimit.RPS, cfg.RateLimit.Burst))
+	// Client IP headers and X-Forwarded-Proto are only honored from trusted proxies
+	trustedProxies, err := cfg.Server.TrustedProxyNets()
+	if err != nil {
+		logger.Fatal("invalid trusted proxies", zap.Error(err))
+	}
+	clientIP := middleware.ClientIPMiddleware(cfg.Server.RealIPHeaders, trustedProxies)
+	requestLogger := middleware.LoggerMiddleware(cfg.Logger.SlowRequestThreshold, requestRecorder)
+	locale := middleware.LocaleMiddleware(cfg.Locale.Supported, cfg.Locale.Default)
+	securityHeaders := middleware.SecurityHeadersMiddleware(middleware.SecurityHeadersConfig{
+		ContentSecurityPolicy: cfg.Security.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Security.ReferrerPolicy,
+		FrameOptions:          cfg.Security.FrameOptions,
+		HSTSMaxAge:            cfg.Security.HSTSMaxAge,
+		EnableHSTS:            cfg.IsProduction(),
+		TrustedProxies:        trustedProxies,
+	})
+	// Every router and fallback handler runs the same stack, in this order:
+	// draining first so shutdown stops new work, then the client IP and request
+	// logger so everything after it (including rejections) is logged with a
+	// request ID, then locale and security headers for the response
+	baseChain := middleware.NewChain(drainer.Middleware(), clientIP, requestLogger, locale, securityHeaders)
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit.RPS, cfg.RateLimit.Burst, cfg.RateLimit.BypassTokens)
+	rateLimitRules, err := compileRateLimitRules(cfg.RateLimit)
+	if err != nil {
+		logger.Fatal("invalid rate limit rules", zap.Error(err))
+	}
+	rateLimiter.SetRules(rateLimitRules)
+	rateLimiter.SetMaxRetryAfter(cfg.RateLimit.MaxRetryAfter)
+	rateLimiter.SetUserKeyFunc(middleware.BearerUserKey(authService))
+	// Rate limiting runs after the request logger, so limited requests are logged
+	routerChain := baseChain
+	if cfg.RateLimit.Enabled {
+		routerChain = baseChain.Append(rateLimiter.Middleware())
+	} else {
+		logger.Warn("rate limiting is disabled")
+	}
+	routerChain.Apply(router)
+	expvar.Publish("http_rate_limit_bypassed_total", expvar.Func(func() interface{} {
+		return rateLimiter.Bypassed()
+	}))
 
-	// Health check routes (no auth required)
+	// Health check routes (no auth required, bypass the concurrency limiter)
 	router.HandleFunc("/healthz", healthHandler.Healthz).Methods("GET")
 	router.HandleFunc("/ready", healthHandler.Ready).Methods("GET")
 
+	// API routes share the in-flight request limiter
+	apiRouter := router.NewRoute().Subrouter()
+	if cfg.Concurrency.MaxInFlight > 0 {
+		concurrencyLimiter := middleware.NewConcurrencyLimiter(cfg.Concurrency.MaxInFlight, cfg.Concurrency.QueueTimeout)
+		apiRouter.Use(concurrencyLimiter.Middleware())
+
+		expvar.Publish("http_in_flight_requests", expvar.Func(func() interface{} {
+			return concurrencyLimiter.InFlight()
+		}))
+		expvar.Publish("http_rejected_requests_total", expvar.Func(func() interface{} {
+			return concurrencyLimiter.Rejected()
+		}))
+	}
+
+	// Block unwanted user agents on API routes
+	userAgentRules, err := loadUserAgentRules(cfg.UserAgent)
+	if err != nil {
+		logger.Fatal("failed to load user agent rules", zap.Error(err))
+	}
+	userAgentFilter, err := middleware.NewUserAgentFilter(userAgentRules)
+	if err != nil {
+		logger.Fatal("failed to create user agent filter", zap.Error(err))
+	}
+	apiRouter.Use(userAgentFilter.Middleware())
+	expvar.Publish("blocked_requests_total", userAgentFilter.BlockedCounts())
+
 	// Auth routes (no auth required)
-	authRouter := router.PathPrefix("/auth").Subrouter()
-	authRouter.HandleFunc("/register", authHandler.Register).Methods("POST")
-	authRouter.HandleFunc("/login", authHandler.Login).Methods("POST")
+	authRouter := apiRouter.PathPrefix("/auth").Subrouter()
+	registerHandler := http.Handler(http.HandlerFunc(authHandler.Register))
+	if cfg.Idempotency.Enabled {
+		idempotency := middleware.NewIdempotency(cfg.Idempotency.TTL, cfg.Idempotency.MaxKeys)
+		idempotency.SetCallerKeyFunc(middleware.BearerUserKey(authService))
+		registerHandler = idempotency.Middleware()(registerHandler)
+	}
+	authRouter.Handle("/register", registerHandler).Methods("POST")
+	loginHandler := http.Handler(http.HandlerFunc(authHandler.Login))
+	if cfg.LoginThrottle.Enabled {
+		loginThrottle := middleware.NewLoginThrottle(cfg.LoginThrottle.MaxFailures, cfg.LoginThrottle.Block, cfg.LoginThrottle.MaxBlock)
+		loginHandler = loginThrottle.Middleware()(loginHandler)
+	}
+	authRouter.Handle("/login", loginHandler).Methods("POST")
 
-	// Swagger documentation (only in development)
+	// Authenticated user routes
+	meRouter := apiRouter.PathPrefix("/me").Subrouter()
+	meRouter.Use(middleware.AuthMiddleware(authService))
+	meRouter.HandleFunc("", userHandler.GetMe).Methods("GET")
+	meRouter.HandleFunc("", userHandler.UpdateMe).Methods("PATCH")
+	meRouter.HandleFunc("", userHandler.DeleteMe).Methods("DELETE")
+
+	// Ops and admin routes share the public router unless ADMIN_PORT gives
+	// them a listener of their own
+	adminRouter := router
+	if cfg.Server.AdminPort != "" {
+		adminRouter = mux.NewRouter()
+		baseChain.Apply(adminRouter)
+		adminRouter.NotFoundHandler = baseChain.Then(http.HandlerFunc(handlers.NotFound))
+		adminRouter.MethodNotAllowedHandler = baseChain.Then(http.HandlerFunc(handlers.MethodNotAllowed))
+	}
+
+	// Ops routes (only when basic auth credentials are configured)
+	if len(cfg.BasicAuth.Users) > 0 {
+		debugRouter := adminRouter.PathPrefix("/debug").Subrouter()
+		debugRouter.Use(middleware.BasicAuthMiddleware(cfg.BasicAuth.Users))
+		debugRouter.Handle("/vars", expvar.Handler()).Methods("GET")
+		debugRouter.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+		debugRouter.HandleFunc("/pprof/profile", pprof.Profile)
+		debugRouter.HandleFunc("/pprof/symbol", pprof.Symbol)
+		debugRouter.HandleFunc("/pprof/trace", pprof.Trace)
+		// Index also serves the named profiles such as heap and goroutine
+		debugRouter.PathPrefix("/pprof/").HandlerFunc(pprof.Index)
+
+		// Only the search is behind the user_search flag
+		searchRouter := adminRouter.Path("/users").Subrouter()
+		searchRouter.Use(featureFlags.Require("user_search"))
+		searchRouter.Use(middleware.BasicAuthMiddleware(cfg.BasicAuth.Users))
+		searchRouter.HandleFunc("", userHandler.SearchUsers).Methods("GET")
+
+		usersRouter := adminRouter.PathPrefix("/users/{id}").Subrouter()
+		usersRouter.Use(middleware.BasicAuthMiddleware(cfg.BasicAuth.Users))
+		usersRouter.HandleFunc("", userHandler.GetUser).Methods("GET")
+		usersRouter.HandleFunc("", userHandler.DeleteUser).Methods("DELETE")
+		usersRouter.HandleFunc("/restore", userHandler.RestoreUser).Methods("POST")
+
+		operatorRouter := adminRouter.PathPrefix("/admin").Subrouter()
+		operatorRouter.Use(middleware.BasicAuthMiddleware(cfg.BasicAuth.Users))
+		configHandler := handlers.NewConfigHandler(watcher.Current)
+		operatorRouter.HandleFunc("/config", configHandler.Effective).Methods("GET")
+		logLevelHandler := handlers.NewLogLevelHandler(logger.AtomicLevel(), func() string { return watcher.Current().Logger.Level })
+		operatorRouter.HandleFunc("/log-level", logLevelHandler.Get).Methods("GET")
+		operatorRouter.HandleFunc("/log-level/toggle", logLevelHandler.Toggle).Methods("POST")
+
+		if clientStats != nil {
+			statsHandler := handlers.NewStatsHandler(clientStats)
+			operatorRouter.HandleFunc("/stats/clients", statsHandler.TopClients).Methods("GET")
+		}
+	}
+
+	// OpenAPI spec (all environments, for client code generation)
+	docs.SwaggerInfo.Host = cfg.Swagger.Host
+	docs.SwaggerInfo.BasePath = cfg.Swagger.BasePath
+	docsHandler := handlers.NewDocsHandler(docs.SwaggerInfo)
+	router.HandleFunc("/openapi.json", docsHandler.Spec).Methods("GET")
+	adminRouter.HandleFunc("/swagger/doc.json", docsHandler.Spec).Methods("GET")
+
+	// Swagger UI (only in development)
 	if !cfg.IsProduction() {
-		router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+		swaggerRouter := adminRouter.PathPrefix("/swagger/").Subrouter()
+		if len(cfg.BasicAuth.Users) > 0 {
+			swaggerRouter.Use(middleware.BasicAuthMiddleware(cfg.BasicAuth.Users))
+		}
+		swaggerRouter.NewRoute().Handler(httpSwagger.WrapHandler)
 		logger.Info("swagger documentation enabled at /swagger/index.html")
 	}
 
+	// Unmatched requests skip router middleware, so wrap the fallback handlers
+	// to log them and include the request ID in their error bodies
+	router.NotFoundHandler = baseChain.Then(http.HandlerFunc(handlers.NotFound))
+	router.MethodNotAllowedHandler = baseChain.Then(http.HandlerFunc(handlers.MethodNotAllowed))
+
+	// CORS wraps the router so preflight requests are answered before route matching
+	var handler http.Handler = router
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		handler = middleware.CORSMiddleware(cfg.CORS.AllowedOrigins)(router)
+	}
+
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:         ":" + cfg.Server.Port,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         cfg.Server.Addr(),
+		Handler:      handler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	// Fail fast on a broken database or JWT setup rather than on the first request.
+	// The schema was checked above according to DB_SCHEMA_CHECK.
+	checks := slices.DeleteFunc(healthHandler.Checks(), func(c handlers.Check) bool { return c.Name == "schema" })
+	checks = append(checks, handlers.Check{Name: "jwt", Run: authService.CheckSigning})
+	if err := preflight(context.Background(), checks); err != nil {
+		logger.Fatal("preflight checks failed", zap.Error(err))
+	}
+
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logger.Fatal("failed to listen", zap.Error(err))
+	}
+
+	// Recover the real client address from a PROXY protocol load balancer
+	if cfg.Server.ProxyProtocol {
+		listener = &proxyproto.Listener{Listener: listener}
+		logger.Info("PROXY protocol enabled")
+	}
+
+	// Serve HTTPS when a certificate is configured
+	var certs *tlsx.CertReloader
+	if cfg.Server.TLSEnabled() {
+		certs, err = tlsx.NewCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		if err != nil {
+			logger.Fatal("failed to load TLS certificate", zap.Error(err))
+		}
+		srv.TLSConfig, err = tlsx.ServerConfig(certs, cfg.Server.TLSClientCAFile)
+		if err != nil {
+			logger.Fatal("invalid TLS configuration", zap.Error(err))
+		}
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Info("server starting", zap.String("address", srv.Addr))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("server starting", zap.String("address", listener.Addr().String()), zap.Bool("tls", certs != nil))
+		var err error
+		if certs != nil {
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("failed to start server", zap.Error(err))
 		}
 	}()
 
+	// Optionally serve ops and admin routes on a separate port
+	var adminSrv *http.Server
+	if cfg.Server.AdminPort != "" {
+		adminSrv = &http.Server{
+			Addr:         cfg.Server.AdminAddr(),
+			Handler:      adminRouter,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		adminListener, err := net.Listen("tcp", adminSrv.Addr)
+		if err != nil {
+			logger.Fatal("failed to listen on admin port", zap.Error(err))
+		}
+		go func() {
+			logger.Info("admin server starting", zap.String("address", adminListener.Addr().String()))
+			if err := adminSrv.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("failed to start admin server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Optionally redirect plain HTTP to HTTPS
+	var redirectSrv *http.Server
+	if certs != nil && cfg.Server.HTTPRedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:         cfg.Server.RedirectAddr(),
+			Handler:      redirectToHTTPS(cfg.Server.Port),
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		go func() {
+			logger.Info("HTTP redirect server starting", zap.String("address", redirectSrv.Addr))
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("failed to start HTTP redirect server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Reload configuration on SIGHUP and apply the settings that can change at runtime
+	watcher.Subscribe(func(old, updated *config.Config) {
+		if old.Logger.Level != updated.Logger.Level {
+			if err := logger.SetLevel(updated.Logger.Level); err != nil {
+				logger.Error("failed to change log level", zap.Error(err))
+				return
+			}
+			logger.Info("log level changed", zap.String("level", updated.Logger.Level))
+		}
+	})
+	watcher.Subscribe(func(old, updated *config.Config) {
+		if old.RateLimit.RPS != updated.RateLimit.RPS || old.RateLimit.Burst != updated.RateLimit.Burst {
+			rateLimiter.SetLimits(updated.RateLimit.RPS, updated.RateLimit.Burst)
+			logger.Info("rate limits changed",
+				zap.Int("rps", updated.RateLimit.RPS),
+				zap.Int("burst", updated.RateLimit.Burst),
+			)
+		}
+		if old.RateLimit.MaxRetryAfter != updated.RateLimit.MaxRetryAfter {
+			rateLimiter.SetMaxRetryAfter(updated.RateLimit.MaxRetryAfter)
+			logger.Info("rate limit max retry-after changed", zap.Duration("max_retry_after", updated.RateLimit.MaxRetryAfter))
+		}
+		if !slices.Equal(old.RateLimit.Rules, updated.RateLimit.Rules) {
+			rules, err := compileRateLimitRules(updated.RateLimit)
+			if err != nil {
+				logger.Error("failed to reload rate limit rules", zap.Error(err))
+				return
+			}
+			rateLimiter.SetRules(rules)
+			logger.Info("rate limit rules reloaded", zap.Int("rules", len(rules.Rules())))
+		}
+	})
+	watcher.Subscribe(func(old, updated *config.Config) {
+		if maps.Equal(old.Features, updated.Features) {
+			return
+		}
+		if err := featureFlags.Set(updated.Features); err != nil {
+			logger.Error("failed to reload feature flags", zap.Error(err))
+			return
+		}
+		logger.Info("feature flags reloaded", zap.Any("features", updated.Features))
+	})
+	watcher.Subscribe(func(_, updated *config.Config) {
+		// Always reload so edits to the rules file are picked up
+		rules, err := loadUserAgentRules(updated.UserAgent)
+		if err == nil {
+			err = userAgentFilter.SetRules(rules)
+		}
+		if err != nil {
+			logger.Error("failed to reload user agent rules", zap.Error(err))
+			return
+		}
+		logger.Info("user agent rules reloaded")
+	})
+	if certs != nil {
+		watcher.Subscribe(func(_, _ *config.Config) {
+			// Always reload so renewed certificates are picked up
+			if err := certs.Reload(); err != nil {
+				logger.Error("failed to reload TLS certificate", zap.Error(err))
+				return
+			}
+			logger.Info("TLS certificate reloaded")
+		})
+	}
+	go watcher.Run(context.Background(), cfg.ReloadInterval)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Info("shutting down server...")
+	// Fail readiness so the load balancer stops sending new traffic
+	drainer.StartDraining()
+	logger.Info("shutting down server...", zap.Int64("in_flight", drainer.InFlight()))
 
 	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
+	go logDraining(ctx, drainer)
+
+	// Keep the listeners open until load balancers have probed readiness and
+	// stopped routing here; a second signal skips the wait
+	if cfg.Server.ShutdownDelay > 0 {
+		logger.Info("waiting for load balancers to stop routing traffic", zap.Duration("delay", cfg.Server.ShutdownDelay))
+		select {
+		case <-time.After(cfg.Server.ShutdownDelay):
+		case <-quit:
+		}
+	}
+
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			logger.Error("HTTP redirect server forced to shutdown", zap.Error(err))
+		}
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			logger.Error("admin server forced to shutdown", zap.Error(err))
+		}
+	}
 
 	if err := srv.Shutdown(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Warn("shutdown timeout elapsed before requests drained",
+				zap.Duration("timeout", cfg.Server.ShutdownTimeout),
+				zap.Int64("undrained_requests", drainer.InFlight()),
+			)
+		}
 		logger.Fatal("server forced to shutdown", zap.Error(err))
 	}
 
 	logger.Info("server stopped gracefully")
 }
+
+// logDraining logs the number of in-flight requests every second until they
+// have drained or ctx is done
+func logDraining(ctx context.Context, drainer *middleware.Drainer) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			inFlight := drainer.InFlight()
+			if inFlight == 0 {
+				return
+			}
+			logger.Info("draining in-flight requests", zap.Int64("in_flight", inFlight))
+		}
+	}
+}
+
+// redirectToHTTPS returns a handler that permanently redirects requests to
+// the same URL over HTTPS on httpsPort
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// compileRateLimitRules compiles the configured rate limit rules and logs the
+// effective rule table at debug level
+func compileRateLimitRules(cfg config.RateLimitConfig) (*middleware.RateLimitRules, error) {
+	rules := make([]middleware.RateLimitRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rules = append(rules, middleware.RateLimitRule{
+			PathPrefix: rule.PathPrefix,
+			Method:     rule.Method,
+			RPS:        rule.RPS,
+			Burst:      rule.Burst,
+			Key:        middleware.RateLimitKey(rule.Key),
+		})
+	}
+
+	compiled, err := middleware.CompileRateLimitRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range compiled.Rules() {
+		logger.Debug("rate limit rule",
+			zap.String("method", rule.Method),
+			zap.String("path_prefix", rule.PathPrefix),
+			zap.Int("rps", rule.RPS),
+			zap.Int("burst", rule.Burst),
+			zap.String("key", string(rule.Key)),
+		)
+	}
+	logger.Debug("rate limit default",
+		zap.Int("rps", cfg.RPS),
+		zap.Int("burst", cfg.Burst),
+		zap.String("key", string(middleware.RateLimitKeyIP)),
+	)
+
+	return compiled, nil
+}
+
+// loadUserAgentRules combines user agent rules from config and the optional rules file
+func loadUserAgentRules(cfg config.UserAgentConfig) (middleware.UserAgentRules, error) {
+	rules := middleware.UserAgentRules{
+		Deny:                cfg.DenyPatterns,
+		Allow:               cfg.AllowPatterns,
+		RejectEmptyPrefixes: cfg.RejectEmptyPaths,
+	}
+
+	if cfg.RulesFile == "" {
+		return rules, nil
+	}
+
+	fileRules, err := middleware.LoadUserAgentRulesFile(cfg.RulesFile)
+	if err != nil {
+		return rules, err
+	}
+	rules.Deny = append(slices.Clone(rules.Deny), fileRules.Deny...)
+	rules.Allow = append(slices.Clone(rules.Allow), fileRules.Allow...)
+
+	return rules, nil
+}
+
+// newAuditSink returns the audit sink selected by cfg, or nil when auditing is disabled
+func newAuditSink(cfg config.AuditConfig, db *database.DB) (audit.Sink, error) {
+	switch cfg.Sink {
+	case audit.SinkDB:
+		return audit.NewDBSink(db), nil
+	case audit.SinkNone:
+		return nil, nil
+	default:
+		return audit.NewLogSink(cfg.LogPath)
+	}
+}
+
+// preflightTimeout bounds each startup self-check
+const preflightTimeout = 5 * time.Second
+
+// preflight runs each check once, logging its result, and returns the
+// failures joined into one error naming each failed check
+func preflight(ctx context.Context, checks []handlers.Check) error {
+	var errs []error
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		start := time.Now()
+		err := check.Run(checkCtx)
+		cancel()
+
+		if err != nil {
+			logger.Error("preflight check failed", zap.String("check", check.Name), zap.Duration("latency", time.Since(start)), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, err))
+			continue
+		}
+		logger.Info("preflight check passed", zap.String("check", check.Name), zap.Duration("latency", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
+
+// checkSchemaVersion compares the database schema version with expected, the
+// latest migration embedded in the binary, exiting on a mismatch or dirty
+// schema when strict and warning otherwise
+func checkSchemaVersion(db *sql.DB, expected uint, strict bool) {
+	report := logger.Warn
+	if strict {
+		report = logger.Fatal
+	}
+
+	version, dirty, err := migrations.Version(context.Background(), db)
+	if err != nil {
+		report("failed to read schema version", zap.Error(err))
+		return
+	}
+
+	fields := []zap.Field{zap.Uint("schema_version", version), zap.Uint("expected_version", expected)}
+	switch {
+	case dirty:
+		report("database schema is dirty, a migration failed part way; repair it with migrate force", fields...)
+	case version < expected:
+		report("database schema is behind the binary; run migrations or set DB_AUTO_MIGRATE=true", fields...)
+	case version > expected:
+		report("database schema is ahead of the binary; it was migrated by a newer release", fields...)
+	default:
+		logger.Info("database schema version", fields...)
+	}
+}
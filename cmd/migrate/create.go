@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMigrationsDir is where create writes migrations when -path is not set
+const defaultMigrationsDir = "internal/migrations"
+
+// versionLayout formats the timestamp used as a new migration's version
+const versionLayout = "20060102150405"
+
+var (
+	// separatorRe matches runs of characters replaced by an underscore in names
+	separatorRe = regexp.MustCompile(`[\s\-.]+`)
+	// migrationNameRe matches valid normalized migration names
+	migrationNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	// versionPrefixRe extracts the version from a migration file name
+	versionPrefixRe = regexp.MustCompile(`^(\d+)_`)
+)
+
+// migrationTemplate is written at the top of new migration files
+const migrationTemplate = `-- Migration: %s (%s)
+-- Created: %s
+--
+-- %s
+`
+
+// create scaffolds an up/down migration pair in dir and records the files in r
+func create(dir string, args []string, r *result) int {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	upSQL := fs.String("sql", "", "SQL to pre-populate the up migration with")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		return usageError("create requires a migration name")
+	}
+	// Flags may also follow the name
+	arg := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		return usageError("create takes a single migration name")
+	}
+
+	name, err := normalizeMigrationName(arg)
+	if err != nil {
+		return usageError(err.Error())
+	}
+
+	files, err := createMigration(dir, name, *upSQL, time.Now().UTC())
+	if err != nil {
+		return fail(r, err)
+	}
+	r.Status = statusCreated
+	r.Files = files
+	return exitOK
+}
+
+// normalizeMigrationName lowercases name and replaces spaces, hyphens and dots
+// with underscores. It is an error if the result is not a snake_case name
+// starting with a letter.
+func normalizeMigrationName(name string) (string, error) {
+	normalized := strings.Trim(separatorRe.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "_"), "_")
+	if !migrationNameRe.MatchString(normalized) {
+		return "", fmt.Errorf("invalid migration name %q: use letters, digits and underscores, starting with a letter", name)
+	}
+	return normalized, nil
+}
+
+// createMigration writes the up and down files of a migration versioned by
+// now into dir and returns their paths. It refuses to reuse a version that
+// already exists in dir and never overwrites files.
+func createMigration(dir, name, upSQL string, now time.Time) ([]string, error) {
+	version := now.Format(versionLayout)
+
+	taken, err := hasVersion(dir, version)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("a migration with version %s already exists in %s", version, dir)
+	}
+
+	created := now.Format(time.RFC3339)
+	up := fmt.Sprintf(migrationTemplate, name, "up", created, "Apply the change here; the .down.sql file must undo it.")
+	if upSQL != "" {
+		up += "\n" + strings.TrimRight(upSQL, "\n") + "\n"
+	}
+	down := fmt.Sprintf(migrationTemplate, name, "down", created, "Undo the change made by the .up.sql file.")
+
+	var paths []string
+	for _, file := range []struct{ direction, body string }{{"up", up}, {"down", down}} {
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s.%s.sql", version, name, file.direction))
+		if err := writeNewFile(path, file.body); err != nil {
+			// Don't leave half a migration behind
+			for _, p := range paths {
+				os.Remove(p)
+			}
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// hasVersion reports whether dir holds a migration numbered version
+func hasVersion(dir, version string) (bool, error) {
+	want, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+	for _, entry := range entries {
+		m := versionPrefixRe.FindStringSubmatch(entry.Name())
+		if m == nil || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		if v, err := strconv.ParseUint(m[1], 10, 64); err == nil && v == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeNewFile writes body to path, failing if the file already exists
+func writeNewFile(path, body string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeMigrationName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"add_users_index", "add_users_index"},
+		{"Add Users Index", "add_users_index"},
+		{"  add-users.index  ", "add_users_index"},
+		{"add \t users--index", "add_users_index"},
+		{"_add_users_", "add_users"},
+		{"v2_schema", "v2_schema"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMigrationName(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeMigrationName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, name := range []string{"", "   ", "---", "2fa_secrets", "add/users", "drop;table", "naïve", "add users!"} {
+		if got, err := normalizeMigrationName(name); err == nil {
+			t.Errorf("normalizeMigrationName(%q) = %q, want error", name, got)
+		}
+	}
+}
+
+// testNow is the creation time used for new migrations in tests
+var testNow = time.Date(2026, 10, 15, 12, 30, 45, 0, time.UTC)
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	files, err := createMigration(dir, "add_users_index", "CREATE INDEX idx ON users(email);\n\n", testNow)
+	if err != nil {
+		t.Fatalf("createMigration: %v", err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "20261015123045_add_users_index.up.sql"),
+		filepath.Join(dir, "20261015123045_add_users_index.down.sql"),
+	}
+	if !slices.Equal(files, want) {
+		t.Fatalf("files = %q, want %q", files, want)
+	}
+
+	up, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(up), "-- Migration: add_users_index (up)\n-- Created: 2026-10-15T12:30:45Z\n") {
+		t.Errorf("up file has no header:\n%s", up)
+	}
+	if !strings.HasSuffix(string(up), "\nCREATE INDEX idx ON users(email);\n") {
+		t.Errorf("up file does not end with the SQL:\n%s", up)
+	}
+
+	down, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(down), "-- Migration: add_users_index (down)\n") || strings.Contains(string(down), "CREATE INDEX") {
+		t.Errorf("unexpected down file:\n%s", down)
+	}
+}
+
+func TestCreateMigrationRefusesVersionCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+	}{
+		{"same version", "20261015123045_other.up.sql"},
+		{"zero padded", "0020261015123045_other.down.sql"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, tt.existing), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := createMigration(dir, "add_users_index", "", testNow); err == nil || !strings.Contains(err.Error(), "already exists") {
+				t.Errorf("createMigration error = %v, want a collision", err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("%d files in the directory, want only the existing one", len(entries))
+			}
+		})
+	}
+}
+
+func TestCreateMigrationIgnoresOtherVersions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"000001_create_users.up.sql", "20261015123044_earlier.up.sql", "20261015123045_notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := createMigration(dir, "add_users_index", "", testNow); err != nil {
+		t.Errorf("createMigration: %v", err)
+	}
+}
+
+func TestCreateMigrationLeavesNoHalfPair(t *testing.T) {
+	dir := t.TempDir()
+	// A directory in the way of the down file makes it fail to be created
+	if err := os.Mkdir(filepath.Join(dir, "20261015123045_add_users_index.down.sql"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createMigration(dir, "add_users_index", "", testNow); err == nil {
+		t.Fatal("createMigration succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20261015123045_add_users_index.up.sql")); !os.IsNotExist(err) {
+		t.Errorf("up file left behind: %v", err)
+	}
+}
+
+func TestCreateCommand(t *testing.T) {
+	dir := t.TempDir()
+	r := &result{Command: "create"}
+	// Flags may come before or after the name
+	if code := create(dir, []string{"Add Audit Index", "-sql", "SELECT 1;"}, r); code != exitOK {
+		t.Fatalf("create = %d, want %d (%s)", code, exitOK, r.Error)
+	}
+	if r.Status != statusCreated || len(r.Files) != 2 || !strings.HasSuffix(r.Files[0], "_add_audit_index.up.sql") {
+		t.Errorf("result = %+v", r)
+	}
+	if up, _ := os.ReadFile(r.Files[0]); !strings.HasSuffix(string(up), "SELECT 1;\n") {
+		t.Errorf("up file does not hold the -sql statement:\n%s", up)
+	}
+
+	for _, args := range [][]string{nil, {"a", "b"}, {"bad name!"}} {
+		if code := create(dir, args, &result{}); code != exitUsage {
+			t.Errorf("create(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
@@ -1,66 +1,414 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+
+	"go-starter/internal/config"
+	"go-starter/internal/migrations"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/joho/godotenv"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Exit codes
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNoChange = 3
 )
 
+// Command statuses
+const (
+	statusApplied  = "applied"
+	statusCreated  = "created"
+	statusNoChange = "no_change"
+	statusDryRun   = "dry_run"
+	statusError    = "error"
+)
+
+// result is printed to stdout as one JSON line per command
+type result struct {
+	Command string `json:"command"`
+	Status  string `json:"status,omitempty"`
+	// Version is the schema version after the command; nil when no migration is applied
+	Version *uint    `json:"version"`
+	Dirty   bool     `json:"dirty"`
+	Pending []string `json:"pending,omitempty"`
+	// Files lists the files written by create
+	Files []string `json:"files,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+const usage = `Usage: migrate [flags] <command> [args]
+
+Commands:
+  create NAME       Create a timestamped up/down migration pair (-sql "..." pre-populates up)
+  version           Print the current schema version and dirty flag
+  up [N]            Apply all pending migrations, or the next N
+  down N            Roll back the last N migrations
+  down -all -yes    Roll back every migration
+  goto V            Migrate up or down to version V
+  force V           Set the version to V without running migrations, to recover a dirty state
+
+Exit codes: 0 changes applied, 1 error, 2 usage error, 3 no change.
+
+Flags:
+`
+
 func main() {
-	// Load .env file for local development
-	_ = godotenv.Load()
+	os.Exit(run())
+}
 
-	var direction string
-	flag.StringVar(&direction, "direction", "up", "Migration direction: up or down")
+func run() int {
+	var (
+		path   string
+		dryRun bool
+	)
+	flag.StringVar(&path, "path", "", "Read migrations from this directory instead of the embedded ones")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the migrations that would run without applying them")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	// Build DSN from environment variables
-	dsn := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		getEnv("DB_USER", "app"),
-		getEnv("DB_PASSWORD", "secret"),
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_PORT", "5432"),
-		getEnv("DB_NAME", "appdb"),
-		getEnv("DB_SSLMODE", "disable"),
-	)
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	// Creating migrations only touches the migrations directory
+	if command == "create" {
+		dir := path
+		if dir == "" {
+			dir = defaultMigrationsDir
+		}
+		r := &result{Command: command}
+		code := create(dir, args, r)
+		if code == exitUsage {
+			return code
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(r); err != nil {
+			log.Printf("Failed to write result: %v", err)
+			return exitError
+		}
+		return code
+	}
 
-	// Create migration instance
-	m, err := migrate.New(
-		"file://internal/migrations",
-		dsn,
+	// Read the embedded migrations, or a directory in development
+	var (
+		src     source.Driver
+		srcName string
+		err     error
 	)
+	if path != "" {
+		src, err = source.Open("file://" + path)
+		srcName = "file"
+	} else {
+		src, err = migrations.Source()
+		srcName = "iofs"
+	}
+	if err != nil {
+		log.Printf("Failed to load migrations: %v", err)
+		return exitError
+	}
+
+	// Connect with the application's configuration, so .env files, secret
+	// providers and DB_* overrides apply the same way
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to create migrate instance: %v", err)
+		log.Printf("Failed to load configuration: %v", err)
+		return exitError
+	}
+	db, err := sql.Open("pgx", cfg.GetDSN())
+	if err != nil {
+		log.Printf("Failed to open database: %v", err)
+		return exitError
+	}
+	driver, err := migratepgx.WithInstance(db, &migratepgx.Config{})
+	if err != nil {
+		db.Close()
+		log.Printf("Failed to connect to database: %v", err)
+		return exitError
+	}
+
+	// Closing m also closes the driver and db
+	m, err := migrate.NewWithInstance(srcName, src, "pgx5", driver)
+	if err != nil {
+		driver.Close()
+		log.Printf("Failed to create migrate instance: %v", err)
+		return exitError
 	}
 	defer m.Close()
 
-	// Run migrations
-	switch direction {
+	r := &result{Command: command}
+	code := execute(m, src, command, args, dryRun, r)
+	if code == exitUsage {
+		return code
+	}
+
+	if version, dirty, err := m.Version(); err == nil {
+		r.Version, r.Dirty = &version, dirty
+	} else if !errors.Is(err, migrate.ErrNilVersion) && r.Error == "" {
+		r.Status, r.Error, code = statusError, err.Error(), exitError
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(r); err != nil {
+		log.Printf("Failed to write result: %v", err)
+		return exitError
+	}
+	return code
+}
+
+// execute runs command, recording its outcome in r, and returns the exit code
+func execute(m *migrate.Migrate, src source.Driver, command string, args []string, dryRun bool, r *result) int {
+	current, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fail(r, err)
+	}
+	var currentVersion *uint
+	if err == nil {
+		currentVersion = &current
+	}
+
+	switch command {
+	case "version":
+		if len(args) != 0 {
+			return usageError("version takes no arguments")
+		}
+		return exitOK
+
 	case "up":
-		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-			log.Fatalf("Failed to run migrations: %v", err)
+		n, err := optionalCount(args)
+		if err != nil {
+			return usageError(err.Error())
 		}
-		log.Println("Migrations applied successfully")
+		if dryRun {
+			pending, err := pendingUp(src, currentVersion, n, 0)
+			return planned(r, pending, err)
+		}
+		if n > 0 {
+			return applied(r, m.Steps(n))
+		}
+		return applied(r, m.Up())
+
 	case "down":
-		if err := m.Down(); err != nil && err != migrate.ErrNoChange {
-			log.Fatalf("Failed to rollback migrations: %v", err)
+		fs := flag.NewFlagSet("down", flag.ContinueOnError)
+		all := fs.Bool("all", false, "Roll back every migration")
+		yes := fs.Bool("yes", false, "Confirm rolling back every migration")
+		if err := fs.Parse(args); err != nil {
+			return exitUsage
+		}
+		n, err := optionalCount(fs.Args())
+		switch {
+		case err != nil:
+			return usageError(err.Error())
+		case n == 0 && !(*all && *yes):
+			return usageError("down requires a step count, or -all -yes to roll back every migration")
+		case n > 0 && *all:
+			return usageError("down takes either a step count or -all, not both")
+		}
+		if dryRun {
+			pending, err := pendingDown(src, currentVersion, n, 0)
+			return planned(r, pending, err)
+		}
+		if n > 0 {
+			return applied(r, m.Steps(-n))
+		}
+		return applied(r, m.Down())
+
+	case "goto":
+		target, err := versionArg(args)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		if dryRun {
+			var pending []string
+			if currentVersion == nil || target > current {
+				pending, err = pendingUp(src, currentVersion, 0, target)
+			} else {
+				pending, err = pendingDown(src, currentVersion, 0, target)
+			}
+			return planned(r, pending, err)
+		}
+		return applied(r, m.Migrate(target))
+
+	case "force":
+		target, err := versionArg(args)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		if dryRun {
+			r.Status = statusDryRun
+			if currentVersion != nil && target == current && !dirty {
+				r.Status = statusNoChange
+				return exitNoChange
+			}
+			return exitOK
+		}
+		return applied(r, m.Force(int(target)))
+	}
+
+	return usageError(fmt.Sprintf("unknown command %q", command))
+}
+
+// applied records the outcome of a migration and returns the exit code
+func applied(r *result, err error) int {
+	var short migrate.ErrShortLimit
+	switch {
+	case err == nil:
+		r.Status = statusApplied
+		return exitOK
+	case errors.Is(err, migrate.ErrNoChange):
+		r.Status = statusNoChange
+		return exitNoChange
+	case errors.As(err, &short):
+		// Fewer migrations were available than requested; those there were applied
+		log.Printf("Applied all available migrations, %d short of the requested steps", short.Short)
+		r.Status = statusApplied
+		return exitOK
+	}
+	return fail(r, err)
+}
+
+// planned records the migrations a dry run would apply and returns the exit code
+func planned(r *result, pending []string, err error) int {
+	if err != nil {
+		return fail(r, err)
+	}
+	if len(pending) == 0 {
+		r.Status = statusNoChange
+		return exitNoChange
+	}
+	r.Status = statusDryRun
+	r.Pending = pending
+	return exitOK
+}
+
+// fail records err and returns the error exit code
+func fail(r *result, err error) int {
+	r.Status = statusError
+	r.Error = err.Error()
+	return exitError
+}
+
+// usageError prints msg with the usage and returns the usage exit code
+func usageError(msg string) int {
+	fmt.Fprintf(os.Stderr, "migrate: %s\n\n", msg)
+	flag.Usage()
+	return exitUsage
+}
+
+// pendingUp lists the migrations applied going up from current (nil when no
+// migration is applied): at most n when n > 0, and none above until when until > 0
+func pendingUp(src source.Driver, current *uint, n int, until uint) ([]string, error) {
+	var (
+		version uint
+		err     error
+	)
+	if current == nil {
+		version, err = src.First()
+	} else {
+		version, err = src.Next(*current)
+	}
+
+	var pending []string
+	for ; err == nil; version, err = src.Next(version) {
+		if (n > 0 && len(pending) == n) || (until > 0 && version > until) {
+			return pending, nil
+		}
+		name, nameErr := migrationName(src, version, "up")
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		pending = append(pending, name)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return pending, nil
+	}
+	return nil, err
+}
+
+// pendingDown lists the migrations rolled back going down from current: at
+// most n when n > 0, and none at or below until
+func pendingDown(src source.Driver, current *uint, n int, until uint) ([]string, error) {
+	if current == nil {
+		return nil, nil
+	}
+
+	var pending []string
+	version := *current
+	for {
+		if (n > 0 && len(pending) == n) || version <= until {
+			return pending, nil
+		}
+		name, err := migrationName(src, version, "down")
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, name)
+
+		version, err = src.Prev(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return pending, nil
+		}
+		if err != nil {
+			return nil, err
 		}
-		log.Println("Migrations rolled back successfully")
-	default:
-		log.Fatalf("Invalid direction: %s (use 'up' or 'down')", direction)
 	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// migrationName returns the file name of a migration in the repository's
+// NNNNNN_identifier.direction.sql layout
+func migrationName(src source.Driver, version uint, direction string) (string, error) {
+	read := src.ReadUp
+	if direction == "down" {
+		read = src.ReadDown
+	}
+
+	body, identifier, err := read(version)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration %d: %w", version, err)
+	}
+	body.Close()
+	return fmt.Sprintf("%06d_%s.%s.sql", version, identifier, direction), nil
+}
+
+// optionalCount parses an optional positive step count; 0 means none was given
+func optionalCount(args []string) (int, error) {
+	switch len(args) {
+	case 0:
+		return 0, nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid step count %q", args[0])
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("expected at most one step count")
+}
+
+// versionArg parses the single version argument of goto and force
+func versionArg(args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a version")
+	}
+	v, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", args[0])
 	}
-	return defaultValue
+	return uint(v), nil
 }
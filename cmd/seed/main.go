@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"go-starter/internal/config"
+	"go-starter/internal/repositories"
+	"go-starter/pkg/database"
+
+	"go.uber.org/zap"
+)
+
+// options holds the command-line flags passed on to the seeders
+type options struct {
+	env           string
+	only          string
+	count         int
+	reset         bool
+	password      string
+	adminEmail    string
+	adminPassword string
+}
+
+func main() {
+	// Connect with the application's configuration, so .env files, secret
+	// providers and DB_* overrides apply the same way
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	adminEmail := os.Getenv("SEED_ADMIN_EMAIL")
+	if adminEmail == "" {
+		adminEmail = "admin@example.com"
+	}
+
+	var opts options
+	flag.StringVar(&opts.env, "env", cfg.Env, "Environment to seed; production only runs production-safe seeders")
+	flag.StringVar(&opts.only, "only", "", "Comma-separated seeders to run instead of all of them")
+	flag.IntVar(&opts.count, "count", 50, "Number of sample users to create")
+	flag.BoolVar(&opts.reset, "reset", false, "Delete existing sample users before seeding them")
+	flag.StringVar(&opts.password, "password", "password123", "Password shared by all sample users")
+	flag.StringVar(&opts.adminEmail, "admin-email", adminEmail, "Email of the admin account")
+	flag.Parse()
+
+	if opts.count < 0 {
+		log.Fatalf("Invalid count: %d", opts.count)
+	}
+	// The admin password never goes on the command line; outside production it
+	// falls back to the sample user password
+	opts.adminPassword = os.Getenv("SEED_ADMIN_PASSWORD")
+	if opts.adminPassword == "" && opts.env != "production" {
+		opts.adminPassword = opts.password
+	}
+
+	db, err := database.New(database.Config{DSN: cfg.GetDSN(), MaxConns: 1}, zap.NewNop())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	seeders, err := selectSeeders(registry(opts, repositories.NewUserRepository(db, 0)), opts.only, opts.env)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, s := range seeders {
+		// Each seeder and its history row commit together, so a failure leaves no partial data
+		err := db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			if err := s.Run(ctx, tx); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO seed_history (name, env) VALUES ($1, $2)", s.Name(), opts.env)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Seeder %s failed: %v", s.Name(), err)
+		}
+		log.Printf("Seeder %s applied", s.Name())
+	}
+}
+
+// selectSeeders returns the seeders named in only (all when empty) in registry
+// order. Seeders that aren't production-safe are skipped in production, or
+// rejected when named explicitly.
+func selectSeeders(regs []registration, only, env string) ([]Seeder, error) {
+	wanted := make(map[string]bool)
+	for _, name := range strings.Split(only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+
+	var seeders []Seeder
+	for _, reg := range regs {
+		name := reg.seeder.Name()
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		delete(wanted, name)
+
+		if env == "production" && !reg.production {
+			if only != "" {
+				return nil, fmt.Errorf("refusing to run seeder %s in production", name)
+			}
+			log.Printf("Skipping seeder %s in production", name)
+			continue
+		}
+		seeders = append(seeders, reg.seeder)
+	}
+
+	for name := range wanted {
+		return nil, fmt.Errorf("unknown seeder %q", name)
+	}
+	return seeders, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-starter/internal/models"
+	"go-starter/internal/repositories"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Seeder inserts one set of data. Run is called inside a transaction, which
+// ctx carries for repositories to join, and must be idempotent, so seeding
+// twice leaves the same data as seeding once.
+type Seeder interface {
+	Name() string
+	Run(ctx context.Context, tx *sql.Tx) error
+}
+
+// registration is a seeder in the ordered registry
+type registration struct {
+	seeder Seeder
+	// production allows the seeder to run when ENV=production; sample data
+	// and anything that deletes rows must leave it false
+	production bool
+}
+
+// registry returns the seeders in the order they run
+func registry(opts options, users *repositories.UserRepository) []registration {
+	return []registration{
+		{seeder: adminSeeder{email: opts.adminEmail, password: opts.adminPassword}, production: true},
+		{seeder: usersSeeder{users: users, count: opts.count, password: opts.password, reset: opts.reset}},
+	}
+}
+
+// adminSeeder creates the admin account, leaving an existing one untouched
+type adminSeeder struct {
+	email    string
+	password string
+}
+
+func (adminSeeder) Name() string { return "admin" }
+
+func (s adminSeeder) Run(ctx context.Context, tx *sql.Tx) error {
+	if s.password == "" {
+		return fmt.Errorf("SEED_ADMIN_PASSWORD is required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(s.password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO users (email, password_hash) VALUES ($1, $2) ON CONFLICT (email) DO NOTHING`,
+		s.email, string(hash))
+	return err
+}
+
+// usersSeeder creates user1@example.com ... userN@example.com sharing one
+// password, optionally deleting the existing sample users first. Other
+// accounts, such as the admin, are never touched.
+type usersSeeder struct {
+	users    *repositories.UserRepository
+	count    int
+	password string
+	reset    bool
+}
+
+func (usersSeeder) Name() string { return "users" }
+
+func (s usersSeeder) Run(ctx context.Context, tx *sql.Tx) error {
+	if s.reset {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE email LIKE 'user%@example.com'`); err != nil {
+			return fmt.Errorf("failed to reset users: %w", err)
+		}
+	}
+
+	// Hash once; every seeded user shares the same password
+	hash, err := bcrypt.GenerateFromPassword([]byte(s.password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	users := make([]*models.User, s.count)
+	for i := range users {
+		users[i] = &models.User{Email: fmt.Sprintf("user%d@example.com", i+1), PasswordHash: string(hash)}
+	}
+
+	// Users that already exist are reported per row and left as they are
+	_, err = s.users.CreateBatch(ctx, users)
+	return err
+}
@@ -0,0 +1,93 @@
+// Package audit records security-relevant authentication events.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// EventType identifies the kind of audited action
+type EventType string
+
+// Audited authentication events
+const (
+	EventRegister      EventType = "register"
+	EventLogin         EventType = "login"
+	EventLoginFailed   EventType = "login_failed"
+	EventEmailChange   EventType = "email_change"
+	EventAccountDelete EventType = "account_delete"
+	// EventAdminDelete is an account deleted by an admin, named in Reason
+	EventAdminDelete EventType = "admin_delete"
+	// EventAdminRestore is a deleted account restored by an admin, named in Reason
+	EventAdminRestore EventType = "admin_restore"
+)
+
+// Event outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is a single audit record. Passwords and tokens must never be stored.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	// UserID is zero when the user is unknown, e.g. a login for an unregistered email
+	UserID int `json:"user_id,omitempty"`
+	// Email is the address the action was attempted with
+	Email     string `json:"email,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Outcome   string `json:"outcome"`
+	// Reason explains a failure
+	Reason string `json:"reason,omitempty"`
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// Recorder fills in request metadata and writes events to a sink. A nil
+// Recorder discards all events.
+type Recorder struct {
+	sink     Sink
+	clientIP func(context.Context) (string, bool)
+}
+
+// NewRecorder creates a recorder writing to sink. clientIP resolves the
+// client address from the request context and may be nil.
+func NewRecorder(sink Sink, clientIP func(context.Context) (string, bool)) *Recorder {
+	return &Recorder{sink: sink, clientIP: clientIP}
+}
+
+// Record writes event to the sink. Failures are logged rather than returned so
+// that auditing never fails the audited request.
+func (r *Recorder) Record(ctx context.Context, event Event) {
+	if r == nil || r.sink == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.IP == "" && r.clientIP != nil {
+		event.IP, _ = r.clientIP(ctx)
+	}
+	if event.RequestID == "" {
+		event.RequestID = logger.RequestIDFromContext(ctx)
+	}
+
+	// The event must be stored even if the client has gone away
+	if err := r.sink.Write(context.WithoutCancel(ctx), event); err != nil {
+		logger.FromContext(ctx).Error("failed to write audit event",
+			zap.String("type", string(event.Type)),
+			zap.Int("user_id", event.UserID),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,37 @@
+// Package budget reports how much of a context deadline remains so that
+// callers can skip optional work when a request is running out of time.
+package budget
+
+import (
+	"context"
+	"time"
+)
+
+// Remaining returns the time left before the context deadline.
+// ok is false when the context has no deadline.
+func Remaining(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	remaining = time.Until(deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// Allows reports whether at least need remains before the context deadline.
+// Contexts without a deadline always allow the work.
+func Allows(ctx context.Context, need time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	remaining, ok := Remaining(ctx)
+	if !ok {
+		return true
+	}
+	return remaining >= need
+}
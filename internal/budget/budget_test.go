@@ -0,0 +1,64 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRemaining(t *testing.T) {
+	if _, ok := Remaining(context.Background()); ok {
+		t.Error("Remaining reported a budget for a context without deadline")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	remaining, ok := Remaining(ctx)
+	if !ok || remaining <= 50*time.Second || remaining > time.Minute {
+		t.Errorf("Remaining = %v, %v; want about 1m, true", remaining, ok)
+	}
+
+	past, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if remaining, ok := Remaining(past); !ok || remaining != 0 {
+		t.Errorf("Remaining past the deadline = %v, %v; want 0, true", remaining, ok)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		need time.Duration
+		want bool
+	}{
+		{"no deadline", context.Background(), time.Hour, true},
+		{"enough left", ctx, 30 * time.Second, true},
+		{"nothing needed", ctx, 0, true},
+		{"too little left", ctx, 2 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allows(tt.ctx, tt.need); got != tt.want {
+				t.Errorf("Allows(%v) = %v, want %v", tt.need, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if Allows(ctx, 0) {
+		t.Error("Allows = true for a canceled context without deadline")
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if Allows(expired, 0) {
+		t.Error("Allows = true past the deadline")
+	}
+}
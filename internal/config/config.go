@@ -1,117 +1,1048 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"go-starter/internal/features"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-// Config holds all application configuration
+// Config holds all application configuration. Each setting declares its
+// environment variable and default in struct tags (see env.go). Fields holding
+// secrets must be tagged `redact:"true"` so they are masked by Redacted.
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	JWT       JWTConfig
-	RateLimit RateLimitConfig
-	Logger    LoggerConfig
-	Env       string
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	JWT         JWTConfig         `yaml:"jwt" envPrefix:"JWT_"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" envPrefix:"RATE_LIMIT_"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency" envPrefix:"CONCURRENCY_"`
+	Logger      LoggerConfig      `yaml:"logger" envPrefix:"LOG_"`
+	BasicAuth   BasicAuthConfig   `yaml:"basic_auth"`
+	Locale      LocaleConfig      `yaml:"locale"`
+	UserAgent   UserAgentConfig   `yaml:"user_agent" envPrefix:"UA_"`
+	Stats       StatsConfig       `yaml:"stats" envPrefix:"STATS_"`
+	Swagger     SwaggerConfig     `yaml:"swagger" envPrefix:"SWAGGER_"`
+	CORS        CORSConfig        `yaml:"cors" envPrefix:"CORS_"`
+	Security    SecurityConfig    `yaml:"security" envPrefix:"SECURITY_"`
+	Audit       AuditConfig       `yaml:"audit" envPrefix:"AUDIT_"`
+	// LoginThrottle blocks client IPs after repeated failed logins
+	LoginThrottle LoginThrottleConfig `yaml:"login_throttle" envPrefix:"LOGIN_THROTTLE_"`
+	// EmailValidation optionally checks that email domains can receive mail
+	EmailValidation EmailValidationConfig `yaml:"email_validation" envPrefix:"VALIDATE_EMAIL_"`
+	// Idempotency replays responses to retried registrations
+	Idempotency IdempotencyConfig `yaml:"idempotency" envPrefix:"IDEMPOTENCY_"`
+	Features    FeatureFlags      `yaml:"features" env:"FEATURE_FLAGS" default:"user_search=true"`
+	Env         string            `yaml:"env" env:"ENV" default:"development"`
+	// ReloadInterval periodically reloads the configuration (0 reloads only on SIGHUP)
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"CONFIG_RELOAD_INTERVAL"`
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port string
+	// Host is the bind address, e.g. 127.0.0.1 behind a local proxy; empty listens on all interfaces
+	Host            string        `yaml:"host" env:"SERVER_HOST"`
+	Port            string        `yaml:"port" env:"SERVER_PORT" default:"8080" required:"true"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"15s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"60s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+	// ShutdownDelay keeps serving while readiness reports draining, so load
+	// balancers see the 503 before the listener closes; it counts against ShutdownTimeout
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" default:"5s"`
+	// ProxyProtocol enables parsing the PROXY protocol header on accepted connections
+	ProxyProtocol bool `yaml:"proxy_protocol" env:"SERVER_PROXY_PROTOCOL"`
+	// RealIPHeaders lists headers checked for the client IP, in order of preference
+	RealIPHeaders []string `yaml:"real_ip_headers" env:"HTTP_REAL_IP_HEADERS" default:"X-Forwarded-For,X-Real-IP"`
+	// TrustedProxies lists the CIDRs or addresses of proxies whose client IP
+	// headers and X-Forwarded-Proto are honored; empty ignores those headers
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// TLSCertFile and TLSKeyFile enable HTTPS; the pair is reloaded on SIGHUP
+	TLSCertFile string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// TLSClientCAFile requires clients to present a certificate signed by these CAs (mTLS)
+	TLSClientCAFile string `yaml:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	// HTTPRedirectPort optionally serves plain HTTP redirects to HTTPS on this port
+	HTTPRedirectPort string `yaml:"http_redirect_port" env:"HTTP_REDIRECT_PORT"`
+	// AdminPort optionally moves ops, admin and swagger routes off the public port
+	AdminPort string `yaml:"admin_port" env:"ADMIN_PORT"`
+	// ResponseEnvelope wraps successful auth and user responses as {"data", "meta"}
+	ResponseEnvelope bool `yaml:"response_envelope" env:"RESPONSE_ENVELOPE"`
 }
 
-// DatabaseConfig holds database connection configuration
+// DatabaseConfig holds database connection configuration. DATABASE_URL, when
+// set, provides the connection settings that DB_* variables don't override.
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Name     string
-	SSLMode  string
+	Host     string `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Port     string `yaml:"port" env:"DB_PORT" default:"5432" required:"true"`
+	User     string `yaml:"user" env:"DB_USER" default:"app"`
+	Password string `yaml:"password" env:"DB_PASSWORD" required:"true" secret:"true" redact:"true"`
+	Name     string `yaml:"name" env:"DB_NAME" default:"appdb"`
+	SSLMode  string `yaml:"ssl_mode" env:"DB_SSLMODE" default:"disable"`
+	// ReplicaDSNs lists read replica connection strings
+	ReplicaDSNs []string `yaml:"replica_dsns" env:"DB_REPLICA_DSNS" redact:"true"`
+	// Pool configures the connection pool
+	Pool DatabasePoolConfig `yaml:"pool" envPrefix:"DB_"`
+	// SlowQueryThreshold logs queries slower than this at warn level (0 disables)
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"SLOW_QUERY_THRESHOLD" default:"200ms"`
+	// Params holds additional connection parameters, e.g. from DATABASE_URL
+	Params map[string]string `yaml:"params" env:"DB_PARAMS"`
+	// Options holds extra connection parameters in libpq keyword/value
+	// syntax, e.g. "search_path='app,public' options='-c geqo=off'".
+	// They override Params.
+	Options string `yaml:"options" env:"DB_OPTIONS" redact:"true"`
+	// HealthWarnLatency reports the database as degraded when a health ping is slower (0 disables)
+	HealthWarnLatency time.Duration `yaml:"health_warn_latency" env:"DB_HEALTH_WARN_LATENCY" default:"250ms"`
+	// HealthMaxLatency reports the database as unhealthy when a health ping is slower (0 disables)
+	HealthMaxLatency time.Duration `yaml:"health_max_latency" env:"DB_HEALTH_MAX_LATENCY" default:"1s"`
+	// StatementTimeout is the Postgres statement_timeout of pooled connections
+	// and the deadline of repository queries (0 disables both)
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT" default:"10s"`
+	// AutoMigrate applies pending embedded migrations at startup
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" default:"false"`
+	// SchemaCheck is what happens at startup without AutoMigrate when the
+	// schema version differs from the binary's: "fail" or "warn"
+	SchemaCheck string `yaml:"schema_check" env:"DB_SCHEMA_CHECK" default:"fail"`
+	// ReadyAcquireTimeout bounds taking a pool connection in the readiness check
+	ReadyAcquireTimeout time.Duration `yaml:"ready_acquire_timeout" env:"DB_READY_ACQUIRE_TIMEOUT" default:"500ms"`
+	// ReadyQueryCheck also queries the users table in the readiness check
+	ReadyQueryCheck bool `yaml:"ready_query_check" env:"DB_READY_QUERY_CHECK" default:"false"`
+}
+
+// DatabasePoolConfig holds database connection pool (pgxpool) configuration
+type DatabasePoolConfig struct {
+	MaxOpenConns int `yaml:"max_open_conns" env:"MAX_OPEN_CONNS" default:"25"`
+	// MinConns is the number of connections the pool keeps open when idle
+	MinConns        int           `yaml:"min_conns" env:"MIN_CONNS" default:"0"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"CONN_MAX_LIFETIME" default:"5m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"CONN_MAX_IDLE_TIME" default:"5m"`
+	// HealthCheckPeriod is how often idle connections are checked and expired
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" env:"HEALTH_CHECK_PERIOD" default:"1m"`
+	// StatsInterval logs pool statistics this often (0 disables)
+	StatsInterval time.Duration `yaml:"stats_interval" env:"STATS_INTERVAL" default:"30s"`
+	// MaxOpenConnsCap is a safety limit so MaxOpenConns can't exhaust Postgres max_connections
+	MaxOpenConnsCap int `yaml:"max_open_conns_cap" env:"MAX_OPEN_CONNS_CAP" default:"100"`
 }
 
 // JWTConfig holds JWT authentication configuration
 type JWTConfig struct {
-	Secret string
+	Secret    string        `yaml:"secret" env:"SECRET" required:"true" secret:"true" redact:"true"`
+	AccessTTL time.Duration `yaml:"access_ttl" env:"ACCESS_TTL" default:"15m"`
+	// RefreshTTL is how long a session can be refreshed; it must exceed AccessTTL
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"REFRESH_TTL" default:"720h"`
+	// PreviousSecrets are still accepted for verification while JWT_SECRET is rotated
+	PreviousSecrets []string `yaml:"previous_secrets" env:"PREVIOUS_SECRETS" secret:"true" redact:"true"`
+	// AllowWeakSecret downgrades weak secret errors to warnings for local development
+	AllowWeakSecret bool `yaml:"allow_weak_secret" env:"ALLOW_WEAK_SECRET"`
 }
 
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
-	RPS   int
-	Burst int
+	// Enabled can turn rate limiting off, e.g. for load tests; zero limits are rejected
+	Enabled      bool     `yaml:"enabled" env:"ENABLED" default:"true"`
+	RPS          int      `yaml:"rps" env:"RPS" default:"10"`
+	Burst        int      `yaml:"burst" env:"BURST" default:"20"`
+	BypassTokens []string `yaml:"bypass_tokens" env:"BYPASS_TOKENS" redact:"true"`
+	// AllowBypassInProduction must be set to use bypass tokens in production
+	AllowBypassInProduction bool `yaml:"allow_bypass_in_production" env:"ALLOW_BYPASS_IN_PRODUCTION"`
+	// Rules override RPS and Burst for matching requests; the longest matching prefix wins
+	Rules RateLimitRules `yaml:"rules" env:"RULES"`
+	// MaxRetryAfter caps the Retry-After escalated for clients that retry
+	// before their hint expires; 0 disables escalation
+	MaxRetryAfter time.Duration `yaml:"max_retry_after" env:"MAX_RETRY_AFTER" default:"1m"`
+}
+
+// RateLimitRule limits requests whose path starts with PathPrefix and, if set, use Method
+type RateLimitRule struct {
+	PathPrefix string `yaml:"path_prefix"`
+	Method     string `yaml:"method"`
+	RPS        int    `yaml:"rps"`
+	Burst      int    `yaml:"burst"`
+	// Key selects what is limited: "ip" (default) or "user", which falls
+	// back to the IP for unauthenticated requests
+	Key string `yaml:"key"`
+}
+
+// RateLimitRules is a list of rate limit rules. In the environment it is
+// written as comma-separated "[METHOD] /prefix rps burst [ip|user]" entries.
+type RateLimitRules []RateLimitRule
+
+// UnmarshalText parses rules in the environment variable format
+func (r *RateLimitRules) UnmarshalText(text []byte) error {
+	rules, err := parseRateLimitRules(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// ConcurrencyConfig holds in-flight request limiting configuration
+type ConcurrencyConfig struct {
+	MaxInFlight  int           `yaml:"max_in_flight" env:"MAX_IN_FLIGHT" default:"100"`
+	QueueTimeout time.Duration `yaml:"queue_timeout" env:"QUEUE_TIMEOUT" default:"5s"`
 }
 
 // LoggerConfig holds logging configuration
 type LoggerConfig struct {
-	Level string
+	Level                string        `yaml:"level" env:"LEVEL" default:"info"`
+	Format               string        `yaml:"format" env:"FORMAT"`
+	SlowRequestThreshold time.Duration `yaml:"slow_request_threshold" env:"SLOW_REQUEST_THRESHOLD" default:"1s"`
+	// SamplingInitial enables sampling when positive; SamplingThereafter must then be at least 1
+	SamplingInitial    int `yaml:"sampling_initial" env:"SAMPLING_INITIAL"`
+	SamplingThereafter int `yaml:"sampling_thereafter" env:"SAMPLING_THEREAFTER"`
+}
+
+// BasicAuthConfig holds credentials for HTTP basic auth on ops endpoints
+type BasicAuthConfig struct {
+	// Users maps usernames to bcrypt password hashes
+	Users BasicAuthUsers `yaml:"users" env:"BASIC_AUTH_USERS" secret:"true" redact:"true"`
+	// UserIDs maps usernames to the user ID of the admin's own account, which
+	// they can't delete through the admin API
+	UserIDs BasicAuthUserIDs `yaml:"user_ids" env:"BASIC_AUTH_USER_IDS"`
+}
+
+// validate checks UserIDs only names configured users
+func (b BasicAuthConfig) validate() error {
+	var errs []error
+	for _, username := range slices.Sorted(maps.Keys(b.UserIDs)) {
+		if _, ok := b.Users[username]; !ok {
+			errs = append(errs, fmt.Errorf("BASIC_AUTH_USER_IDS: %q is not in BASIC_AUTH_USERS", username))
+		}
+		if b.UserIDs[username] <= 0 {
+			errs = append(errs, fmt.Errorf("BASIC_AUTH_USER_IDS: user ID of %q must be positive", username))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BasicAuthUsers maps usernames to bcrypt password hashes. In the environment
+// it is written as comma-separated user:bcrypt-hash pairs.
+type BasicAuthUsers map[string]string
+
+// UnmarshalText parses users in the environment variable format
+func (u *BasicAuthUsers) UnmarshalText(text []byte) error {
+	users, err := parseBasicAuthUsers(string(text))
+	if err != nil {
+		return err
+	}
+	*u = users
+	return nil
+}
+
+// LocaleConfig holds localization configuration
+type LocaleConfig struct {
+	Supported []string `yaml:"supported" env:"SUPPORTED_LOCALES" default:"en,es,de"`
+	Default   string   `yaml:"default" env:"DEFAULT_LOCALE" default:"en"`
+}
+
+// UserAgentConfig holds user agent filtering configuration
+type UserAgentConfig struct {
+	DenyPatterns     []string `yaml:"deny_patterns" env:"DENY_PATTERNS"`
+	AllowPatterns    []string `yaml:"allow_patterns" env:"ALLOW_PATTERNS"`
+	RejectEmptyPaths []string `yaml:"reject_empty_paths" env:"REJECT_EMPTY_PATHS" default:"/auth"`
+	// RulesFile optionally adds rules from a file that is re-read on SIGHUP
+	RulesFile string `yaml:"rules_file" env:"RULES_FILE"`
+}
+
+// StatsConfig holds per-client request statistics configuration
+type StatsConfig struct {
+	Enabled    bool `yaml:"enabled" env:"ENABLED" default:"true"`
+	MaxClients int  `yaml:"max_clients" env:"MAX_CLIENTS" default:"1000"`
+	// HalfLife controls how quickly old traffic stops counting
+	HalfLife time.Duration `yaml:"half_life" env:"HALF_LIFE" default:"5m"`
+}
+
+// validate checks the collector can hold clients and decay their counts;
+// negative half-lives are reported with the other durations
+func (s StatsConfig) validate() error {
+	if !s.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if s.MaxClients <= 0 {
+		errs = append(errs, fmt.Errorf("STATS_MAX_CLIENTS must be positive"))
+	}
+	if s.HalfLife == 0 {
+		errs = append(errs, fmt.Errorf("STATS_HALF_LIFE must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// SwaggerConfig holds the API location advertised in the OpenAPI spec
+type SwaggerConfig struct {
+	// Host is the host (and port) clients call; empty uses the host serving the docs
+	Host     string `yaml:"host" env:"HOST"`
+	BasePath string `yaml:"base_path" env:"BASE_PATH" default:"/"`
+}
+
+// CORSConfig holds cross-origin resource sharing configuration
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the API ("*" allows any); empty disables CORS
+	AllowedOrigins []string `yaml:"allowed_origins" env:"ALLOWED_ORIGINS"`
+}
+
+// SecurityConfig holds the values of security response headers
+type SecurityConfig struct {
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CSP" default:"default-src 'self'"`
+	ReferrerPolicy        string `yaml:"referrer_policy" env:"REFERRER_POLICY" default:"strict-origin-when-cross-origin"`
+	FrameOptions          string `yaml:"frame_options" env:"FRAME_OPTIONS" default:"DENY"`
+	// HSTSMaxAge is sent over HTTPS in production (0 disables HSTS)
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" default:"8760h"`
+}
+
+// AuditConfig holds where authentication audit events are written
+type AuditConfig struct {
+	// Sink is "log" (a JSON lines file), "db" (the audit_log table) or "none"
+	Sink string `yaml:"sink" env:"SINK" default:"log"`
+	// LogPath is the file used by the log sink ("stdout" and "stderr" are accepted)
+	LogPath string `yaml:"log_path" env:"LOG_PATH" default:"stdout"`
+}
+
+// LoginThrottleConfig holds the per-IP failed login throttle configuration
+type LoginThrottleConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED" default:"true"`
+	// MaxFailures is the number of failed logins before a client IP is blocked
+	MaxFailures int `yaml:"max_failures" env:"MAX_FAILURES" default:"10"`
+	// Block is the first block duration, doubled on each further failure up to MaxBlock
+	Block    time.Duration `yaml:"block" env:"BLOCK" default:"1m"`
+	MaxBlock time.Duration `yaml:"max_block" env:"MAX_BLOCK" default:"1h"`
+}
+
+// validate checks the throttle limits are positive and consistent
+func (l LoginThrottleConfig) validate() error {
+	if !l.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if l.MaxFailures <= 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_THROTTLE_MAX_FAILURES must be positive"))
+	}
+	if l.Block <= 0 {
+		errs = append(errs, fmt.Errorf("LOGIN_THROTTLE_BLOCK must be positive"))
+	}
+	if l.MaxBlock < l.Block {
+		errs = append(errs, fmt.Errorf("LOGIN_THROTTLE_MAX_BLOCK (%s) must not be shorter than LOGIN_THROTTLE_BLOCK (%s)", l.MaxBlock, l.Block))
+	}
+	return errors.Join(errs...)
+}
+
+// EmailValidationConfig holds the email deliverability check configuration
+type EmailValidationConfig struct {
+	// MX rejects signup and email change addresses whose domain has no mail server
+	MX bool `yaml:"mx" env:"MX" default:"false"`
+	// MXTimeout bounds each DNS lookup; lookups that time out let the address through
+	MXTimeout time.Duration `yaml:"mx_timeout" env:"MX_TIMEOUT" default:"2s"`
+	// MXCacheTTL is how long a domain's lookup result is reused
+	MXCacheTTL time.Duration `yaml:"mx_cache_ttl" env:"MX_CACHE_TTL" default:"1h"`
+}
+
+// validate checks the MX lookup timeout and cache TTL are positive
+func (e EmailValidationConfig) validate() error {
+	if !e.MX {
+		return nil
+	}
+
+	var errs []error
+	if e.MXTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("VALIDATE_EMAIL_MX_TIMEOUT must be positive"))
+	}
+	if e.MXCacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("VALIDATE_EMAIL_MX_CACHE_TTL must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// IdempotencyConfig holds the Idempotency-Key store configuration
+type IdempotencyConfig struct {
+	Enabled bool `yaml:"enabled" env:"ENABLED" default:"true"`
+	// TTL is how long a response is replayed for its key
+	TTL time.Duration `yaml:"ttl" env:"TTL" default:"24h"`
+	// MaxKeys bounds the store; requests with new keys beyond it are served without replay
+	MaxKeys int `yaml:"max_keys" env:"MAX_KEYS" default:"10000"`
+}
+
+// validate checks the TTL and key limit are positive
+func (i IdempotencyConfig) validate() error {
+	if !i.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if i.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("IDEMPOTENCY_TTL must be positive"))
+	}
+	if i.MaxKeys <= 0 {
+		errs = append(errs, fmt.Errorf("IDEMPOTENCY_MAX_KEYS must be positive"))
+	}
+	return errors.Join(errs...)
 }
 
-// Load reads configuration from environment variables
+// FeatureFlags maps feature names to "true", "false" or a rollout percentage
+// such as "25%". Features not listed are disabled. FEATURE_FLAGS entries are
+// merged over those from the config file.
+type FeatureFlags map[string]string
+
+// Load reads configuration from the optional CONFIG_FILE and environment variables.
+// Environment variables always take precedence over values from the file.
 func Load() (*Config, error) {
-	// Try to load .env file for local development (ignore error if not exists)
-	_ = godotenv.Load()
-
-	cfg := &Config{
-		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-		},
-		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "app"),
-			Password: getEnv("DB_PASSWORD", ""),
-			Name:     getEnv("DB_NAME", "appdb"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
-		},
-		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", ""),
-		},
-		RateLimit: RateLimitConfig{
-			RPS:   getEnvAsInt("RATE_LIMIT_RPS", 10),
-			Burst: getEnvAsInt("RATE_LIMIT_BURST", 20),
-		},
-		Logger: LoggerConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
-		},
-		Env: getEnv("ENV", "development"),
-	}
-
-	// Validate required configuration
-	if err := cfg.Validate(); err != nil {
+	// Load .env files for local development
+	if _, err := LoadDotenv(); err != nil {
+		return nil, err
+	}
+
+	// Start from defaults, overlay the optional config file, then environment variables
+	cfg := defaultConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Secrets are resolved through the provider selected by SECRETS_PROVIDER
+	provider, err := newSecretProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	// Strict mode, on by default in production, makes malformed values fatal
+	strict, err := getEnvAsBool("CONFIG_STRICT", getEnv("ENV", cfg.Env) == "production")
+	if err != nil {
+		return nil, err
+	}
+	env := &envLoader{provider: provider, strict: strict}
+
+	// DATABASE_URL provides the database settings in one value; discrete DB_*
+	// variables override its individual components
+	if databaseURL := env.secret("DATABASE_URL"); databaseURL != "" {
+		if err := parseDatabaseURL(databaseURL, &cfg.Database); err != nil {
+			env.fail(err, false)
+		}
+	}
+
+	env.load(reflect.ValueOf(cfg).Elem(), "")
+
+	// Report parse and validation problems together so they can be fixed in one go
+	if err := errors.Join(append(env.errs, cfg.Validate())...); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
-// Validate checks that all required configuration is present
+// defaultConfig returns the configuration used when no file or environment value is set
+func defaultConfig() *Config {
+	cfg := &Config{}
+	setDefaults(reflect.ValueOf(cfg).Elem())
+	return cfg
+}
+
+// Validate checks that all required configuration is present and consistent.
+// Every problem found is reported, joined into a single error.
 func (c *Config) Validate() error {
-	if c.Database.Password == "" {
-		return fmt.Errorf("DB_PASSWORD is required")
+	var errs []error
+
+	errs = append(errs, missingRequired(reflect.ValueOf(c).Elem(), "")...)
+	// A weak JWT secret is fatal unless explicitly allowed outside production
+	if weak := c.weakJWTSecrets(); len(weak) > 0 {
+		if c.JWT.AllowWeakSecret && !c.IsProduction() {
+			for _, err := range weak {
+				logger.Warn("weak JWT secret allowed by JWT_ALLOW_WEAK_SECRET, do not use it in production", zap.Error(err))
+			}
+		} else {
+			errs = append(errs, weak...)
+		}
+	}
+	if c.JWT.AllowWeakSecret && c.IsProduction() {
+		errs = append(errs, fmt.Errorf("JWT_ALLOW_WEAK_SECRET is not allowed in production"))
+	}
+	if slices.Contains(c.JWT.PreviousSecrets, c.JWT.Secret) {
+		errs = append(errs, fmt.Errorf("JWT_PREVIOUS_SECRETS must not contain JWT_SECRET"))
+	}
+	errs = append(errs, c.Server.validateHost())
+	errs = append(errs, c.Server.validateAdminPort())
+	errs = append(errs, validatePort("SERVER_PORT", c.Server.Port))
+	errs = append(errs, validatePort("DB_PORT", c.Database.Port))
+	errs = append(errs, c.Server.validateTLS())
+	if _, err := c.Server.TrustedProxyNets(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.validateDurations())
+	errs = append(errs, c.Database.Pool.validate())
+	if c.Database.StatementTimeout < 0 {
+		errs = append(errs, fmt.Errorf("DB_STATEMENT_TIMEOUT must not be negative"))
+	}
+	errs = append(errs, validateDSNParams(c.Database.Params))
+	if _, err := parseDSNOptions(c.Database.Options); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Database.ReadyAcquireTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("DB_READY_ACQUIRE_TIMEOUT must be positive"))
+	}
+	if c.Database.SchemaCheck != "fail" && c.Database.SchemaCheck != "warn" {
+		errs = append(errs, fmt.Errorf("DB_SCHEMA_CHECK must be fail or warn, got %q", c.Database.SchemaCheck))
+	}
+	errs = append(errs, c.RateLimit.validate())
+	errs = append(errs, c.LoginThrottle.validate())
+	errs = append(errs, c.EmailValidation.validate())
+	errs = append(errs, c.Idempotency.validate())
+	errs = append(errs, c.Stats.validate())
+	errs = append(errs, c.BasicAuth.validate())
+	if _, err := zapcore.ParseLevel(c.Logger.Level); err != nil || c.Logger.Level == "" {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be one of debug, info, warn, error, dpanic, panic or fatal, got %q", c.Logger.Level))
+	}
+	if c.Logger.Format != "" && c.Logger.Format != "json" && c.Logger.Format != "console" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be json or console"))
+	}
+	if c.Logger.SamplingInitial < 0 {
+		errs = append(errs, fmt.Errorf("LOG_SAMPLING_INITIAL must not be negative"))
+	}
+	if c.Logger.SamplingThereafter < 0 {
+		errs = append(errs, fmt.Errorf("LOG_SAMPLING_THEREAFTER must not be negative"))
+	} else if c.Logger.SamplingInitial > 0 && c.Logger.SamplingThereafter == 0 {
+		errs = append(errs, fmt.Errorf("LOG_SAMPLING_THEREAFTER must be at least 1 when LOG_SAMPLING_INITIAL is set, otherwise every entry past the first %d per second is dropped", c.Logger.SamplingInitial))
 	}
-	if c.JWT.Secret == "" {
-		return fmt.Errorf("JWT_SECRET is required")
+	if c.IsProduction() && len(c.RateLimit.BypassTokens) > 0 && !c.RateLimit.AllowBypassInProduction {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BYPASS_TOKENS is not allowed in production unless RATE_LIMIT_ALLOW_BYPASS_IN_PRODUCTION=true"))
 	}
-	if c.Server.Port == "" {
-		return fmt.Errorf("SERVER_PORT is required")
+	if f := strings.ToUpper(c.Security.FrameOptions); f != "" && f != "DENY" && f != "SAMEORIGIN" {
+		errs = append(errs, fmt.Errorf("SECURITY_FRAME_OPTIONS must be DENY, SAMEORIGIN or empty"))
+	}
+	if c.Audit.Sink != "log" && c.Audit.Sink != "db" && c.Audit.Sink != "none" {
+		errs = append(errs, fmt.Errorf("AUDIT_SINK must be log, db or none"))
+	} else if c.Audit.Sink == "log" && c.Audit.LogPath == "" {
+		errs = append(errs, fmt.Errorf("AUDIT_LOG_PATH is required when AUDIT_SINK=log"))
+	}
+	if err := features.Validate(c.Features); err != nil {
+		errs = append(errs, fmt.Errorf("FEATURE_FLAGS: %w", err))
+	}
+	if !slices.Contains(c.Locale.Supported, c.Locale.Default) {
+		errs = append(errs, fmt.Errorf("DEFAULT_LOCALE must be one of SUPPORTED_LOCALES"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// minJWTSecretLength is the minimum HMAC secret size in bytes
+const minJWTSecretLength = 32
+
+// placeholderSecrets are well-known sample values that must never sign tokens
+var placeholderSecrets = []string{
+	"secret",
+	"changeme",
+	"change-me",
+	"password",
+	"jwt-secret",
+	"your-secret-key",
+	"supersecretkey123",
+	"test-secret-key-for-ci",
+}
+
+// weakJWTSecrets reports problems with the current and previous JWT secrets
+func (c *Config) weakJWTSecrets() []error {
+	var errs []error
+	if c.JWT.Secret != "" {
+		errs = append(errs, c.weakJWTSecret("JWT_SECRET", c.JWT.Secret)...)
+	}
+	for i, secret := range c.JWT.PreviousSecrets {
+		errs = append(errs, c.weakJWTSecret(fmt.Sprintf("JWT_PREVIOUS_SECRETS entry %d", i+1), secret)...)
+	}
+	return errs
+}
+
+// weakJWTSecret reports problems with the JWT secret called name. The secret
+// itself is never included in the errors.
+func (c *Config) weakJWTSecret(name, secret string) []error {
+	var errs []error
+	if slices.Contains(placeholderSecrets, strings.ToLower(secret)) {
+		errs = append(errs, fmt.Errorf("%s is a well-known placeholder value", name))
+	}
+	if len(secret) < minJWTSecretLength {
+		errs = append(errs, fmt.Errorf("%s must be at least %d bytes, got %d", name, minJWTSecretLength, len(secret)))
+	}
+	if secret == c.Database.Password {
+		errs = append(errs, fmt.Errorf("%s must differ from DB_PASSWORD", name))
+	}
+
+	// Rough entropy check: repeated or patterned values use few distinct bytes
+	distinct := make(map[byte]bool)
+	for i := 0; i < len(secret); i++ {
+		distinct[secret[i]] = true
+	}
+	if len(secret) >= minJWTSecretLength && len(distinct) < 8 {
+		errs = append(errs, fmt.Errorf("%s has too little variety to be random (%d distinct bytes)", name, len(distinct)))
+	}
+
+	return errs
+}
+
+// Addr returns the address the server listens on
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+// RedirectAddr returns the address the HTTP redirect server listens on
+func (s ServerConfig) RedirectAddr() string {
+	return net.JoinHostPort(s.Host, s.HTTPRedirectPort)
+}
+
+// AdminAddr returns the address the admin server listens on
+func (s ServerConfig) AdminAddr() string {
+	return net.JoinHostPort(s.Host, s.AdminPort)
+}
+
+// TrustedProxyNets parses TrustedProxies. A bare address is a single-host network.
+func (s ServerConfig) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, value := range s.TrustedProxies {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: %q is not a CIDR or IP address", value)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// validateAdminPort checks the admin port, if set, is free for the admin server
+func (s ServerConfig) validateAdminPort() error {
+	if s.AdminPort == "" {
+		return nil
+	}
+	if err := validatePort("ADMIN_PORT", s.AdminPort); err != nil {
+		return err
+	}
+	if s.AdminPort == s.Port || s.AdminPort == s.HTTPRedirectPort {
+		return fmt.Errorf("ADMIN_PORT must differ from SERVER_PORT and HTTP_REDIRECT_PORT")
+	}
+	return nil
+}
+
+// validateHost checks the bind address, if set, is an IP address or host name
+func (s ServerConfig) validateHost() error {
+	if s.Host == "" || net.ParseIP(s.Host) != nil {
+		return nil
+	}
+	if strings.ContainsAny(s.Host, ":/[] ") {
+		return fmt.Errorf("SERVER_HOST must be an IP address or host name without a port, got %q", s.Host)
+	}
+	return nil
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// validateTLS checks the TLS settings are complete
+func (s ServerConfig) validateTLS() error {
+	var errs []error
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if !s.TLSEnabled() {
+		if s.TLSClientCAFile != "" {
+			errs = append(errs, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE"))
+		}
+		if s.HTTPRedirectPort != "" {
+			errs = append(errs, fmt.Errorf("HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE"))
+		}
+		return errors.Join(errs...)
+	}
+	if s.HTTPRedirectPort != "" {
+		if err := validatePort("HTTP_REDIRECT_PORT", s.HTTPRedirectPort); err != nil {
+			errs = append(errs, err)
+		} else if s.HTTPRedirectPort == s.Port {
+			errs = append(errs, fmt.Errorf("HTTP_REDIRECT_PORT must differ from SERVER_PORT"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatePort checks that value, if set, is a TCP port number
+func validatePort(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%s must be a port number between 1 and 65535, got %q", name, value)
 	}
 	return nil
 }
 
-// GetDSN returns the PostgreSQL connection string
+// Sanity ceilings for rate limits; larger values are almost certainly typos
+const (
+	maxRateLimitRPS   = 10000
+	maxRateLimitBurst = 100000
+)
+
+// validate checks the rate limits are positive, below the sanity ceilings, and
+// the burst can absorb one second of traffic
+func (r RateLimitConfig) validate() error {
+	var errs []error
+	if r.RPS <= 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_RPS must be positive (set RATE_LIMIT_ENABLED=false to disable rate limiting)"))
+	} else if r.RPS > maxRateLimitRPS {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_RPS (%d) must not exceed %d", r.RPS, maxRateLimitRPS))
+	}
+	if r.Burst <= 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BURST must be positive (set RATE_LIMIT_ENABLED=false to disable rate limiting)"))
+	} else if r.Burst > maxRateLimitBurst {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BURST (%d) must not exceed %d", r.Burst, maxRateLimitBurst))
+	}
+	if r.RPS > 0 && r.Burst > 0 && r.Burst < r.RPS {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_BURST (%d) must not be less than RATE_LIMIT_RPS (%d)", r.Burst, r.RPS))
+	}
+	if r.MaxRetryAfter < 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_MAX_RETRY_AFTER must not be negative"))
+	}
+
+	seen := make(map[string]bool, len(r.Rules))
+	for i, rule := range r.Rules {
+		name := fmt.Sprintf("RATE_LIMIT_RULES[%d]", i)
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			errs = append(errs, fmt.Errorf("%s: path prefix must start with /", name))
+		}
+		if rule.RPS <= 0 || rule.RPS > maxRateLimitRPS {
+			errs = append(errs, fmt.Errorf("%s: rps must be between 1 and %d", name, maxRateLimitRPS))
+		}
+		if rule.Burst <= 0 || rule.Burst > maxRateLimitBurst {
+			errs = append(errs, fmt.Errorf("%s: burst must be between 1 and %d", name, maxRateLimitBurst))
+		}
+		if rule.Key != "" && rule.Key != "ip" && rule.Key != "user" {
+			errs = append(errs, fmt.Errorf("%s: key must be ip or user", name))
+		}
+
+		id := strings.ToUpper(rule.Method) + " " + rule.PathPrefix
+		if seen[id] {
+			errs = append(errs, fmt.Errorf("%s: duplicate rule for %s", name, strings.TrimSpace(id)))
+		}
+		seen[id] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseRateLimitRules parses comma-separated rules of the form
+// "[METHOD] /prefix rps burst [ip|user]", e.g. "POST /auth/login 1 5 ip"
+func parseRateLimitRules(value string) ([]RateLimitRule, error) {
+	var rules []RateLimitRule
+	for i, entry := range strings.Split(value, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var rule RateLimitRule
+		if !strings.HasPrefix(fields[0], "/") {
+			rule.Method = strings.ToUpper(fields[0])
+			fields = fields[1:]
+		}
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES: entry %d must be \"[METHOD] /prefix rps burst [ip|user]\"", i+1)
+		}
+
+		rule.PathPrefix = fields[0]
+		rps, rpsErr := strconv.Atoi(fields[1])
+		burst, burstErr := strconv.Atoi(fields[2])
+		if rpsErr != nil || burstErr != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_RULES: entry %d has an invalid rps or burst", i+1)
+		}
+		rule.RPS, rule.Burst = rps, burst
+		if len(fields) == 4 {
+			rule.Key = fields[3]
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// validateDurations rejects negative durations
+func (c *Config) validateDurations() error {
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SERVER_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout},
+		{"SERVER_SHUTDOWN_DELAY", c.Server.ShutdownDelay},
+		{"DB_CONN_MAX_LIFETIME", c.Database.Pool.ConnMaxLifetime},
+		{"DB_CONN_MAX_IDLE_TIME", c.Database.Pool.ConnMaxIdleTime},
+		{"DB_HEALTH_CHECK_PERIOD", c.Database.Pool.HealthCheckPeriod},
+		{"DB_STATS_INTERVAL", c.Database.Pool.StatsInterval},
+		{"SLOW_QUERY_THRESHOLD", c.Database.SlowQueryThreshold},
+		{"DB_HEALTH_WARN_LATENCY", c.Database.HealthWarnLatency},
+		{"DB_HEALTH_MAX_LATENCY", c.Database.HealthMaxLatency},
+		{"JWT_ACCESS_TTL", c.JWT.AccessTTL},
+		{"JWT_REFRESH_TTL", c.JWT.RefreshTTL},
+		{"CONCURRENCY_QUEUE_TIMEOUT", c.Concurrency.QueueTimeout},
+		{"LOG_SLOW_REQUEST_THRESHOLD", c.Logger.SlowRequestThreshold},
+		{"STATS_HALF_LIFE", c.Stats.HalfLife},
+		{"CONFIG_RELOAD_INTERVAL", c.ReloadInterval},
+		{"SECURITY_HSTS_MAX_AGE", c.Security.HSTSMaxAge},
+	}
+
+	var errs []error
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", d.name))
+		}
+	}
+	if c.Server.ShutdownTimeout == 0 {
+		errs = append(errs, fmt.Errorf("SERVER_SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if d, t := c.Server.ShutdownDelay, c.Server.ShutdownTimeout; t > 0 && d >= t {
+		errs = append(errs, fmt.Errorf("SERVER_SHUTDOWN_DELAY (%s) must be shorter than SERVER_SHUTDOWN_TIMEOUT (%s), otherwise no time is left to drain requests", d, t))
+	}
+	if c.JWT.AccessTTL == 0 {
+		errs = append(errs, fmt.Errorf("JWT_ACCESS_TTL must be positive"))
+	}
+	if c.JWT.RefreshTTL == 0 {
+		errs = append(errs, fmt.Errorf("JWT_REFRESH_TTL must be positive"))
+	}
+	if a, r := c.JWT.AccessTTL, c.JWT.RefreshTTL; a > 0 && r > 0 && r <= a {
+		errs = append(errs, fmt.Errorf("JWT_REFRESH_TTL (%s) must be longer than JWT_ACCESS_TTL (%s), otherwise sessions end before their access token expires", r, a))
+	}
+	if w, m := c.Database.HealthWarnLatency, c.Database.HealthMaxLatency; w > 0 && m > 0 && w > m {
+		errs = append(errs, fmt.Errorf("DB_HEALTH_WARN_LATENCY (%s) must not exceed DB_HEALTH_MAX_LATENCY (%s)", w, m))
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the pool sizing is positive and within the safety cap
+func (p DatabasePoolConfig) validate() error {
+	var errs []error
+	if p.MaxOpenConns <= 0 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS must be positive"))
+	}
+	if p.MinConns < 0 {
+		errs = append(errs, fmt.Errorf("DB_MIN_CONNS must not be negative"))
+	}
+	if p.MinConns > p.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MIN_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", p.MinConns, p.MaxOpenConns))
+	}
+	if p.MaxOpenConnsCap > 0 && p.MaxOpenConns > p.MaxOpenConnsCap {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS (%d) exceeds DB_MAX_OPEN_CONNS_CAP (%d)", p.MaxOpenConns, p.MaxOpenConnsCap))
+	}
+	return errors.Join(errs...)
+}
+
+// GetDSN returns the PostgreSQL connection string. Values are quoted so
+// passwords containing spaces, quotes or '=' are passed through unchanged.
 func (c *Config) GetDSN() string {
-	return fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		c.Database.Host,
-		c.Database.Port,
-		c.Database.User,
-		c.Database.Password,
-		c.Database.Name,
-		c.Database.SSLMode,
-	)
+	params := []struct {
+		key   string
+		value string
+	}{
+		{"host", c.Database.Host},
+		{"port", c.Database.Port},
+		{"user", c.Database.User},
+		{"password", c.Database.Password},
+		{"dbname", c.Database.Name},
+		{"sslmode", c.Database.SSLMode},
+	}
+
+	var dsn strings.Builder
+	for _, p := range params {
+		if dsn.Len() > 0 {
+			dsn.WriteByte(' ')
+		}
+		dsn.WriteString(p.key + "=" + quoteDSNValue(p.value))
+	}
+
+	// DB_OPTIONS is checked by Validate
+	options, _ := parseDSNOptions(c.Database.Options)
+	extra := mergeParams(c.Database.Params, options)
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		dsn.WriteString(" " + key + "=" + quoteDSNValue(extra[key]))
+	}
+
+	return dsn.String()
+}
+
+// dsnParamName matches connection parameter names, which libpq doesn't quote
+var dsnParamName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// validateDSNParams checks the extra connection parameter names can be
+// written into a keyword/value DSN; values are always quoted
+func validateDSNParams(params map[string]string) error {
+	var errs []error
+	for key := range params {
+		if !dsnParamName.MatchString(key) {
+			errs = append(errs, fmt.Errorf("DB_PARAMS: invalid parameter name %q", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dsnReservedParams are set from their own DB_* variables and may not be
+// overridden by DB_OPTIONS
+var dsnReservedParams = []string{"host", "port", "user", "password", "dbname", "sslmode"}
+
+// parseDSNOptions parses DB_OPTIONS, a list of keyword=value pairs
+// separated by whitespace as in a libpq connection string. Values
+// containing whitespace must be single-quoted; within values a backslash
+// escapes the next character, so \' and \\ stand for a quote and a backslash.
+func parseDSNOptions(s string) (map[string]string, error) {
+	options := make(map[string]string)
+	for i := 0; ; {
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			return options, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && !isDSNSpace(s[i]) {
+			i++
+		}
+		key := s[start:i]
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+		if i == len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("DB_OPTIONS: missing '=' after %q", key)
+		}
+		i++
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+
+		var value strings.Builder
+		quoted := i < len(s) && s[i] == '\''
+		if quoted {
+			i++
+		}
+		closed := false
+		for i < len(s) {
+			c := s[i]
+			if c == '\\' {
+				if i+1 == len(s) {
+					return nil, fmt.Errorf("DB_OPTIONS: trailing backslash in %q", key)
+				}
+				value.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+			if quoted && c == '\'' {
+				closed = true
+				i++
+				break
+			}
+			if !quoted && isDSNSpace(c) {
+				break
+			}
+			value.WriteByte(c)
+			i++
+		}
+		if quoted && !closed {
+			return nil, fmt.Errorf("DB_OPTIONS: unterminated quoted value for %q", key)
+		}
+
+		if !dsnParamName.MatchString(key) {
+			return nil, fmt.Errorf("DB_OPTIONS: invalid parameter name %q", key)
+		}
+		if slices.Contains(dsnReservedParams, key) {
+			return nil, fmt.Errorf("DB_OPTIONS: %q is set by its own DB_* variable", key)
+		}
+		options[key] = value.String()
+	}
+}
+
+// isDSNSpace reports whether c separates connection string entries
+func isDSNSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// quoteDSNValue quotes a keyword/value connection string value, escaping
+// backslashes and single quotes as libpq expects
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// parseDatabaseURL sets the components present in a postgres:// URL on db.
+// Query parameters other than sslmode are kept in db.Params.
+func parseDatabaseURL(rawURL string, db *DatabaseConfig) error {
+	// The URL is never included in errors since it usually contains a password
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("DATABASE_URL: invalid URL")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("DATABASE_URL: unsupported scheme %q (use postgres)", u.Scheme)
+	}
+
+	if u.User != nil {
+		if user := u.User.Username(); user != "" {
+			db.User = user
+		}
+		if password, ok := u.User.Password(); ok {
+			db.Password = password
+		}
+	}
+	if host := u.Hostname(); host != "" {
+		db.Host = host
+	}
+	if port := u.Port(); port != "" {
+		db.Port = port
+	}
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		db.Name = name
+	}
+
+	for key, values := range u.Query() {
+		if len(values) == 0 {
+			continue
+		}
+		value := values[len(values)-1]
+		if key == "sslmode" {
+			db.SSLMode = value
+			continue
+		}
+		if db.Params == nil {
+			db.Params = make(map[string]string)
+		}
+		db.Params[key] = value
+	}
+
+	return nil
 }
 
 // IsProduction returns true if running in production mode
@@ -119,20 +1050,48 @@ func (c *Config) IsProduction() bool {
 	return c.Env == "production"
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// BasicAuthUserIDs maps basic auth usernames to user IDs. In the environment
+// it is written as comma-separated user=id pairs.
+type BasicAuthUserIDs map[string]int
+
+// UnmarshalText parses user IDs in the environment variable format
+func (u *BasicAuthUserIDs) UnmarshalText(text []byte) error {
+	pairs, err := parseMap("BASIC_AUTH_USER_IDS", string(text))
+	if err != nil {
+		return err
+	}
+
+	ids := make(BasicAuthUserIDs, len(pairs))
+	for username, raw := range pairs {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("BASIC_AUTH_USER_IDS: invalid user ID %q for %q", raw, username)
+		}
+		ids[username] = id
 	}
-	return defaultValue
+	*u = ids
+	return nil
 }
 
-// getEnvAsInt gets an environment variable as integer or returns a default value
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
+// parseBasicAuthUsers parses a comma-separated list of user:bcrypt-hash pairs
+func parseBasicAuthUsers(value string) (map[string]string, error) {
+	users := make(map[string]string)
+	if value == "" {
+		return users, nil
+	}
+
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(entry, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("BASIC_AUTH_USERS: invalid entry at position %d (expected user:bcrypt-hash)", i+1)
 		}
+		users[username] = hash
 	}
-	return defaultValue
+
+	return users, nil
 }
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// troublesomeValues covers the character classes that break naive
+// keyword/value connection strings
+var troublesomeValues = map[string]string{
+	"space":          "pass word",
+	"leading space":  " password",
+	"trailing space": "password ",
+	"tab":            "pass\tword",
+	"newline":        "pass\nword",
+	"single quote":   "pa'ss'word",
+	"double quote":   `pa"ss"word`,
+	"backslash":      `pa\ss\\word`,
+	"backslash end":  `password\`,
+	"quote escape":   `pa\'ss`,
+	"equals":         "pass=word",
+	"comma":          "pass,word",
+	"url chars":      "p@ss:w/rd?x=1&y#z%20",
+	"shell chars":    "$(whoami);`id`|&<>*",
+	"unicode":        "pässwörd✓",
+	"empty":          "",
+}
+
+func testDatabaseConfig() *Config {
+	return &Config{Database: DatabaseConfig{
+		Host:    "db.internal",
+		Port:    "5432",
+		User:    "app",
+		Name:    "appdb",
+		SSLMode: "disable",
+	}}
+}
+
+func TestGetDSNQuotesValues(t *testing.T) {
+	for name, value := range troublesomeValues {
+		t.Run(name, func(t *testing.T) {
+			cfg := testDatabaseConfig()
+			cfg.Database.Password = value
+			cfg.Database.User = value + "user"
+			cfg.Database.Params = map[string]string{"application_name": value}
+
+			parsed, err := pgconn.ParseConfig(cfg.GetDSN())
+			if err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+			if parsed.Password != value {
+				t.Errorf("password = %q, want %q", parsed.Password, value)
+			}
+			if parsed.User != value+"user" {
+				t.Errorf("user = %q, want %q", parsed.User, value+"user")
+			}
+			if got := parsed.RuntimeParams["application_name"]; got != value {
+				t.Errorf("application_name = %q, want %q", got, value)
+			}
+			if parsed.Host != "db.internal" || parsed.Database != "appdb" {
+				t.Errorf("host/dbname = %q/%q, value leaked into other fields", parsed.Host, parsed.Database)
+			}
+		})
+	}
+}
+
+func TestGetDSNOptionsOverrideParams(t *testing.T) {
+	cfg := testDatabaseConfig()
+	cfg.Database.Password = "secret"
+	cfg.Database.Params = map[string]string{"application_name": "from-params", "search_path": "public"}
+	cfg.Database.Options = `application_name='from options' search_path=app,public`
+
+	parsed, err := pgconn.ParseConfig(cfg.GetDSN())
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := map[string]string{"application_name": "from options", "search_path": "app,public"}
+	for key, value := range want {
+		if got := parsed.RuntimeParams[key]; got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestParseDSNOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"whitespace only", " \t\n ", map[string]string{}},
+		{"single", "connect_timeout=5", map[string]string{"connect_timeout": "5"}},
+		{"several", "a=1 b=2\tc=3\nd=4", map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}},
+		{"spaces around equals", "a = 1  b= 2", map[string]string{"a": "1", "b": "2"}},
+		{"quoted spaces", "options='-c geqo=off -c jit=off'", map[string]string{"options": "-c geqo=off -c jit=off"}},
+		{"comma", "search_path=app,public", map[string]string{"search_path": "app,public"}},
+		{"escaped quote", `application_name='o\'brien'`, map[string]string{"application_name": "o'brien"}},
+		{"escaped backslash", `application_name='a\\b'`, map[string]string{"application_name": `a\b`}},
+		{"unquoted escape", `application_name=a\ b`, map[string]string{"application_name": "a b"}},
+		{"empty quoted", "application_name=''", map[string]string{"application_name": ""}},
+		{"empty unquoted", "application_name= b=1", map[string]string{"application_name": "b=1"}},
+		{"equals in value", "options=-cgeqo=off", map[string]string{"options": "-cgeqo=off"}},
+		{"unicode", "application_name='prüfung ✓'", map[string]string{"application_name": "prüfung ✓"}},
+		{"last wins", "a=1 a=2", map[string]string{"a": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDSNOptions(tt.input)
+			if err != nil {
+				t.Fatalf("parseDSNOptions(%q): %v", tt.input, err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseDSNOptions(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDSNOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"missing equals", "connect_timeout", "missing '='"},
+		{"missing equals before next", "a b=1", "missing '='"},
+		{"empty name", "=1", "invalid parameter name"},
+		{"invalid name", "Bad-Name=1", "invalid parameter name"},
+		{"unterminated quote", "options='-c geqo=off", "unterminated"},
+		{"trailing backslash", `a=b\`, "trailing backslash"},
+		{"reserved password", "password=x", "own DB_* variable"},
+		{"reserved host", "host=evil", "own DB_* variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDSNOptions(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseDSNOptions(%q) error = %v, want containing %q", tt.input, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDSNParams(t *testing.T) {
+	if err := validateDSNParams(map[string]string{"application_name": "x", "connect_timeout": "5"}); err != nil {
+		t.Errorf("valid names rejected: %v", err)
+	}
+	for _, key := range []string{"bad key", "a=b", "Upper", "1st", "a'b", ""} {
+		if err := validateDSNParams(map[string]string{key: "x"}); err == nil {
+			t.Errorf("parameter name %q accepted", key)
+		}
+	}
+}
+
+// validTestConfig returns the default configuration with the required values set
+func validTestConfig() *Config {
+	cfg := defaultConfig()
+	cfg.Database.Password = "db-password"
+	cfg.JWT.Secret = "k3J9xQ2mZ8vR4tY7wP1nL6bH5cF0dS3a"
+	return cfg
+}
+
+// problems splits a joined validation error into its sorted lines
+func problems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	lines := strings.Split(err.Error(), "\n")
+	slices.Sort(lines)
+	return lines
+}
+
+func TestValidateValidConfig(t *testing.T) {
+	if err := validTestConfig().Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Database.Password = ""
+	cfg.JWT.Secret = ""
+	cfg.Server.Port = "80a"
+	cfg.Database.Port = "70000"
+	cfg.Server.ReadTimeout = -time.Second
+	cfg.RateLimit.RPS = 50
+	cfg.RateLimit.Burst = 10
+	cfg.Database.Pool.MaxOpenConns = 10
+	cfg.Database.Pool.MinConns = 20
+	cfg.Logger.Level = "verbose"
+
+	want := []string{
+		"DB_MIN_CONNS (20) must not exceed DB_MAX_OPEN_CONNS (10)",
+		"DB_PASSWORD is required",
+		`DB_PORT must be a port number between 1 and 65535, got "70000"`,
+		"JWT_SECRET is required",
+		`LOG_LEVEL must be one of debug, info, warn, error, dpanic, panic or fatal, got "verbose"`,
+		"RATE_LIMIT_BURST (10) must not be less than RATE_LIMIT_RPS (50)",
+		`SERVER_PORT must be a port number between 1 and 65535, got "80a"`,
+		"SERVER_READ_TIMEOUT must not be negative",
+	}
+	if got := problems(cfg.Validate()); !slices.Equal(got, want) {
+		t.Errorf("Validate problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoadReportsParseAndValidationProblems(t *testing.T) {
+	// t.Setenv restores the variables that are then unset
+	for _, key := range []string{"CONFIG_FILE", "DATABASE_URL", "DB_PASSWORD", "JWT_SECRET"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	for key, value := range map[string]string{
+		"SECRETS_PROVIDER":    "env",
+		"CONFIG_STRICT":       "true",
+		"RATE_LIMIT_RPS":      "fast",
+		"SERVER_READ_TIMEOUT": "5 minutes",
+		"DB_MAX_OPEN_CONNS":   "5",
+		"DB_MIN_CONNS":        "8",
+	} {
+		t.Setenv(key, value)
+	}
+
+	want := []string{
+		"DB_MIN_CONNS (8) must not exceed DB_MAX_OPEN_CONNS (5)",
+		"DB_PASSWORD is required",
+		"JWT_SECRET is required",
+		`RATE_LIMIT_RPS: invalid integer "fast"`,
+		`SERVER_READ_TIMEOUT: invalid duration "5 minutes"`,
+	}
+	_, err := Load()
+	if got := problems(err); !slices.Equal(got, want) {
+		t.Errorf("Load problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateShutdownDelay(t *testing.T) {
+	tests := []struct {
+		delay, timeout time.Duration
+		want           []string
+	}{
+		{0, 30 * time.Second, nil},
+		{5 * time.Second, 30 * time.Second, nil},
+		{-time.Second, 30 * time.Second, []string{"SERVER_SHUTDOWN_DELAY must not be negative"}},
+		{30 * time.Second, 30 * time.Second, []string{"SERVER_SHUTDOWN_DELAY (30s) must be shorter than SERVER_SHUTDOWN_TIMEOUT (30s), otherwise no time is left to drain requests"}},
+	}
+	for _, tt := range tests {
+		cfg := validTestConfig()
+		cfg.Server.ShutdownDelay, cfg.Server.ShutdownTimeout = tt.delay, tt.timeout
+		if got := problems(cfg.Validate()); !slices.Equal(got, tt.want) {
+			t.Errorf("delay %s, timeout %s: problems %q, want %q", tt.delay, tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func TestValidateLogSampling(t *testing.T) {
+	tests := []struct {
+		initial, thereafter int
+		want                []string
+	}{
+		{0, 0, nil},
+		{100, 1, nil},
+		{100, 100, nil},
+		{100, 0, []string{"LOG_SAMPLING_THEREAFTER must be at least 1 when LOG_SAMPLING_INITIAL is set, otherwise every entry past the first 100 per second is dropped"}},
+		{100, -1, []string{"LOG_SAMPLING_THEREAFTER must not be negative"}},
+		{-1, 0, []string{"LOG_SAMPLING_INITIAL must not be negative"}},
+	}
+	for _, tt := range tests {
+		cfg := validTestConfig()
+		cfg.Logger.SamplingInitial, cfg.Logger.SamplingThereafter = tt.initial, tt.thereafter
+		if got := problems(cfg.Validate()); !slices.Equal(got, tt.want) {
+			t.Errorf("initial %d, thereafter %d: problems %q, want %q", tt.initial, tt.thereafter, got, tt.want)
+		}
+	}
+}
+
+func TestValidateStats(t *testing.T) {
+	tests := []struct {
+		enabled    bool
+		maxClients int
+		halfLife   time.Duration
+		want       []string
+	}{
+		{true, 1000, 5 * time.Minute, nil},
+		{true, 0, 0, []string{"STATS_HALF_LIFE must be positive", "STATS_MAX_CLIENTS must be positive"}},
+		{true, -1, -time.Minute, []string{"STATS_HALF_LIFE must not be negative", "STATS_MAX_CLIENTS must be positive"}},
+		{false, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		cfg := validTestConfig()
+		cfg.Stats.Enabled, cfg.Stats.MaxClients, cfg.Stats.HalfLife = tt.enabled, tt.maxClients, tt.halfLife
+		if got := problems(cfg.Validate()); !slices.Equal(got, tt.want) {
+			t.Errorf("enabled %v, max clients %d, half-life %s: problems %q, want %q", tt.enabled, tt.maxClients, tt.halfLife, got, tt.want)
+		}
+	}
+}
+
+func TestBasicAuthUserIDs(t *testing.T) {
+	var ids BasicAuthUserIDs
+	if err := ids.UnmarshalText([]byte("ops=42, alice = 7")); err != nil {
+		t.Fatalf("UnmarshalText: %v", err)
+	}
+	if want := (BasicAuthUserIDs{"ops": 42, "alice": 7}); !maps.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+	if err := ids.UnmarshalText([]byte("ops=admin@example.com")); err == nil {
+		t.Error("UnmarshalText accepted a non-numeric user ID")
+	}
+
+	cfg := validTestConfig()
+	cfg.BasicAuth.Users = BasicAuthUsers{"ops": "$2a$10$hash"}
+	cfg.BasicAuth.UserIDs = BasicAuthUserIDs{"ops": 0, "bob": 3}
+	want := []string{
+		`BASIC_AUTH_USER_IDS: "bob" is not in BASIC_AUTH_USERS`,
+		`BASIC_AUTH_USER_IDS: user ID of "ops" must be positive`,
+	}
+	if got := problems(cfg.Validate()); !slices.Equal(got, want) {
+		t.Errorf("problems %q, want %q", got, want)
+	}
+}
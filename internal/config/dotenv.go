@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go-starter/internal/logger"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+var (
+	dotenvMu sync.Mutex
+	// dotenvKeys records variables set from .env files, which later loads may replace
+	dotenvKeys = make(map[string]bool)
+)
+
+// LoadDotenv loads .env, then .env.<ENV>, then .env.local from the working
+// directory, with later files overriding earlier ones. Variables from the real
+// environment always win. Nothing is loaded when ENV=production unless
+// CONFIG_ALLOW_DOTENV=true. It returns the files that were loaded.
+func LoadDotenv() ([]string, error) {
+	dotenvMu.Lock()
+	defer dotenvMu.Unlock()
+
+	base, err := readDotenv(".env")
+	if err != nil {
+		return nil, err
+	}
+
+	env := os.Getenv("ENV")
+	if env == "" || dotenvKeys["ENV"] {
+		env = base["ENV"]
+	}
+	if env == "" {
+		env = "development"
+	}
+
+	if env == "production" {
+		allow, err := getEnvAsBool("CONFIG_ALLOW_DOTENV", false)
+		if err != nil {
+			return nil, err
+		}
+		if !allow {
+			return nil, nil
+		}
+	}
+
+	var (
+		loaded []string
+		values = make(map[string]string)
+	)
+	for _, name := range []string{".env", ".env." + env, ".env.local"} {
+		fileValues, err := readDotenv(name)
+		if err != nil {
+			return nil, err
+		}
+		if fileValues == nil {
+			continue
+		}
+		for k, v := range fileValues {
+			values[k] = v
+		}
+		loaded = append(loaded, name)
+	}
+
+	for k, v := range values {
+		if _, set := os.LookupEnv(k); set && !dotenvKeys[k] {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return nil, fmt.Errorf("failed to set %s from dotenv: %w", k, err)
+		}
+		dotenvKeys[k] = true
+	}
+
+	if len(loaded) > 0 {
+		logger.Info("loaded dotenv files", zap.Strings("files", loaded))
+	}
+	return loaded, nil
+}
+
+// readDotenv parses a dotenv file, returning nil if it doesn't exist
+func readDotenv(name string) (map[string]string, error) {
+	values, err := godotenv.Read(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Config fields are populated from the environment using struct tags:
+//
+//	env:"NAME"       variable read for the field, appended to the enclosing prefixes
+//	envPrefix:"P_"   on a struct field, prefixes the variables of its fields
+//	default:"value"  value used when neither the config file nor the environment sets one
+//	required:"true"  the field must be non-empty once loaded
+//	secret:"true"    the value is resolved through the SecretProvider (and NAME_FILE)
+//
+// Supported field types are string, int, bool, time.Duration, []string
+// (comma-separated), map[string]string (comma-separated key=value pairs merged
+// over the current entries) and types implementing encoding.TextUnmarshaler.
+// Unset or empty variables keep the current value.
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// envLoader overlays environment variables onto a config struct, collecting
+// every problem instead of stopping at the first
+type envLoader struct {
+	provider SecretProvider
+	// strict reports malformed ints, bools and maps instead of keeping the
+	// current value with a warning. Malformed durations, custom types and
+	// unreadable secrets are always reported.
+	strict bool
+	errs   []error
+}
+
+// fail records err, or only logs it when lenient is set outside strict mode
+func (l *envLoader) fail(err error, lenient bool) {
+	if lenient && !l.strict {
+		logger.Warn("invalid configuration value, using default", zap.Error(err))
+		return
+	}
+	l.errs = append(l.errs, err)
+}
+
+// secret resolves key through the secret provider
+func (l *envLoader) secret(key string) string {
+	value, err := resolveSecret(l.provider, key, "")
+	if err != nil {
+		l.fail(err, false)
+	}
+	return value
+}
+
+// load sets the tagged fields of the struct v from the environment
+func (l *envLoader) load(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				l.load(value, prefix+field.Tag.Get("envPrefix"))
+			}
+			continue
+		}
+		key := prefix + name
+
+		var raw string
+		if field.Tag.Get("secret") == "true" {
+			raw = l.secret(key)
+		} else {
+			raw = os.Getenv(key)
+		}
+
+		if raw != "" {
+			if err := setField(value, key, raw); err != nil {
+				l.fail(err, isLenient(field.Type))
+			}
+		}
+
+		// A required variable that is set but empty is most likely a
+		// deployment mistake, unless the value was provided another way
+		if field.Tag.Get("required") == "true" && value.IsZero() {
+			if env, ok := os.LookupEnv(key); ok && env == "" {
+				l.fail(fmt.Errorf("%s is set but empty", key), true)
+			}
+		}
+	}
+}
+
+// isLenient reports whether malformed values of type t only warn outside strict mode
+func isLenient(t reflect.Type) bool {
+	if t == durationType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Bool, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// setField parses raw into the field v, leaving v unchanged on error
+func setField(v reflect.Value, key, raw string) error {
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		// Unmarshal into a fresh value so a failure keeps the current one
+		fresh := reflect.New(v.Type())
+		if err := fresh.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			return err
+		}
+		v.Set(fresh.Elem())
+		return nil
+	}
+
+	if v.Type() == durationType {
+		d, err := parseDuration(key, raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := parseInt(key, raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := parseBool(key, raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported field type %s", key, v.Type())
+		}
+		v.Set(reflect.ValueOf(parseSlice(raw)).Convert(v.Type()))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported field type %s", key, v.Type())
+		}
+		m, err := parseMap(key, raw)
+		if err != nil {
+			return err
+		}
+		current := v.Convert(reflect.TypeOf(map[string]string(nil))).Interface().(map[string]string)
+		v.Set(reflect.ValueOf(mergeParams(current, m)).Convert(v.Type()))
+	default:
+		return fmt.Errorf("%s: unsupported field type %s", key, v.Type())
+	}
+	return nil
+}
+
+// setDefaults sets the fields of the struct v from their default tags
+func setDefaults(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("env") == "" {
+			setDefaults(v.Field(i))
+			continue
+		}
+
+		def, ok := field.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		// Defaults are part of the source, so a malformed one is a programming error
+		if err := setField(v.Field(i), t.Name()+"."+field.Name, def); err != nil {
+			panic(fmt.Sprintf("config: invalid default: %v", err))
+		}
+	}
+}
+
+// missingRequired returns an error for every required field of the struct v
+// that is empty
+func missingRequired(v reflect.Value, prefix string) []error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				errs = append(errs, missingRequired(v.Field(i), prefix+field.Tag.Get("envPrefix"))...)
+			}
+			continue
+		}
+
+		if field.Tag.Get("required") == "true" && v.Field(i).IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", prefix+name))
+		}
+	}
+	return errs
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsBool gets an environment variable as boolean or returns a default value.
+// The default is also returned, with an error, when the value can't be parsed.
+func getEnvAsBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := parseBool(key, value)
+	if err != nil {
+		return defaultValue, err
+	}
+	return b, nil
+}
+
+// getEnvSecret gets a sensitive value from the file named by <key>_FILE, falling
+// back to the plain environment variable and then the default value. Mounted
+// secret files are trimmed of trailing newlines. It is an error if the file is
+// unreadable or both variables are set to different values.
+func getEnvSecret(key, defaultValue string) (string, error) {
+	plain := os.Getenv(key)
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		if plain != "" {
+			return plain, nil
+		}
+		return defaultValue, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: failed to read secret: %w", key, err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+
+	if plain != "" && plain != value {
+		return "", fmt.Errorf("%s and %s_FILE are both set to different values", key, key)
+	}
+	return value, nil
+}
+
+// parseInt parses an integer value of key
+func parseInt(key, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid integer %q", key, value)
+	}
+	return n, nil
+}
+
+// parseBool parses a boolean value of key. 1/0, true/false and yes/no are
+// accepted in any case.
+func parseBool(key, value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: invalid boolean %q (use true/false, yes/no or 1/0)", key, value)
+}
+
+// parseDuration parses a duration value of key
+func parseDuration(key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, value)
+	}
+	return d, nil
+}
+
+// parseSlice splits a comma-separated list, trimming items and skipping empty ones
+func parseSlice(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseMap parses a comma-separated list of key=value pairs. Keys and values
+// are trimmed and empty entries are skipped. It is an error if an entry has
+// no key or no '='.
+func parseMap(key, value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(entry, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s: entry %d must be key=value", key, i+1)
+		}
+		result[k] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
+
+// mergeParams returns base with the entries of override added or replaced
+func mergeParams(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
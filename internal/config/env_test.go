@@ -0,0 +1,370 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBool(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"1", true}, {"true", true}, {"TRUE", true}, {"Yes", true}, {" yes ", true},
+		{"0", false}, {"false", false}, {"False", false}, {"NO", false},
+	}
+	for _, tt := range tests {
+		got, err := parseBool("FLAG", tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBool(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "on", "off", "y", "2", "truee"} {
+		if _, err := parseBool("FLAG", value); err == nil {
+			t.Errorf("parseBool(%q) accepted", value)
+		}
+	}
+}
+
+func TestGetEnvAsBool(t *testing.T) {
+	t.Setenv("TEST_FLAG", "")
+	os.Unsetenv("TEST_FLAG")
+	if got, err := getEnvAsBool("TEST_FLAG", true); err != nil || !got {
+		t.Errorf("unset: getEnvAsBool = %v, %v, want the default", got, err)
+	}
+
+	t.Setenv("TEST_FLAG", "no")
+	if got, err := getEnvAsBool("TEST_FLAG", true); err != nil || got {
+		t.Errorf("no: getEnvAsBool = %v, %v, want false", got, err)
+	}
+
+	t.Setenv("TEST_FLAG", "maybe")
+	if got, err := getEnvAsBool("TEST_FLAG", true); err == nil || !got {
+		t.Errorf("maybe: getEnvAsBool = %v, %v, want the default and an error", got, err)
+	}
+}
+
+func TestParseSlice(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"a", []string{"a"}},
+		{" https://a.example , ,https://b.example,", []string{"https://a.example", "https://b.example"}},
+	}
+	for _, tt := range tests {
+		if got := parseSlice(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseSlice(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMergeParams(t *testing.T) {
+	base := map[string]string{"a": "1", "b": "2"}
+	got := mergeParams(base, map[string]string{"b": "3", "c": "4"})
+	if want := map[string]string{"a": "1", "b": "3", "c": "4"}; !maps.Equal(got, want) {
+		t.Errorf("mergeParams = %v, want %v", got, want)
+	}
+	if want := map[string]string{"a": "1", "b": "2"}; !maps.Equal(base, want) {
+		t.Errorf("mergeParams modified base: %v", base)
+	}
+}
+
+// envTestConfig holds one field of each kind the env helpers parse
+type envTestConfig struct {
+	Origins []string          `env:"ORIGINS"`
+	Params  map[string]string `env:"PARAMS"`
+	Enabled bool              `env:"ENABLED" default:"true"`
+	Count   int               `env:"COUNT" default:"3"`
+}
+
+func TestEnvLoaderHelpers(t *testing.T) {
+	t.Setenv("TEST_ORIGINS", "https://a.example, https://b.example,")
+	t.Setenv("TEST_PARAMS", "search_path=app, application_name = api")
+	t.Setenv("TEST_ENABLED", "No")
+	t.Setenv("TEST_COUNT", "7")
+
+	cfg := envTestConfig{Params: map[string]string{"application_name": "base", "connect_timeout": "5"}}
+	setDefaults(reflect.ValueOf(&cfg).Elem())
+	env := &envLoader{provider: EnvProvider{}, strict: true}
+	env.load(reflect.ValueOf(&cfg).Elem(), "TEST_")
+	if len(env.errs) > 0 {
+		t.Fatalf("load: %v", errors.Join(env.errs...))
+	}
+
+	want := envTestConfig{
+		Origins: []string{"https://a.example", "https://b.example"},
+		Params:  map[string]string{"application_name": "api", "connect_timeout": "5", "search_path": "app"},
+		Enabled: false,
+		Count:   7,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("loaded %+v, want %+v", cfg, want)
+	}
+}
+
+func TestEnvLoaderStrictMode(t *testing.T) {
+	t.Setenv("TEST_ORIGINS", "")
+	t.Setenv("TEST_PARAMS", "broken")
+	t.Setenv("TEST_ENABLED", "sometimes")
+	t.Setenv("TEST_COUNT", "many")
+
+	for _, strict := range []bool{false, true} {
+		var cfg envTestConfig
+		setDefaults(reflect.ValueOf(&cfg).Elem())
+		env := &envLoader{provider: EnvProvider{}, strict: strict}
+		env.load(reflect.ValueOf(&cfg).Elem(), "TEST_")
+
+		// Malformed values always keep the current value
+		if !cfg.Enabled || cfg.Count != 3 || cfg.Params != nil {
+			t.Errorf("strict=%v: loaded %+v, want the defaults", strict, cfg)
+		}
+		// and are only reported in strict mode
+		wantErrs := 0
+		if strict {
+			wantErrs = 3
+		}
+		if len(env.errs) != wantErrs {
+			t.Errorf("strict=%v: %d errors (%v), want %d", strict, len(env.errs), env.errs, wantErrs)
+		}
+	}
+}
+
+func TestParseMap(t *testing.T) {
+	got, err := parseMap("DB_PARAMS", " a = 1 ,, b=2=3 ,c=")
+	if err != nil {
+		t.Fatalf("parseMap: %v", err)
+	}
+	want := map[string]string{"a": "1", "b": "2=3", "c": ""}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseMap = %v, want %v", got, want)
+	}
+}
+
+func TestParseMapRejectsEntriesWithoutKey(t *testing.T) {
+	for _, value := range []string{"a=1,b", "flag", "=1", "a=1, =2"} {
+		if got, err := parseMap("FEATURE_FLAGS", value); err == nil {
+			t.Errorf("parseMap(%q) = %v, want error", value, got)
+		}
+	}
+}
+
+// loaderTestConfig has a field of every supported kind, nested under prefixes
+type loaderTestConfig struct {
+	Name     string         `env:"NAME" default:"app"`
+	Port     int            `env:"PORT" default:"8080"`
+	Debug    bool           `env:"DEBUG"`
+	Timeout  time.Duration  `env:"TIMEOUT" default:"5s"`
+	Hosts    []string       `env:"HOSTS" default:"a,b"`
+	Rules    RateLimitRules `env:"RULES"`
+	Password string         `env:"PASSWORD" required:"true" secret:"true"`
+	Nested   struct {
+		Level string `env:"LEVEL" default:"info"`
+		Inner struct {
+			Value string `env:"VALUE" required:"true"`
+		} `envPrefix:"INNER_"`
+	} `envPrefix:"NESTED_"`
+}
+
+// loadTest applies defaults and then the LT_ environment variables
+func loadTest(t *testing.T, strict bool) (loaderTestConfig, []error) {
+	t.Helper()
+	var cfg loaderTestConfig
+	setDefaults(reflect.ValueOf(&cfg).Elem())
+	env := &envLoader{provider: EnvProvider{}, strict: strict}
+	env.load(reflect.ValueOf(&cfg).Elem(), "LT_")
+	return cfg, env.errs
+}
+
+func TestSetDefaults(t *testing.T) {
+	cfg, _ := loadTest(t, true)
+	if cfg.Name != "app" || cfg.Port != 8080 || cfg.Debug || cfg.Timeout != 5*time.Second ||
+		!slices.Equal(cfg.Hosts, []string{"a", "b"}) || cfg.Rules != nil || cfg.Nested.Level != "info" {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	// Every default in Config parses; setDefaults panics otherwise
+	defaultConfig()
+}
+
+func TestEnvLoaderFieldTypes(t *testing.T) {
+	for key, value := range map[string]string{
+		"LT_NAME":               "api",
+		"LT_PORT":               "9090",
+		"LT_DEBUG":              "true",
+		"LT_TIMEOUT":            "1m30s",
+		"LT_HOSTS":              "x, y",
+		"LT_RULES":              "POST /auth 5 10 ip",
+		"LT_PASSWORD":           "s3cret",
+		"LT_NESTED_LEVEL":       "debug",
+		"LT_NESTED_INNER_VALUE": "deep",
+	} {
+		t.Setenv(key, value)
+	}
+
+	cfg, errs := loadTest(t, true)
+	if len(errs) > 0 {
+		t.Fatalf("load: %v", errors.Join(errs...))
+	}
+
+	rules, err := parseRateLimitRules("POST /auth 5 10 ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want loaderTestConfig
+	want.Name = "api"
+	want.Port = 9090
+	want.Debug = true
+	want.Timeout = 90 * time.Second
+	want.Hosts = []string{"x", "y"}
+	want.Rules = rules
+	want.Password = "s3cret"
+	want.Nested.Level = "debug"
+	want.Nested.Inner.Value = "deep"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("loaded %+v, want %+v", cfg, want)
+	}
+}
+
+func TestEnvLoaderEmptyKeepsCurrent(t *testing.T) {
+	for _, key := range []string{"LT_NAME", "LT_PORT", "LT_TIMEOUT", "LT_HOSTS"} {
+		t.Setenv(key, "")
+	}
+	cfg, _ := loadTest(t, true)
+	if cfg.Name != "app" || cfg.Port != 8080 || cfg.Timeout != 5*time.Second || !slices.Equal(cfg.Hosts, []string{"a", "b"}) {
+		t.Errorf("empty variables changed the defaults: %+v", cfg)
+	}
+}
+
+func TestEnvLoaderSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LT_PASSWORD_FILE", path)
+
+	cfg, _ := loadTest(t, true)
+	if cfg.Password != "from-file" {
+		t.Errorf("Password = %q, want from-file", cfg.Password)
+	}
+
+	// Only secret fields read *_FILE
+	t.Setenv("LT_NAME_FILE", path)
+	if cfg, _ := loadTest(t, true); cfg.Name != "app" {
+		t.Errorf("Name = %q, want the default", cfg.Name)
+	}
+
+	t.Setenv("LT_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, errs := loadTest(t, false); len(errs) != 1 {
+		t.Errorf("unreadable secret file: errors = %v, want one", errs)
+	}
+}
+
+func TestEnvLoaderReportsEveryProblem(t *testing.T) {
+	for key, value := range map[string]string{
+		"LT_PORT":     "http",
+		"LT_DEBUG":    "sometimes",
+		"LT_TIMEOUT":  "5",
+		"LT_RULES":    "/auth fast 10",
+		"LT_PASSWORD": "",
+	} {
+		t.Setenv(key, value)
+	}
+
+	// Durations and custom types are always reported; the rest only in strict mode
+	tests := []struct {
+		strict bool
+		want   []string
+	}{
+		// RateLimitRules names its real variable whatever field it is loaded into
+		{false, []string{"LT_TIMEOUT", "RATE_LIMIT_RULES: entry 1"}},
+		{true, []string{"LT_PORT", "LT_DEBUG", "LT_TIMEOUT", "RATE_LIMIT_RULES: entry 1", "LT_PASSWORD is set but empty"}},
+	}
+	for _, tt := range tests {
+		_, errs := loadTest(t, tt.strict)
+		if len(errs) != len(tt.want) {
+			t.Errorf("strict=%v: errors = %v, want %d", tt.strict, errs, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.HasPrefix(errs[i].Error(), want) {
+				t.Errorf("strict=%v: error %d = %v, want prefix %q", tt.strict, i, errs[i], want)
+			}
+		}
+	}
+}
+
+func TestMissingRequired(t *testing.T) {
+	var cfg loaderTestConfig
+	var got []string
+	for _, err := range missingRequired(reflect.ValueOf(&cfg).Elem(), "LT_") {
+		got = append(got, err.Error())
+	}
+	want := []string{"LT_PASSWORD is required", "LT_NESTED_INNER_VALUE is required"}
+	if !slices.Equal(got, want) {
+		t.Errorf("missingRequired = %q, want %q", got, want)
+	}
+}
+
+// envNames returns the variable names of the tagged fields of typ
+func envNames(typ reflect.Type, prefix string) []string {
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				names = append(names, envNames(field.Type, prefix+field.Tag.Get("envPrefix"))...)
+			}
+			continue
+		}
+		names = append(names, prefix+name)
+	}
+	return names
+}
+
+// TestConfigVariableNames guards the variable names deployments already set
+func TestConfigVariableNames(t *testing.T) {
+	names := envNames(reflect.TypeOf(Config{}), "")
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("%s is read by more than one field", name)
+		}
+		seen[name] = true
+	}
+
+	for _, name := range []string{
+		"AUDIT_LOG_PATH", "AUDIT_SINK", "BASIC_AUTH_USER_IDS", "BASIC_AUTH_USERS", "CONCURRENCY_MAX_IN_FLIGHT",
+		"CONCURRENCY_QUEUE_TIMEOUT", "CONFIG_RELOAD_INTERVAL", "CORS_ALLOWED_ORIGINS",
+		"DB_CONN_MAX_IDLE_TIME", "DB_CONN_MAX_LIFETIME", "DB_HEALTH_MAX_LATENCY",
+		"DB_HEALTH_WARN_LATENCY", "DB_HOST", "DB_MAX_OPEN_CONNS", "DB_MAX_OPEN_CONNS_CAP",
+		"DB_NAME", "DB_PARAMS", "DB_PASSWORD", "DB_PORT", "DB_REPLICA_DSNS", "DB_SSLMODE",
+		"DB_USER", "DEFAULT_LOCALE", "ENV", "HTTP_REAL_IP_HEADERS", "HTTP_REDIRECT_PORT",
+		"JWT_ACCESS_TTL", "JWT_SECRET", "LOG_FORMAT", "LOG_LEVEL", "LOG_SAMPLING_INITIAL",
+		"LOG_SAMPLING_THEREAFTER", "LOG_SLOW_REQUEST_THRESHOLD",
+		"RATE_LIMIT_ALLOW_BYPASS_IN_PRODUCTION", "RATE_LIMIT_BURST", "RATE_LIMIT_BYPASS_TOKENS",
+		"RATE_LIMIT_RPS", "RATE_LIMIT_RULES", "SECURITY_CSP", "SECURITY_FRAME_OPTIONS",
+		"SECURITY_HSTS_MAX_AGE", "SECURITY_REFERRER_POLICY", "SERVER_IDLE_TIMEOUT", "SERVER_PORT",
+		"SERVER_PROXY_PROTOCOL", "SERVER_READ_TIMEOUT", "SERVER_SHUTDOWN_DELAY", "SERVER_SHUTDOWN_TIMEOUT",
+		"SERVER_WRITE_TIMEOUT", "SLOW_QUERY_THRESHOLD", "STATS_ENABLED", "STATS_HALF_LIFE",
+		"STATS_MAX_CLIENTS", "SUPPORTED_LOCALES", "SWAGGER_BASE_PATH", "SWAGGER_HOST",
+		"TLS_CERT_FILE", "TLS_CLIENT_CA_FILE", "TLS_KEY_FILE", "UA_ALLOW_PATTERNS",
+		"UA_DENY_PATTERNS", "UA_REJECT_EMPTY_PATHS", "UA_RULES_FILE",
+	} {
+		if !seen[name] {
+			t.Errorf("%s is no longer read", name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile reads a YAML or JSON config file onto cfg. Fields missing from
+// the file keep their current values. JSON is parsed with the YAML decoder,
+// since JSON documents are valid YAML.
+func loadFile(path string, cfg *Config) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("CONFIG_FILE: unsupported extension %q (use .yaml, .yml or .json)", ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: failed to read %s: %w", path, err)
+	}
+
+	// Reject keys that don't map to a config field, listing all of them
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("CONFIG_FILE: failed to parse %s: %w", path, err)
+	}
+	if unknown := unknownKeys(raw, reflect.TypeOf(Config{}), ""); len(unknown) > 0 {
+		return fmt.Errorf("CONFIG_FILE: unknown keys in %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("CONFIG_FILE: failed to decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// unknownKeys returns the dotted paths of keys in raw with no matching yaml tag in t
+func unknownKeys(raw map[string]interface{}, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+
+	var unknown []string
+	for key, value := range raw {
+		fieldType, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+
+		nested, isMap := value.(map[string]interface{})
+		if isMap && fieldType.Kind() == reflect.Struct {
+			unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+		}
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Redacted returns the configuration as a map keyed by the YAML field names,
+// with every field tagged `redact:"true"` masked. It is safe to log.
+func (c *Config) Redacted() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(c).Elem())
+}
+
+// redactStruct converts a struct to a map, masking tagged fields
+func redactStruct(v reflect.Value) map[string]interface{} {
+	result := make(map[string]interface{}, v.NumField())
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+
+		value := v.Field(i)
+		switch {
+		case field.Tag.Get("redact") == "true":
+			result[name] = redactValue(value)
+		case value.Kind() == reflect.Struct:
+			result[name] = redactStruct(value)
+		case value.Type() == reflect.TypeOf(time.Duration(0)):
+			result[name] = time.Duration(value.Int()).String()
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+			items := make([]interface{}, value.Len())
+			for j := range items {
+				items[j] = redactStruct(value.Index(j))
+			}
+			result[name] = items
+		default:
+			result[name] = value.Interface()
+		}
+	}
+
+	return result
+}
+
+// redactValue masks a string, or each string in a slice or map values
+func redactValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		return maskSecret(v.String())
+	case reflect.Slice:
+		masked := make([]string, v.Len())
+		for i := range masked {
+			masked[i] = maskSecret(fmt.Sprint(v.Index(i).Interface()))
+		}
+		return masked
+	case reflect.Map:
+		masked := make(map[string]string, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			masked[fmt.Sprint(iter.Key().Interface())] = maskSecret(fmt.Sprint(iter.Value().Interface()))
+		}
+		return masked
+	default:
+		return "[redacted]"
+	}
+}
+
+// maskSecret hides a secret, keeping only its length and, for longer values,
+// the last two characters to help tell secrets apart
+func maskSecret(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case len(s) < 8:
+		return fmt.Sprintf("[redacted len=%d]", len(s))
+	default:
+		return fmt.Sprintf("[redacted len=%d ...%s]", len(s), s[len(s)-2:])
+	}
+}
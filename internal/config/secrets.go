@@ -0,0 +1,332 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// ErrSecretNotFound is returned by a SecretProvider that has no value for a key
+var ErrSecretNotFound = errors.New("secret not found")
+
+const (
+	secretTimeout    = 5 * time.Second
+	secretRetries    = 3
+	secretRetryDelay = 200 * time.Millisecond
+
+	defaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// SecretProvider resolves sensitive configuration values such as DB_PASSWORD.
+// Values returned by a provider must never be logged.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, key string) (string, error)
+}
+
+// newSecretProvider creates the provider selected by SECRETS_PROVIDER
+func newSecretProvider() (SecretProvider, error) {
+	switch name := getEnv("SECRETS_PROVIDER", "env"); name {
+	case "env":
+		return EnvProvider{}, nil
+	case "file":
+		return FileProvider{Dir: getEnv("SECRETS_DIR", "/run/secrets")}, nil
+	case "vault":
+		return &VaultProvider{
+			Addr:      getEnv("VAULT_ADDR", "http://127.0.0.1:8200"),
+			Token:     os.Getenv("VAULT_TOKEN"),
+			Path:      os.Getenv("VAULT_SECRET_PATH"),
+			K8sRole:   os.Getenv("VAULT_K8S_ROLE"),
+			K8sMount:  getEnv("VAULT_K8S_MOUNT", "kubernetes"),
+			TokenPath: getEnv("VAULT_K8S_TOKEN_PATH", defaultK8sTokenPath),
+		}, nil
+	case "aws":
+		return &AWSSecretsManagerProvider{SecretID: os.Getenv("AWS_SECRET_ID")}, nil
+	default:
+		return nil, fmt.Errorf("SECRETS_PROVIDER: unsupported provider %q (use env, file, vault or aws)", name)
+	}
+}
+
+// resolveSecret gets key from provider with a per-attempt timeout and retries.
+// Keys the provider doesn't have fall back to the environment.
+func resolveSecret(provider SecretProvider, key, defaultValue string) (string, error) {
+	if _, ok := provider.(EnvProvider); ok {
+		return getEnvSecret(key, defaultValue)
+	}
+
+	var err error
+	for attempt := 0; attempt < secretRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(secretRetryDelay << (attempt - 1))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		var value string
+		value, err = provider.GetSecret(ctx, key)
+		cancel()
+
+		switch {
+		case err == nil:
+			return value, nil
+		case errors.Is(err, ErrSecretNotFound):
+			return getEnvSecret(key, defaultValue)
+		}
+	}
+
+	return "", fmt.Errorf("%s: failed to resolve secret: %w", key, err)
+}
+
+// EnvProvider reads secrets from environment variables, or from the file
+// named by <key>_FILE. It is the default provider.
+type EnvProvider struct{}
+
+// GetSecret implements SecretProvider
+func (EnvProvider) GetSecret(_ context.Context, key string) (string, error) {
+	value, err := getEnvSecret(key, "")
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// FileProvider reads each secret from a file named after the key in Dir
+type FileProvider struct {
+	Dir string
+}
+
+// GetSecret implements SecretProvider
+func (p FileProvider) GetSecret(_ context.Context, key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// StaticProvider serves secrets from a map, for tests
+type StaticProvider map[string]string
+
+// GetSecret implements SecretProvider
+func (p StaticProvider) GetSecret(_ context.Context, key string) (string, error) {
+	value, ok := p[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// VaultProvider reads secrets from fields of a single Vault KV secret.
+// It authenticates with Token, or with the Kubernetes auth method when
+// K8sRole is set.
+type VaultProvider struct {
+	Addr      string
+	Token     string
+	Path      string
+	K8sRole   string
+	K8sMount  string
+	TokenPath string
+	Client    *http.Client
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// GetSecret implements SecretProvider
+func (p *VaultProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.values == nil {
+		values, err := p.fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		p.values = values
+	}
+
+	value, ok := p.values[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// fetch reads all fields of the configured secret
+func (p *VaultProvider) fetch(ctx context.Context) (map[string]string, error) {
+	if p.Path == "" {
+		return nil, errors.New("VAULT_SECRET_PATH is required")
+	}
+
+	token := p.Token
+	if p.K8sRole != "" {
+		var err error
+		if token, err = p.loginKubernetes(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN or VAULT_K8S_ROLE is required")
+	}
+
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(p.Path, "/"), token, nil, &response); err != nil {
+		return nil, err
+	}
+
+	// KV v2 nests the fields under data.data
+	fields := response.Data
+	if nested, ok := response.Data["data"]; ok {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return nil, fmt.Errorf("vault: invalid secret data: %w", err)
+		}
+	}
+
+	values := make(map[string]string, len(fields))
+	for name, raw := range fields {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// loginKubernetes exchanges the service account token for a Vault token
+func (p *VaultProvider) loginKubernetes(ctx context.Context) (string, error) {
+	jwt, err := os.ReadFile(p.TokenPath)
+	if err != nil {
+		return "", fmt.Errorf("vault: failed to read service account token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"role": p.K8sRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/auth/"+p.K8sMount+"/login", "", body, &response); err != nil {
+		return "", err
+	}
+	return response.Auth.ClientToken, nil
+}
+
+// do sends a request to the Vault API and decodes the JSON response
+func (p *VaultProvider) do(ctx context.Context, method, path, token string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = strings.NewReader(string(body))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(p.Addr, "/")+path, reader)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: %s %s returned status %d", method, path, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("vault: invalid response: %w", err)
+	}
+	return nil
+}
+
+// AWSSecretsManagerProvider reads secrets from the keys of a JSON secret in
+// AWS Secrets Manager, using the default AWS credential chain
+type AWSSecretsManagerProvider struct {
+	SecretID string
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// GetSecret implements SecretProvider
+func (p *AWSSecretsManagerProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.values == nil {
+		values, err := p.fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		p.values = values
+	}
+
+	value, ok := p.values[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// fetch reads and decodes the configured secret
+func (p *AWSSecretsManagerProvider) fetch(ctx context.Context) (map[string]string, error) {
+	if p.SecretID == "" {
+		return nil, errors.New("AWS_SECRET_ID is required")
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aws: failed to load config: %w", err)
+	}
+
+	output, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &p.SecretID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aws: failed to get secret value: %w", err)
+	}
+	if output.SecretString == nil {
+		return nil, errors.New("aws: secret has no string value")
+	}
+
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(*output.SecretString), &values); err != nil {
+		return nil, errors.New("aws: secret value must be a JSON object of strings")
+	}
+	return values, nil
+}
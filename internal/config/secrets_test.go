@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// flakyProvider fails the first failures calls, then serves from values
+type flakyProvider struct {
+	values   StaticProvider
+	failures int
+	calls    int
+}
+
+func (p *flakyProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return "", errors.New("backend unavailable")
+	}
+	return p.values.GetSecret(ctx, key)
+}
+
+func TestResolveSecretFromProvider(t *testing.T) {
+	t.Setenv("JWT_SECRET", "from-env")
+	provider := StaticProvider{"JWT_SECRET": "from-provider"}
+
+	got, err := resolveSecret(provider, "JWT_SECRET", "")
+	if err != nil {
+		t.Fatalf("resolveSecret: %v", err)
+	}
+	if got != "from-provider" {
+		t.Errorf("resolveSecret = %q, want the provider value", got)
+	}
+}
+
+func TestResolveSecretFallsBackToEnv(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "from-env")
+	provider := StaticProvider{}
+
+	got, err := resolveSecret(provider, "DB_PASSWORD", "default")
+	if err != nil {
+		t.Fatalf("resolveSecret: %v", err)
+	}
+	if got != "from-env" {
+		t.Errorf("resolveSecret = %q, want from-env", got)
+	}
+
+	got, err = resolveSecret(provider, "UNSET_SECRET", "default")
+	if err != nil {
+		t.Fatalf("resolveSecret: %v", err)
+	}
+	if got != "default" {
+		t.Errorf("resolveSecret = %q, want default", got)
+	}
+}
+
+func TestResolveSecretRetries(t *testing.T) {
+	provider := &flakyProvider{values: StaticProvider{"JWT_SECRET": "value"}, failures: secretRetries - 1}
+	got, err := resolveSecret(provider, "JWT_SECRET", "")
+	if err != nil {
+		t.Fatalf("resolveSecret: %v", err)
+	}
+	if got != "value" || provider.calls != secretRetries {
+		t.Errorf("resolveSecret = %q after %d calls, want value after %d", got, provider.calls, secretRetries)
+	}
+
+	// A provider that keeps failing is an error, not a silent fallback to the env
+	t.Setenv("JWT_SECRET", "from-env")
+	provider = &flakyProvider{failures: secretRetries}
+	if got, err := resolveSecret(provider, "JWT_SECRET", ""); err == nil {
+		t.Errorf("resolveSecret = %q, want error", got)
+	}
+	if provider.calls != secretRetries {
+		t.Errorf("calls = %d, want %d", provider.calls, secretRetries)
+	}
+}
+
+func TestEnvLoaderResolvesSecretFields(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_ACCESS_TTL", "")
+	provider := StaticProvider{
+		"JWT_SECRET":           "provider-secret",
+		"JWT_PREVIOUS_SECRETS": "old-1,old-2",
+		// Only fields tagged secret are looked up in the provider
+		"JWT_ACCESS_TTL": "1h",
+	}
+
+	cfg := defaultConfig()
+	env := &envLoader{provider: provider, strict: true}
+	env.load(reflect.ValueOf(cfg).Elem(), "")
+	if len(env.errs) > 0 {
+		t.Fatalf("load: %v", errors.Join(env.errs...))
+	}
+
+	if cfg.JWT.Secret != "provider-secret" {
+		t.Errorf("JWT.Secret = %q, want provider-secret", cfg.JWT.Secret)
+	}
+	if want := []string{"old-1", "old-2"}; !reflect.DeepEqual(cfg.JWT.PreviousSecrets, want) {
+		t.Errorf("JWT.PreviousSecrets = %v, want %v", cfg.JWT.PreviousSecrets, want)
+	}
+	if cfg.JWT.AccessTTL != defaultConfig().JWT.AccessTTL {
+		t.Errorf("JWT.AccessTTL = %v, want the default", cfg.JWT.AccessTTL)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "DB_PASSWORD"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider := FileProvider{Dir: dir}
+
+	got, err := provider.GetSecret(context.Background(), "DB_PASSWORD")
+	if err != nil || got != "s3cret" {
+		t.Errorf("GetSecret = %q, %v, want s3cret", got, err)
+	}
+	if _, err := provider.GetSecret(context.Background(), "JWT_SECRET"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret of a missing file error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestEnvProviderReadsFileVariable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_SECRET_FILE", path)
+
+	got, err := resolveSecret(EnvProvider{}, "JWT_SECRET", "")
+	if err != nil || got != "from-file" {
+		t.Errorf("resolveSecret = %q, %v, want from-file", got, err)
+	}
+
+	t.Setenv("JWT_SECRET", "different")
+	if got, err := resolveSecret(EnvProvider{}, "JWT_SECRET", ""); err == nil {
+		t.Errorf("resolveSecret = %q, want error for conflicting values", got)
+	}
+}
+
+// newVaultServer serves a KV v2 secret at /v1/secret/data/app for token,
+// and exchanges jwt for token through the Kubernetes auth method
+func newVaultServer(t *testing.T, token, jwt string) (*httptest.Server, *int) {
+	t.Helper()
+	reads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Role, JWT string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Role != "app" || body.JWT != jwt {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": token}})
+	})
+	mux.HandleFunc("GET /v1/secret/data/app", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		reads++
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data":     map[string]any{"JWT_SECRET": "vault-secret", "PORT": 8080},
+			"metadata": map[string]any{"version": 3},
+		}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &reads
+}
+
+func TestVaultProviderToken(t *testing.T) {
+	server, reads := newVaultServer(t, "root-token", "")
+	provider := &VaultProvider{Addr: server.URL, Token: "root-token", Path: "secret/data/app"}
+	ctx := context.Background()
+
+	got, err := provider.GetSecret(ctx, "JWT_SECRET")
+	if err != nil || got != "vault-secret" {
+		t.Errorf("GetSecret = %q, %v, want vault-secret", got, err)
+	}
+	// Non-string fields are ignored and count as missing
+	if _, err := provider.GetSecret(ctx, "PORT"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret(PORT) error = %v, want ErrSecretNotFound", err)
+	}
+	if *reads != 1 {
+		t.Errorf("secret read %d times, want once", *reads)
+	}
+
+	wrong := &VaultProvider{Addr: server.URL, Token: "wrong", Path: "secret/data/app"}
+	if _, err := wrong.GetSecret(ctx, "JWT_SECRET"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret with a bad token error = %v, want a failure", err)
+	}
+
+	missing := &VaultProvider{Addr: server.URL, Token: "root-token", Path: "secret/data/other"}
+	if _, err := missing.GetSecret(ctx, "JWT_SECRET"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret of a missing secret error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestVaultProviderKubernetesAuth(t *testing.T) {
+	server, _ := newVaultServer(t, "k8s-token", "service-account-jwt")
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("service-account-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider := &VaultProvider{
+		Addr:      server.URL,
+		Path:      "/secret/data/app",
+		K8sRole:   "app",
+		K8sMount:  "kubernetes",
+		TokenPath: tokenPath,
+	}
+
+	got, err := provider.GetSecret(context.Background(), "JWT_SECRET")
+	if err != nil || got != "vault-secret" {
+		t.Errorf("GetSecret = %q, %v, want vault-secret", got, err)
+	}
+}
+
+func TestNewSecretProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		want SecretProvider
+	}{
+		{"", EnvProvider{}},
+		{"env", EnvProvider{}},
+		{"file", FileProvider{Dir: "/run/secrets"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("SECRETS_PROVIDER", tt.name)
+		t.Setenv("SECRETS_DIR", "/run/secrets")
+		got, err := newSecretProvider()
+		if err != nil {
+			t.Fatalf("newSecretProvider(%q): %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newSecretProvider(%q) = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	t.Setenv("SECRETS_PROVIDER", "keychain")
+	if _, err := newSecretProvider(); err == nil {
+		t.Error("newSecretProvider accepted an unsupported provider")
+	}
+}
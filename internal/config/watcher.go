@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Subscriber is notified after every successful reload with the previous
+// and the new configuration
+type Subscriber func(old, updated *Config)
+
+// restartFields lists settings that only take effect after a restart.
+// Secret values are compared but never logged.
+var restartFields = []struct {
+	name    string
+	changed func(old, updated *Config) bool
+}{
+	{"SERVER_HOST", func(o, n *Config) bool { return o.Server.Host != n.Server.Host }},
+	{"ADMIN_PORT", func(o, n *Config) bool { return o.Server.AdminPort != n.Server.AdminPort }},
+	{"SERVER_PORT", func(o, n *Config) bool { return o.Server.Port != n.Server.Port }},
+	{"DB_DSN", func(o, n *Config) bool { return o.GetDSN() != n.GetDSN() }},
+	{"DB_REPLICA_DSNS", func(o, n *Config) bool { return !slices.Equal(o.Database.ReplicaDSNs, n.Database.ReplicaDSNs) }},
+	{"DB_AUTO_MIGRATE", func(o, n *Config) bool { return o.Database.AutoMigrate != n.Database.AutoMigrate }},
+	{"DB_SCHEMA_CHECK", func(o, n *Config) bool { return o.Database.SchemaCheck != n.Database.SchemaCheck }},
+	{"JWT_SECRET", func(o, n *Config) bool { return o.JWT.Secret != n.JWT.Secret }},
+	{"JWT_PREVIOUS_SECRETS", func(o, n *Config) bool { return !slices.Equal(o.JWT.PreviousSecrets, n.JWT.PreviousSecrets) }},
+	{"JWT_ACCESS_TTL", func(o, n *Config) bool { return o.JWT.AccessTTL != n.JWT.AccessTTL }},
+	{"JWT_REFRESH_TTL", func(o, n *Config) bool { return o.JWT.RefreshTTL != n.JWT.RefreshTTL }},
+	{"RATE_LIMIT_ENABLED", func(o, n *Config) bool { return o.RateLimit.Enabled != n.RateLimit.Enabled }},
+	{"RESPONSE_ENVELOPE", func(o, n *Config) bool { return o.Server.ResponseEnvelope != n.Server.ResponseEnvelope }},
+	{"LOGIN_THROTTLE_*", func(o, n *Config) bool { return o.LoginThrottle != n.LoginThrottle }},
+	{"VALIDATE_EMAIL_*", func(o, n *Config) bool { return o.EmailValidation != n.EmailValidation }},
+	{"IDEMPOTENCY_*", func(o, n *Config) bool { return o.Idempotency != n.Idempotency }},
+	{"LOG_FORMAT", func(o, n *Config) bool { return o.Logger.Format != n.Logger.Format }},
+	{"TRUSTED_PROXIES", func(o, n *Config) bool { return !slices.Equal(o.Server.TrustedProxies, n.Server.TrustedProxies) }},
+	{"TLS_CERT_FILE", func(o, n *Config) bool { return o.Server.TLSCertFile != n.Server.TLSCertFile }},
+	{"TLS_KEY_FILE", func(o, n *Config) bool { return o.Server.TLSKeyFile != n.Server.TLSKeyFile }},
+	{"ENV", func(o, n *Config) bool { return o.Env != n.Env }},
+}
+
+// Watcher reloads the configuration on SIGHUP, and optionally on a timer,
+// and notifies subscribers so reloadable settings can be applied in place
+type Watcher struct {
+	mu          sync.Mutex
+	current     *Config
+	subscribers []Subscriber
+	load        func() (*Config, error)
+}
+
+// NewWatcher creates a watcher starting from the running configuration
+func NewWatcher(cfg *Config) *Watcher {
+	return &Watcher{
+		current: cfg,
+		load:    Load,
+	}
+}
+
+// Subscribe registers fn to be called after each successful reload
+func (w *Watcher) Subscribe(fn Subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Current returns the most recently loaded configuration
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload loads the configuration again and notifies subscribers. The running
+// configuration is kept when loading or validation fails.
+func (w *Watcher) Reload() error {
+	cfg, err := w.load()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	old := w.current
+	w.current = cfg
+	subscribers := slices.Clone(w.subscribers)
+	w.mu.Unlock()
+
+	for _, field := range restartFields {
+		if field.changed(old, cfg) {
+			logger.Warn("configuration change requires a restart", zap.String("field", field.name))
+		}
+	}
+
+	for _, fn := range subscribers {
+		fn(old, cfg)
+	}
+
+	return nil
+}
+
+// Run reloads on SIGHUP and every interval (if positive) until ctx is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+		}
+
+		if err := w.Reload(); err != nil {
+			logger.Error("failed to reload configuration", zap.Error(err))
+			continue
+		}
+		logger.Info("configuration reloaded")
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// testWatcher returns a watcher on a copy of the default configuration whose
+// reloads return the configurations sent on next
+func testWatcher() (*Watcher, chan *Config) {
+	next := make(chan *Config, 1)
+	w := NewWatcher(defaultConfig())
+	w.load = func() (*Config, error) {
+		select {
+		case cfg := <-next:
+			return cfg, nil
+		default:
+			return nil, errors.New("no configuration queued")
+		}
+	}
+	return w, next
+}
+
+// captureLogs sends the global logger output to a buffer for the rest of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	logger.Get()
+	logger.SetOutput(zapcore.AddSync(buf))
+	t.Cleanup(func() { logger.SetOutput(zapcore.AddSync(os.Stdout)) })
+	return buf
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatcherReloadNotifiesSubscribers(t *testing.T) {
+	w, next := testWatcher()
+	initial := w.Current()
+
+	var calls []string
+	w.Subscribe(func(old, updated *Config) {
+		calls = append(calls, "first:"+old.Logger.Level+"->"+updated.Logger.Level)
+	})
+	w.Subscribe(func(old, updated *Config) {
+		calls = append(calls, "second:"+old.Logger.Level+"->"+updated.Logger.Level)
+	})
+
+	updated := defaultConfig()
+	updated.Logger.Level = "debug"
+	next <- updated
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	want := []string{
+		"first:" + initial.Logger.Level + "->debug",
+		"second:" + initial.Logger.Level + "->debug",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("subscriber calls = %v, want %v", calls, want)
+	}
+	if w.Current() != updated {
+		t.Error("Current did not return the reloaded configuration")
+	}
+}
+
+func TestWatcherReloadFailureKeepsConfig(t *testing.T) {
+	w, _ := testWatcher()
+	initial := w.Current()
+	w.Subscribe(func(_, _ *Config) { t.Error("subscriber called after a failed reload") })
+
+	if err := w.Reload(); err == nil {
+		t.Fatal("Reload succeeded without a configuration")
+	}
+	if w.Current() != initial {
+		t.Error("failed reload replaced the running configuration")
+	}
+}
+
+func TestWatcherWarnsAboutRestartFields(t *testing.T) {
+	logs := captureLogs(t)
+	w, next := testWatcher()
+
+	updated := defaultConfig()
+	updated.Database.Password = "new-password"
+	updated.Server.Port = "9999"
+	updated.RateLimit.RPS++
+	next <- updated
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	out := logs.String()
+	for _, field := range []string{`"field":"DB_DSN"`, `"field":"SERVER_PORT"`} {
+		if !strings.Contains(out, field) {
+			t.Errorf("missing restart warning for %s in %s", field, out)
+		}
+	}
+	if strings.Contains(out, "RATE_LIMIT_RPS") {
+		t.Error("restart warning for a reloadable field")
+	}
+	if strings.Contains(out, "new-password") {
+		t.Error("secret value logged")
+	}
+}
+
+// TestWatcherRunReloadsOnSIGHUP sends SIGHUP to the test process and waits for
+// the subscriber to see the reloaded configuration
+func TestWatcherRunReloadsOnSIGHUP(t *testing.T) {
+	// Keep SIGHUP from terminating the test binary before Run subscribes to it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, next := testWatcher()
+	reloaded := make(chan string, 1)
+	w.Subscribe(func(_, updated *Config) { reloaded <- updated.Logger.Level })
+
+	updated := defaultConfig()
+	updated.Logger.Level = "warn"
+	next <- updated
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, 0)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Run subscribes asynchronously, so signal until the reload is seen
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := process.Signal(syscall.SIGHUP); err != nil {
+			t.Skipf("cannot send SIGHUP: %v", err)
+		}
+		select {
+		case level := <-reloaded:
+			if level != "warn" {
+				t.Errorf("reloaded level = %q, want warn", level)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no reload after SIGHUP")
+		}
+	}
+}
+
+func TestWatcherRunReloadsOnInterval(t *testing.T) {
+	w, next := testWatcher()
+	reloaded := make(chan struct{}, 1)
+	w.Subscribe(func(_, _ *Config) { reloaded <- struct{}{} })
+	next <- defaultConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Error("no reload on the interval")
+	}
+	cancel()
+	<-done
+}
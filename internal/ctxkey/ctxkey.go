@@ -0,0 +1,25 @@
+// Package ctxkey defines the keys used to store request-scoped values in a
+// context. Each key has its own unexported type, so keys can't collide with
+// each other or with keys defined by other packages.
+package ctxkey
+
+type (
+	requestIDKey struct{}
+	userIDKey    struct{}
+	clientIPKey  struct{}
+	localeKey    struct{}
+	adminKey     struct{}
+)
+
+var (
+	// RequestID stores the request ID (string)
+	RequestID = requestIDKey{}
+	// UserID stores the authenticated user ID (int)
+	UserID = userIDKey{}
+	// ClientIP stores the resolved client IP (string)
+	ClientIP = clientIPKey{}
+	// Locale stores the negotiated locale (string)
+	Locale = localeKey{}
+	// Admin stores the basic auth username of an admin request (string)
+	Admin = adminKey{}
+)
@@ -0,0 +1,32 @@
+package ctxkey
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKeysAreDistinct(t *testing.T) {
+	keys := map[string]any{
+		"RequestID": RequestID,
+		"UserID":    UserID,
+		"ClientIP":  ClientIP,
+		"Locale":    Locale,
+		"Admin":     Admin,
+	}
+
+	// Store every key, plus plain string keys other packages might use
+	ctx := context.Background()
+	for name, key := range keys {
+		ctx = context.WithValue(ctx, key, name)
+		ctx = context.WithValue(ctx, name, "string key "+name)
+	}
+	for _, name := range []string{"request_id", "user_id", "requestID", "userID"} {
+		ctx = context.WithValue(ctx, name, "string key "+name)
+	}
+
+	for name, key := range keys {
+		if got := ctx.Value(key); got != name {
+			t.Errorf("ctx.Value(%s) = %v, want %q", name, got, name)
+		}
+	}
+}
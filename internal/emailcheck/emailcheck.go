@@ -0,0 +1,143 @@
+// Package emailcheck verifies that the domain of an email address can
+// receive mail by looking up its MX records.
+package emailcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUndeliverable is returned for addresses whose domain cannot receive mail
+var ErrUndeliverable = errors.New("email domain cannot receive mail")
+
+// maxCacheEntries bounds the cache; it is cleared when full
+const maxCacheEntries = 10000
+
+// Resolver is the subset of *net.Resolver used for lookups
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// MXChecker checks email domains for MX records, caching the answers. DNS
+// failures other than a non-existent domain let the address through, so
+// signups don't fail when DNS is slow or unavailable.
+type MXChecker struct {
+	resolver Resolver
+	timeout  time.Duration
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// cacheEntry is a cached lookup result
+type cacheEntry struct {
+	deliverable bool
+	expires     time.Time
+}
+
+// New creates a checker whose lookups take at most timeout and whose answers
+// are cached for ttl
+func New(timeout, ttl time.Duration) *MXChecker {
+	return &MXChecker{
+		resolver: net.DefaultResolver,
+		timeout:  timeout,
+		ttl:      ttl,
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+// SetResolver replaces the DNS resolver
+func (c *MXChecker) SetResolver(r Resolver) {
+	c.resolver = r
+}
+
+// Check returns ErrUndeliverable when the domain of email cannot receive mail
+func (c *MXChecker) Check(ctx context.Context, email string) error {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return fmt.Errorf("%w: missing domain", ErrUndeliverable)
+	}
+	domain := strings.ToLower(strings.TrimSuffix(email[at+1:], "."))
+
+	if deliverable, ok := c.cached(domain, time.Now()); ok {
+		return undeliverable(domain, deliverable)
+	}
+
+	deliverable, definite := c.lookup(ctx, domain)
+	if definite {
+		c.store(domain, deliverable, time.Now())
+	}
+	return undeliverable(domain, deliverable)
+}
+
+// lookup resolves domain. definite is false when DNS failed and the answer
+// is a fail-open guess that shouldn't be cached.
+func (c *MXChecker) lookup(ctx context.Context, domain string) (deliverable, definite bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	records, err := c.resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// A single "." record is a null MX: the domain accepts no mail (RFC 7505)
+		if len(records) == 1 && (records[0].Host == "." || records[0].Host == "") {
+			return false, true
+		}
+		return true, true
+	}
+	if err != nil && !isNotFound(err) {
+		return true, false
+	}
+
+	// Without MX records mail goes to the domain's own address (RFC 5321)
+	if _, err := c.resolver.LookupHost(ctx, domain); err != nil {
+		if isNotFound(err) {
+			return false, true
+		}
+		return true, false
+	}
+	return true, true
+}
+
+// cached returns the cached answer for domain, if still fresh
+func (c *MXChecker) cached(domain string, now time.Time) (deliverable, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.cache[domain]
+	if !ok || now.After(entry.expires) {
+		return false, false
+	}
+	return entry.deliverable, true
+}
+
+// store caches the answer for domain
+func (c *MXChecker) store(domain string, deliverable bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.cache) >= maxCacheEntries {
+		c.cache = make(map[string]cacheEntry)
+	}
+	c.cache[domain] = cacheEntry{deliverable: deliverable, expires: now.Add(c.ttl)}
+}
+
+// undeliverable returns ErrUndeliverable for domain unless deliverable
+func undeliverable(domain string, deliverable bool) error {
+	if deliverable {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUndeliverable, domain)
+}
+
+// isNotFound reports whether err says the domain or record doesn't exist
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,139 @@
+// Package features evaluates feature flags so endpoints can be dark-launched
+// and rolled out gradually.
+package features
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-starter/internal/httpx"
+)
+
+// flag is a parsed flag value: on for everyone, or for percent of users
+type flag struct {
+	percent int
+}
+
+// Flags holds the current feature flags. Unknown flags are disabled.
+type Flags struct {
+	mu     sync.RWMutex
+	flags  map[string]flag
+	userID func(context.Context) (int, bool)
+}
+
+// New creates flags from values such as "true", "false" or "25%". userID
+// returns the user a request belongs to and keys percentage rollouts; it may
+// be nil, in which case partially rolled out flags are off.
+func New(values map[string]string, userID func(context.Context) (int, bool)) (*Flags, error) {
+	flags, err := parse(values)
+	if err != nil {
+		return nil, err
+	}
+	return &Flags{flags: flags, userID: userID}, nil
+}
+
+// Validate checks that every flag value can be parsed
+func Validate(values map[string]string) error {
+	_, err := parse(values)
+	return err
+}
+
+// parse checks flag values, returning them in evaluated form
+func parse(values map[string]string) (map[string]flag, error) {
+	flags := make(map[string]flag, len(values))
+	for name, value := range values {
+		percent, err := parsePercent(value)
+		if err != nil {
+			return nil, fmt.Errorf("feature flag %s: %w", name, err)
+		}
+		flags[name] = flag{percent: percent}
+	}
+	return flags, nil
+}
+
+// parsePercent converts a flag value to the percentage of users it enables
+func parsePercent(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "true", "on", "1":
+		return 100, nil
+	case "false", "off", "0", "":
+		return 0, nil
+	}
+
+	if p, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.Atoi(p)
+		if err == nil && percent >= 0 && percent <= 100 {
+			return percent, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid value %q (use true, false or a percentage such as 25%%)", value)
+}
+
+// Set replaces all flags, e.g. after a configuration reload
+func (f *Flags) Set(values map[string]string) error {
+	flags, err := parse(values)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.flags = flags
+	f.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether the named feature is on for the request in ctx.
+// A percentage rollout enables the feature for a stable subset of users, so
+// each user keeps the same answer; requests without a user are excluded.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	f.mu.RLock()
+	fl, ok := f.flags[name]
+	f.mu.RUnlock()
+
+	switch {
+	case !ok || fl.percent <= 0:
+		return false
+	case fl.percent >= 100:
+		return true
+	}
+
+	if f.userID == nil {
+		return false
+	}
+	userID, ok := f.userID(ctx)
+	if !ok {
+		return false
+	}
+	return bucket(name, userID) < fl.percent
+}
+
+// bucket maps a user to 0-99, independently per flag so that the same users
+// aren't always the first to get every feature
+func bucket(name string, userID int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(userID)))
+	return int(h.Sum32() % 100)
+}
+
+// Require responds 404 Not Found unless the named feature is enabled, hiding
+// routes that aren't launched. Place it after authentication when the flag is
+// rolled out by percentage so the user is known.
+func (f *Flags) Require(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !f.Enabled(r.Context(), name) {
+				httpx.WriteError(w, r, http.StatusNotFound, "not found", "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
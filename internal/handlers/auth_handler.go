@@ -1,28 +1,27 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 
-	"go-starter/internal/logger"
+	"go-starter/internal/httpx"
 	"go-starter/internal/models"
 	"go-starter/internal/services"
-
-	"github.com/go-playground/validator/v10"
-	"go.uber.org/zap"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	authService *services.AuthService
-	validate    *validator.Validate
+	// envelope wraps responses as {"data", "meta"}
+	envelope bool
 }
 
-// NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+// NewAuthHandler creates a new authentication handler. envelope enables the
+// {"data", "meta"} response shape.
+func NewAuthHandler(authService *services.AuthService, envelope bool) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
-		validate:    validator.New(),
+		envelope:    envelope,
 	}
 }
 
@@ -34,36 +33,39 @@ func NewAuthHandler(authService *services.AuthService) *AuthHandler {
 // @Param request body models.RegisterRequest true "Registration credentials"
 // @Success 201 {object} models.AuthResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
 // @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Param Idempotency-Key header string false "Replays the original response when a registration is retried with the same key"
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
 
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "invalid request body", err)
-		return
-	}
-
-	// Validate request
-	if err := h.validate.Struct(req); err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "validation failed", err)
+	// Decode and validate request body
+	if err := decodeAndValidate(w, r, &req); err != nil {
+		respondWithDecodeError(w, r, err)
 		return
 	}
 
 	// Register user
 	response, err := h.authService.Register(r.Context(), &req)
 	if err != nil {
-		if err == services.ErrUserExists {
-			respondWithError(w, r, http.StatusConflict, "user already exists", err)
-		} else {
-			respondWithError(w, r, http.StatusInternalServerError, "failed to register user", err)
+		switch {
+		case errors.Is(err, services.ErrUserExists):
+			httpx.RespondWithError(w, r, http.StatusConflict, "user already exists", err)
+		case errors.Is(err, services.ErrAccountDeleted):
+			httpx.RespondWithError(w, r, http.StatusConflict, "account was deleted; contact support to restore it", err)
+		case errors.Is(err, services.ErrEmailUndeliverable):
+			httpx.RespondWithError(w, r, http.StatusUnprocessableEntity, "email domain cannot receive mail", err)
+		default:
+			respondWithServerError(w, r, "failed to register user", err)
 		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, response)
+	respondWithData(w, r, h.envelope, http.StatusCreated, response, httpx.Meta{})
 }
 
 // Login godoc
@@ -74,21 +76,17 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Param request body models.LoginRequest true "Login credentials"
 // @Success 200 {object} models.AuthResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 
-	// Decode request body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "invalid request body", err)
-		return
-	}
-
-	// Validate request
-	if err := h.validate.Struct(req); err != nil {
-		respondWithError(w, r, http.StatusBadRequest, "validation failed", err)
+	// Decode and validate request body
+	if err := decodeAndValidate(w, r, &req); err != nil {
+		respondWithDecodeError(w, r, err)
 		return
 	}
 
@@ -96,37 +94,12 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	response, err := h.authService.Login(r.Context(), &req)
 	if err != nil {
 		if err == services.ErrInvalidCredentials {
-			respondWithError(w, r, http.StatusUnauthorized, "invalid credentials", err)
+			httpx.RespondWithError(w, r, http.StatusUnauthorized, "invalid credentials", err)
 		} else {
-			respondWithError(w, r, http.StatusInternalServerError, "failed to login", err)
+			respondWithServerError(w, r, "failed to login", err)
 		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
-}
-
-// respondWithJSON sends a JSON response
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		// Log encoding error but don't send another response
-		logger.Error("failed to encode JSON response", zap.Error(err))
-	}
-}
-
-// respondWithError sends an error response
-func respondWithError(w http.ResponseWriter, r *http.Request, code int, message string, err error) {
-	logger.FromContext(r.Context()).Error(message,
-		zap.Error(err),
-		zap.Int("status_code", code),
-	)
-
-	response := models.ErrorResponse{
-		Error:   message,
-		Message: err.Error(),
-	}
-
-	respondWithJSON(w, code, response)
+	respondWithData(w, r, h.envelope, http.StatusOK, response, httpx.Meta{})
 }
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-starter/internal/config"
+	"go-starter/internal/httpx"
+)
+
+// ConfigHandler handles operator requests for the running configuration
+type ConfigHandler struct {
+	current func() *config.Config
+}
+
+// NewConfigHandler creates a new configuration handler. current returns the
+// configuration in effect, which may change on reload.
+func NewConfigHandler(current func() *config.Config) *ConfigHandler {
+	return &ConfigHandler{current: current}
+}
+
+// Effective godoc
+// @Summary Effective configuration with secrets redacted
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /admin/config [get]
+func (h *ConfigHandler) Effective(w http.ResponseWriter, r *http.Request) {
+	httpx.RespondWithJSON(w, http.StatusOK, h.current().Redacted())
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/swaggo/swag"
+)
+
+// DocsHandler serves the generated OpenAPI specification
+type DocsHandler struct {
+	spec *swag.Spec
+}
+
+// NewDocsHandler creates a new documentation handler
+func NewDocsHandler(spec *swag.Spec) *DocsHandler {
+	return &DocsHandler{spec: spec}
+}
+
+// Spec serves the raw OpenAPI specification as JSON
+func (h *DocsHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(h.spec.ReadDoc()))
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-starter/internal/httpx"
+)
+
+// NotFound responds to requests that match no route with a JSON error
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	httpx.WriteError(w, r, http.StatusNotFound, "not found", "")
+}
+
+// MethodNotAllowed responds to requests whose path matches a route but whose
+// method doesn't with a JSON error
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	httpx.WriteError(w, r, http.StatusMethodNotAllowed, "method not allowed", "")
+}
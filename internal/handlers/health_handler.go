@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"go-starter/internal/budget"
 	"go-starter/internal/logger"
+	"go-starter/internal/migrations"
 	"go-starter/pkg/database"
 
 	"go.uber.org/zap"
@@ -12,18 +19,89 @@ import (
 
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	db *database.DB
+	db          *database.DB
+	warnLatency time.Duration
+	maxLatency  time.Duration
+	// draining reports whether the server is shutting down
+	draining func() bool
+	ready    ReadinessConfig
 }
 
-// NewHealthHandler creates a new health check handler
-func NewHealthHandler(db *database.DB) *HealthHandler {
-	return &HealthHandler{db: db}
+// ReadinessConfig configures the checks /ready runs on top of the ping
+type ReadinessConfig struct {
+	// MinSchemaVersion is the lowest schema version the binary works with
+	MinSchemaVersion uint
+	// AcquireTimeout bounds taking a connection from the pool
+	AcquireTimeout time.Duration
+	// QueryCheck also runs a trivial query against the users table
+	QueryCheck bool
 }
 
+// NewHealthHandler creates a new health check handler. A database ping slower
+// than warnLatency reports "degraded"; one slower than maxLatency reports
+// "unhealthy". Zero disables the respective threshold. Readiness fails once
+// draining returns true, or when one of the checks in ready fails.
+func NewHealthHandler(db *database.DB, warnLatency, maxLatency time.Duration, draining func() bool, ready ReadinessConfig) *HealthHandler {
+	return &HealthHandler{
+		db:          db,
+		warnLatency: warnLatency,
+		maxLatency:  maxLatency,
+		draining:    draining,
+		ready:       ready,
+	}
+}
+
+const (
+	// readyTimeout bounds the total time spent on a readiness check
+	readyTimeout = 3 * time.Second
+	// poolStatsBudget is the minimum time left required to include pool stats
+	poolStatsBudget = 500 * time.Millisecond
+)
+
+// Health statuses; degraded is still reported with 200
+const (
+	healthOK        = "ok"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+	healthDraining  = "draining"
+)
+
+// Readiness sub-check statuses
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
 // HealthResponse represents a health check response
 type HealthResponse struct {
-	Status   string `json:"status"`
-	Database string `json:"database"`
+	Status            string  `json:"status"`
+	Database          string  `json:"database"`
+	DatabaseLatencyMS float64 `json:"database_latency_ms"`
+	// AcquireWaitMS is the total time spent waiting for pool connections
+	AcquireWaitMS float64    `json:"acquire_wait_ms"`
+	Pool          *PoolStats `json:"pool,omitempty"`
+	// Checks itemizes the readiness sub-checks
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one readiness sub-check
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Check is a named health check, run by /ready and the startup preflight
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+// PoolStats represents database connection pool statistics
+type PoolStats struct {
+	OpenConnections int `json:"open_connections"`
+	InUse           int `json:"in_use"`
+	Idle            int `json:"idle"`
 }
 
 // Healthz godoc
@@ -34,34 +112,164 @@ type HealthResponse struct {
 // @Failure 503 {object} HealthResponse
 // @Router /healthz [get]
 func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
-	response := HealthResponse{
-		Status:   "ok",
-		Database: "ok",
-	}
-
-	statusCode := http.StatusOK
-
-	// Check database health
-	if err := h.db.Health(r.Context()); err != nil {
-		logger.FromContext(r.Context()).Error("database health check failed", zap.Error(err))
-		response.Database = "unhealthy"
-		response.Status = "unhealthy"
-		statusCode = http.StatusServiceUnavailable
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
+	response, statusCode := h.check(r.Context())
+	writeHealthResponse(w, statusCode, response)
 }
 
 // Ready godoc
 // @Summary Readiness check
+// @Description Besides pinging the database, checks that the schema is migrated far enough
+// @Description and that a pool connection can be acquired (and optionally queried), listing
+// @Description each sub-check in "checks". Responds 503 with status "draining" once the
+// @Description server starts shutting down.
 // @Tags health
 // @Produce json
 // @Success 200 {object} HealthResponse
 // @Failure 503 {object} HealthResponse
 // @Router /ready [get]
 func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
-	// Same as healthz for now, but can be extended for more complex readiness checks
-	h.Healthz(w, r)
+	// Stop receiving traffic as soon as shutdown starts, without checking the database
+	if h.draining != nil && h.draining() {
+		writeHealthResponse(w, http.StatusServiceUnavailable, HealthResponse{Status: healthDraining})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	response, statusCode := h.check(ctx)
+	response.Checks = h.readinessChecks(ctx)
+	for _, c := range response.Checks {
+		if c.Status == checkFail {
+			response.Status = healthUnhealthy
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	// Pool stats are optional, skip them when the check is running out of time
+	if budget.Allows(ctx, poolStatsBudget) {
+		stats := h.db.Stats()
+		response.Pool = &PoolStats{
+			OpenConnections: stats.OpenConnections,
+			InUse:           stats.InUse,
+			Idle:            stats.Idle,
+		}
+	} else {
+		logger.FromContext(ctx).Debug("skipping pool stats, readiness budget exhausted")
+	}
+
+	writeHealthResponse(w, statusCode, response)
+}
+
+// check runs the required health checks
+func (h *HealthHandler) check(ctx context.Context) (HealthResponse, int) {
+	response := HealthResponse{
+		Status:   healthOK,
+		Database: healthOK,
+	}
+
+	// Check database health
+	start := time.Now()
+	err := h.db.Health(ctx)
+	latency := time.Since(start)
+	response.DatabaseLatencyMS = float64(latency.Microseconds()) / 1000
+	response.AcquireWaitMS = float64(h.db.Stats().WaitDuration.Microseconds()) / 1000
+
+	switch {
+	case err != nil:
+		logger.FromContext(ctx).Error("database health check failed", zap.Error(err))
+		response.Database = healthUnhealthy
+	case h.maxLatency > 0 && latency > h.maxLatency:
+		logger.FromContext(ctx).Error("database health check too slow",
+			zap.Duration("latency", latency),
+			zap.Duration("max_latency", h.maxLatency),
+		)
+		response.Database = healthUnhealthy
+	case h.warnLatency > 0 && latency > h.warnLatency:
+		logger.FromContext(ctx).Warn("database health check slow",
+			zap.Duration("latency", latency),
+			zap.Duration("warn_latency", h.warnLatency),
+		)
+		response.Database = healthDegraded
+	}
+
+	response.Status = response.Database
+	if response.Status == healthUnhealthy {
+		return response, http.StatusServiceUnavailable
+	}
+	return response, http.StatusOK
+}
+
+// Checks returns the database ping followed by the readiness checks, for
+// running outside a request, e.g. before the server starts
+func (h *HealthHandler) Checks() []Check {
+	ping := Check{Name: "database", Run: h.db.Health}
+	return append([]Check{ping}, h.readinessCheckList()...)
+}
+
+// readinessChecks runs the schema, pool and optional query checks
+func (h *HealthHandler) readinessChecks(ctx context.Context) []CheckResult {
+	list := h.readinessCheckList()
+	checks := make([]CheckResult, 0, len(list))
+	for _, c := range list {
+		checks = append(checks, runCheck(ctx, c.Name, c.Run))
+	}
+	return checks
+}
+
+// readinessCheckList returns the schema, pool and optional query checks
+func (h *HealthHandler) readinessCheckList() []Check {
+	checks := []Check{
+		{Name: "schema", Run: func(ctx context.Context) error {
+			version, dirty, err := migrations.Version(ctx, h.db.DB)
+			switch {
+			case err != nil:
+				return err
+			case dirty:
+				return fmt.Errorf("schema version %d is dirty", version)
+			case version < h.ready.MinSchemaVersion:
+				return fmt.Errorf("schema version %d is below %d", version, h.ready.MinSchemaVersion)
+			}
+			return nil
+		}},
+		{Name: "pool_acquire", Run: func(ctx context.Context) error {
+			return h.db.CheckAcquire(ctx, h.ready.AcquireTimeout)
+		}},
+	}
+
+	if h.ready.QueryCheck {
+		checks = append(checks, Check{Name: "query", Run: func(ctx context.Context) error {
+			var one int
+			err := h.db.QueryRowContext(ctx, "SELECT 1 FROM users LIMIT 1").Scan(&one)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}})
+	}
+	return checks
+}
+
+// runCheck times fn and reports its outcome. Errors are only logged, since
+// /ready is public and they may reveal connection details.
+func runCheck(ctx context.Context, name string, fn func(context.Context) error) CheckResult {
+	start := time.Now()
+	err := fn(ctx)
+	result := CheckResult{
+		Name:      name,
+		Status:    checkOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("readiness check failed", zap.String("check", name), zap.Error(err))
+		result.Status = checkFail
+	}
+	return result
+}
+
+// writeHealthResponse sends a health check response
+func writeHealthResponse(w http.ResponseWriter, statusCode int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
 }
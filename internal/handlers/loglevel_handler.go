@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+	"go-starter/internal/middleware"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevelHandler lets operators switch the log level to debug and back
+// without a restart, which would lose in-memory state such as rate limits
+type LogLevelHandler struct {
+	level zap.AtomicLevel
+	// configured returns the level set in the configuration, which may change on reload
+	configured func() string
+}
+
+// LogLevelResponse reports the current and configured log levels
+type LogLevelResponse struct {
+	Level      string `json:"level" example:"debug"`
+	Configured string `json:"configured" example:"info"`
+}
+
+// NewLogLevelHandler creates a handler changing level
+func NewLogLevelHandler(level zap.AtomicLevel, configured func() string) *LogLevelHandler {
+	return &LogLevelHandler{level: level, configured: configured}
+}
+
+// Get godoc
+// @Summary Current and configured log level
+// @Tags admin
+// @Produce json
+// @Success 200 {object} LogLevelResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /admin/log-level [get]
+func (h *LogLevelHandler) Get(w http.ResponseWriter, r *http.Request) {
+	httpx.RespondWithJSON(w, http.StatusOK, h.response())
+}
+
+// Toggle godoc
+// @Summary Toggle the log level between debug and the configured level
+// @Description Switches to debug, or back to the configured level when already at debug.
+// @Description A configuration reload that changes LOG_LEVEL also resets it.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} LogLevelResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /admin/log-level/toggle [post]
+func (h *LogLevelHandler) Toggle(w http.ResponseWriter, r *http.Request) {
+	var configured zapcore.Level
+	if err := configured.UnmarshalText([]byte(h.configured())); err != nil {
+		httpx.RespondWithError(w, r, http.StatusInternalServerError, "invalid configured log level", err)
+		return
+	}
+
+	previous := h.level.Level()
+	next := zapcore.DebugLevel
+	if previous == zapcore.DebugLevel {
+		next = configured
+	}
+	h.level.SetLevel(next)
+
+	admin, _ := middleware.GetAdminFromContext(r.Context())
+	logger.FromContext(r.Context()).Info("log level changed",
+		zap.Stringer("from", previous),
+		zap.Stringer("to", next),
+		zap.String("admin", admin),
+	)
+	httpx.RespondWithJSON(w, http.StatusOK, h.response())
+}
+
+// response describes the current state
+func (h *LogLevelHandler) response() LogLevelResponse {
+	return LogLevelResponse{Level: h.level.Level().String(), Configured: h.configured()}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go-starter/internal/httpx"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// maxRequestBodySize limits the size of JSON request bodies (1 MB)
+const maxRequestBodySize = 1 << 20
+
+// validate is the shared validator used by all handlers
+var validate = validator.New()
+
+// decodeError describes why a request body could not be decoded or validated
+type decodeError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// decodeAndValidate decodes a JSON request body into dst and validates it.
+// The body is limited to maxRequestBodySize and unknown fields are rejected.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return &decodeError{
+				status:  http.StatusRequestEntityTooLarge,
+				message: "request body too large",
+				err:     err,
+			}
+		}
+		// An empty or whitespace-only body decodes to io.EOF
+		if errors.Is(err, io.EOF) {
+			return &decodeError{
+				status:  http.StatusBadRequest,
+				message: "request body is required",
+				err:     err,
+			}
+		}
+		// A body cut off mid-object decodes to io.ErrUnexpectedEOF
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return &decodeError{
+				status:  http.StatusBadRequest,
+				message: "invalid request body",
+				err:     errors.New("request body ended before the JSON object was complete"),
+			}
+		}
+		return &decodeError{
+			status:  http.StatusBadRequest,
+			message: "invalid request body",
+			err:     err,
+		}
+	}
+
+	// Reject trailing data after the JSON object
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return &decodeError{
+			status:  http.StatusBadRequest,
+			message: "invalid request body",
+			err:     errors.New("request body must contain a single JSON object"),
+		}
+	}
+
+	if err := validate.Struct(dst); err != nil {
+		return &decodeError{
+			status:  http.StatusBadRequest,
+			message: "validation failed",
+			err:     err,
+		}
+	}
+
+	return nil
+}
+
+// respondWithDecodeError maps an error from decodeAndValidate to a response
+func respondWithDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		httpx.RespondWithError(w, r, decodeErr.status, decodeErr.message, decodeErr.err)
+		return
+	}
+	httpx.RespondWithError(w, r, http.StatusBadRequest, "invalid request body", err)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-starter/internal/models"
+)
+
+func TestLoginRejectsUndecodableBodies(t *testing.T) {
+	// Decoding fails before the service is used
+	handler := NewAuthHandler(nil, false)
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		error   string
+		message string
+	}{
+		{"empty", "", http.StatusBadRequest, "request body is required", "EOF"},
+		{"whitespace", " \n\t\r\n ", http.StatusBadRequest, "request body is required", "EOF"},
+		{"truncated", `{"email": "a@example.com"`, http.StatusBadRequest, "invalid request body", "request body ended before the JSON object was complete"},
+		{"trailing data", `{"email": "a@example.com", "password": "secret1"} {}`, http.StatusBadRequest, "invalid request body", "request body must contain a single JSON object"},
+		{"unknown field", `{"email": "a@example.com", "password": "secret1", "admin": true}`, http.StatusBadRequest, "invalid request body", `json: unknown field "admin"`},
+		{"invalid", `{"email": "a@example.com", "password": "short"}`, http.StatusBadRequest, "validation failed", ""},
+		{"too large", `{"email": "` + strings.Repeat("a", maxRequestBodySize) + `"}`, http.StatusRequestEntityTooLarge, "request body too large", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.Login(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var body models.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body is not an ErrorResponse: %v\n%s", err, rec.Body.String())
+			}
+			if body.Error != tt.error {
+				t.Errorf("error = %q, want %q", body.Error, tt.error)
+			}
+			if tt.message != "" && body.Message != tt.message {
+				t.Errorf("message = %q, want %q", body.Message, tt.message)
+			}
+		})
+	}
+}
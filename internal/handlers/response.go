@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+	"go-starter/internal/services"
+)
+
+// respondWithData sends a successful payload. When envelope is set the payload
+// is wrapped as {"data": payload, "meta": meta} with the request ID filled in;
+// otherwise the bare payload is sent and meta is ignored.
+func respondWithData(w http.ResponseWriter, r *http.Request, envelope bool, code int, payload interface{}, meta httpx.Meta) {
+	if !envelope {
+		httpx.RespondWithJSON(w, code, payload)
+		return
+	}
+
+	meta.RequestID = logger.RequestIDFromContext(r.Context())
+	httpx.RespondWithJSON(w, code, httpx.Envelope{Data: payload, Meta: meta})
+}
+
+// respondWithServerError responds 504 when err is a database timeout and 500
+// with message otherwise
+func respondWithServerError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if errors.Is(err, services.ErrTimeout) {
+		httpx.RespondWithError(w, r, http.StatusGatewayTimeout, "request timed out", err)
+		return
+	}
+	httpx.RespondWithError(w, r, http.StatusInternalServerError, message, err)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/stats"
+)
+
+const (
+	defaultTopClients = 20
+	maxTopClients     = 1000
+)
+
+// StatsHandler handles operator requests for traffic statistics
+type StatsHandler struct {
+	collector *stats.ClientCollector
+}
+
+// NewStatsHandler creates a new statistics handler
+func NewStatsHandler(collector *stats.ClientCollector) *StatsHandler {
+	return &StatsHandler{collector: collector}
+}
+
+// ClientStatsResponse represents the heaviest clients by recent traffic
+type ClientStatsResponse struct {
+	Clients []stats.ClientStats `json:"clients"`
+}
+
+// TopClients godoc
+// @Summary Heaviest clients by recent traffic
+// @Tags admin
+// @Produce json
+// @Param top query int false "Number of clients to return" default(20)
+// @Success 200 {object} ClientStatsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /admin/stats/clients [get]
+func (h *StatsHandler) TopClients(w http.ResponseWriter, r *http.Request) {
+	top := defaultTopClients
+	if value := r.URL.Query().Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTopClients {
+			httpx.WriteError(w, r, http.StatusBadRequest, "invalid query parameter", "top must be between 1 and 1000")
+			return
+		}
+		top = parsed
+	}
+
+	httpx.RespondWithJSON(w, http.StatusOK, ClientStatsResponse{
+		Clients: h.collector.Top(top),
+	})
+}
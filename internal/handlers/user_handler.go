@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+	"go-starter/internal/middleware"
+	"go-starter/internal/models"
+	"go-starter/internal/pagination"
+	"go-starter/internal/services"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// UserHandler handles requests for user profiles
+type UserHandler struct {
+	authService *services.AuthService
+	// envelope wraps responses as {"data", "meta"}
+	envelope bool
+}
+
+// NewUserHandler creates a new user handler. envelope enables the
+// {"data", "meta"} response shape.
+func NewUserHandler(authService *services.AuthService, envelope bool) *UserHandler {
+	return &UserHandler{authService: authService, envelope: envelope}
+}
+
+// UserSearchResponse represents a page of users
+type UserSearchResponse struct {
+	Users []*models.User `json:"users"`
+	// NextCursor fetches the following page when listing; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// SearchUsers godoc
+// @Summary List users, or search them by email prefix
+// @Description Without search, users are listed by ID using cursor paging (limit, cursor).
+// @Description With search, matches are paged by offset (limit, offset) and counted.
+// @Tags admin
+// @Produce json
+// @Param search query string false "Email prefix"
+// @Param limit query int false "Maximum number of users to return" default(20)
+// @Param offset query int false "Number of matches to skip (search only)" default(0)
+// @Param cursor query string false "next_cursor from the previous page (listing only)"
+// @Success 200 {object} UserSearchResponse
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Header 200 {integer} X-Total-Count "Total number of matching users (search only)"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /users [get]
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("search")
+	if search == "" {
+		h.listUsers(w, r)
+		return
+	}
+	if r.URL.Query().Has("cursor") {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid query parameter", "cursor cannot be combined with search")
+		return
+	}
+
+	page, err := pagination.Parse(r, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid query parameter", err.Error())
+		return
+	}
+
+	users, total, err := h.authService.SearchUsers(r.Context(), search, page.Limit, page.Offset)
+	if err != nil {
+		respondWithServerError(w, r, "failed to search users", err)
+		return
+	}
+
+	pagination.SetHeaders(w, r, page, total)
+	respondWithData(w, r, h.envelope, http.StatusOK, UserSearchResponse{Users: users}, httpx.Meta{
+		Limit:  page.Limit,
+		Offset: page.Offset,
+		Total:  &total,
+	})
+}
+
+// listUsers responds with a page of all users using cursor paging
+func (h *UserHandler) listUsers(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("offset") {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid query parameter", "offset requires search; use cursor to page the full list")
+		return
+	}
+
+	cursor, err := pagination.ParseCursor(r, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid query parameter", err.Error())
+		return
+	}
+
+	users, err := h.authService.ListUsers(r.Context(), cursor.After, cursor.Limit)
+	if err != nil {
+		respondWithServerError(w, r, "failed to list users", err)
+		return
+	}
+
+	// A full page may be followed by more users
+	var next string
+	if len(users) == cursor.Limit {
+		next = pagination.EncodeCursor(users[len(users)-1].ID)
+	}
+
+	pagination.SetCursorLink(w, r, cursor.Limit, next)
+	respondWithData(w, r, h.envelope, http.StatusOK, UserSearchResponse{Users: users, NextCursor: next}, httpx.Meta{
+		Limit:      cursor.Limit,
+		NextCursor: next,
+	})
+}
+
+// GetUser godoc
+// @Summary Get a user by ID
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid path parameter", "id must be a positive integer")
+		return
+	}
+
+	user, err := h.authService.GetUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithServerError(w, r, "failed to get user", err)
+		return
+	}
+
+	respondWithData(w, r, h.envelope, http.StatusOK, user, httpx.Meta{})
+}
+
+// DeleteUser godoc
+// @Summary Delete a user by ID
+// @Description Admins can't delete their own account, mapped to their basic auth username by BASIC_AUTH_USER_IDS.
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetAdminFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid path parameter", "id must be a positive integer")
+		return
+	}
+
+	if err := h.authService.DeleteUser(r.Context(), userID, admin); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+		case errors.Is(err, services.ErrCannotDeleteSelf):
+			httpx.RespondWithError(w, r, http.StatusConflict, "cannot delete own account", err)
+		default:
+			respondWithServerError(w, r, "failed to delete user", err)
+		}
+		return
+	}
+
+	fields := []zap.Field{zap.Int("user_id", userID), zap.String("admin", admin)}
+	if adminUserID, ok := h.authService.AdminUserID(admin); ok {
+		fields = append(fields, zap.Int("admin_user_id", adminUserID))
+	}
+	logger.FromContext(r.Context()).Info("user deleted by admin", fields...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUser godoc
+// @Summary Restore a deleted user by ID
+// @Description The user's tokens issued before the deletion stay revoked.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BasicAuth
+// @Router /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetAdminFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		httpx.WriteError(w, r, http.StatusBadRequest, "invalid path parameter", "id must be a positive integer")
+		return
+	}
+
+	user, err := h.authService.RestoreUser(r.Context(), userID, admin)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithServerError(w, r, "failed to restore user", err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("user restored by admin",
+		zap.Int("user_id", userID),
+		zap.String("admin", admin),
+	)
+	respondWithData(w, r, h.envelope, http.StatusOK, user, httpx.Meta{})
+}
+
+// GetMe godoc
+// @Summary Get the authenticated user's profile
+// @Description Responds 304 Not Modified when If-None-Match matches the profile's ETag.
+// @Tags users
+// @Produce json
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {object} models.User
+// @Header 200 {string} ETag "Profile version"
+// @Success 304
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /me [get]
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	user, err := h.authService.GetUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+			return
+		}
+		respondWithServerError(w, r, "failed to get user", err)
+		return
+	}
+
+	if httpx.NotModified(w, r, httpx.VersionETag(user.ID, user.UpdatedAt)) {
+		return
+	}
+
+	respondWithData(w, r, h.envelope, http.StatusOK, user, httpx.Meta{})
+}
+
+// UpdateMe godoc
+// @Summary Partially update the authenticated user's profile
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.UpdateMeRequest true "Profile fields to change"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /me [patch]
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	var req models.UpdateMeRequest
+
+	// Decode and validate request body
+	if err := decodeAndValidate(w, r, &req); err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+
+	// Apply the fields present in the request
+	user, err := h.authService.UpdateMe(r.Context(), userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserExists):
+			httpx.RespondWithError(w, r, http.StatusConflict, "user already exists", err)
+		case errors.Is(err, services.ErrUserNotFound):
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+		case errors.Is(err, services.ErrVersionConflict):
+			httpx.RespondWithError(w, r, http.StatusConflict, "profile was modified; refetch and retry", err)
+		case errors.Is(err, services.ErrEmailUndeliverable):
+			httpx.RespondWithError(w, r, http.StatusUnprocessableEntity, "email domain cannot receive mail", err)
+		default:
+			respondWithServerError(w, r, "failed to update user", err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", httpx.VersionETag(user.ID, user.UpdatedAt))
+	respondWithData(w, r, h.envelope, http.StatusOK, user, httpx.Meta{})
+}
+
+// DeleteMe godoc
+// @Summary Delete the authenticated user's account
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.DeleteMeRequest true "Password confirmation"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /me [delete]
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+		return
+	}
+
+	var req models.DeleteMeRequest
+
+	// Decode and validate request body
+	if err := decodeAndValidate(w, r, &req); err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+
+	// Delete account
+	if err := h.authService.DeleteAccount(r.Context(), userID, req.Password); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			httpx.RespondWithError(w, r, http.StatusUnauthorized, "invalid credentials", err)
+		case errors.Is(err, services.ErrUserNotFound):
+			httpx.RespondWithError(w, r, http.StatusNotFound, "user not found", err)
+		default:
+			respondWithServerError(w, r, "failed to delete user", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,18 @@
+package httpx
+
+// Envelope wraps a successful payload for clients that opt into the
+// {"data": ..., "meta": ...} response shape
+type Envelope struct {
+	Data interface{} `json:"data"`
+	Meta Meta        `json:"meta"`
+}
+
+// Meta describes an enveloped response. Pagination fields are only set by
+// list endpoints.
+type Meta struct {
+	RequestID  string `json:"request_id,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
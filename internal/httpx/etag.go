@@ -0,0 +1,45 @@
+package httpx
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VersionETag returns a strong ETag for the resource with the given ID last
+// modified at updatedAt
+func VersionETag(id int, updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d-%x"`, id, updatedAt.UnixNano())
+}
+
+// NotModified sets the ETag header and, when the request's If-None-Match
+// matches it, responds 304 Not Modified and returns true. Handlers should
+// return without writing a body in that case.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison required by RFC 9110
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+// Package httpx provides shared helpers for writing HTTP responses so that
+// handlers and middleware emit identical JSON bodies.
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go-starter/internal/i18n"
+	"go-starter/internal/logger"
+	"go-starter/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// RespondWithJSON sends a JSON response
+func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		// Log encoding error but don't send another response
+		logger.Error("failed to encode JSON response", zap.Error(err))
+	}
+}
+
+// RespondWithError logs err and sends an error response with its message
+func RespondWithError(w http.ResponseWriter, r *http.Request, code int, message string, err error) {
+	logger.FromContext(r.Context()).Error(message,
+		zap.Error(err),
+		zap.Int("status_code", code),
+	)
+
+	WriteError(w, r, code, message, err.Error())
+}
+
+// WriteError sends an error response without logging. detail is optional.
+func WriteError(w http.ResponseWriter, r *http.Request, code int, message, detail string) {
+	response := models.ErrorResponse{
+		Error:     i18n.TranslateContext(r.Context(), message),
+		Message:   detail,
+		RequestID: logger.RequestIDFromContext(r.Context()),
+	}
+
+	RespondWithJSON(w, code, response)
+}
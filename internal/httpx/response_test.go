@@ -0,0 +1,51 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-starter/internal/logger"
+	"go-starter/internal/models"
+)
+
+func TestWriteErrorEncodesJSON(t *testing.T) {
+	detail := `he said "no" \ then left` + "\n\t<script>"
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(logger.WithRequestID(req.Context(), "req-123"))
+	rec := httptest.NewRecorder()
+
+	WriteError(rec, req, http.StatusBadRequest, "validation failed", detail)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not valid JSON: %v\n%s", err, rec.Body.String())
+	}
+	want := models.ErrorResponse{Error: "validation failed", Message: detail, RequestID: "req-123"}
+	if body != want {
+		t.Errorf("body = %+v, want %+v", body, want)
+	}
+}
+
+func TestRespondWithErrorUsesErrorAsMessage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	RespondWithError(rec, req, http.StatusInternalServerError, "internal error", errors.New(`query "x" failed`))
+
+	var body models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not valid JSON: %v", err)
+	}
+	if body.Error != "internal error" || body.Message != `query "x" failed` {
+		t.Errorf("body = %+v", body)
+	}
+}
@@ -0,0 +1,84 @@
+// Package i18n translates user-facing API messages using catalogs
+// embedded from JSON files in the locales directory.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"go-starter/internal/ctxkey"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps locale to message translations keyed by the English message
+var catalogs = mustLoadCatalogs()
+
+// defaultLocale is used when a translation is missing for the requested locale
+var defaultLocale = "en"
+
+// mustLoadCatalogs loads all embedded catalogs, panicking if any is malformed
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: failed to read locales: %v", err))
+	}
+
+	result := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: failed to read %s: %v", entry.Name(), err))
+		}
+
+		messages := make(map[string]string)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: failed to parse %s: %v", entry.Name(), err))
+		}
+
+		result[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+
+	return result
+}
+
+// SetDefaultLocale sets the locale used when a translation is missing
+func SetDefaultLocale(locale string) {
+	defaultLocale = locale
+}
+
+// Translate returns the translation of message for locale. Missing
+// translations fall back to the default locale, and unknown messages
+// are returned untouched.
+func Translate(locale, message string) string {
+	if translated, ok := catalogs[locale][message]; ok && translated != "" {
+		return translated
+	}
+	if translated, ok := catalogs[defaultLocale][message]; ok && translated != "" {
+		return translated
+	}
+	return message
+}
+
+// TranslateContext translates message for the locale stored in ctx
+func TranslateContext(ctx context.Context, message string) string {
+	return Translate(LocaleFromContext(ctx), message)
+}
+
+// WithLocale adds the negotiated locale to context
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxkey.Locale, locale)
+}
+
+// LocaleFromContext returns the locale stored in context, or the default locale
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(ctxkey.Locale).(string); ok {
+		return locale
+	}
+	return defaultLocale
+}
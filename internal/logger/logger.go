@@ -2,34 +2,92 @@ package logger
 
 import (
 	"context"
+	"fmt"
 
+	"go-starter/internal/ctxkey"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-type contextKey string
+var (
+	log   *zap.Logger
+	level = zap.NewAtomicLevel()
+)
 
-const requestIDKey contextKey = "request_id"
+// Supported log output formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
 
-var log *zap.Logger
+// Config holds logger initialization options
+type Config struct {
+	Level string
+	// Format selects the encoder ("json" or "console"); when empty it
+	// defaults to JSON in production and console otherwise
+	Format       string
+	IsProduction bool
+	// SamplingInitial and SamplingThereafter cap repeated entries per second:
+	// the first SamplingInitial entries with the same level and message are
+	// logged, then only every SamplingThereafter-th. Sampled-out entries are
+	// dropped, not buffered. A SamplingInitial of zero disables sampling;
+	// otherwise SamplingThereafter must be at least 1.
+	SamplingInitial    int
+	SamplingThereafter int
+}
 
 // Init initializes the global logger
-func Init(level string, isProduction bool) error {
+func Init(cfg Config) error {
 	var config zap.Config
 
-	if isProduction {
+	if cfg.IsProduction {
 		config = zap.NewProductionConfig()
 	} else {
 		config = zap.NewDevelopmentConfig()
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = FormatConsole
+		if cfg.IsProduction {
+			format = FormatJSON
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		config.Encoding = "json"
+		config.EncoderConfig = zap.NewProductionEncoderConfig()
+	case FormatConsole:
+		config.Encoding = "console"
+		config.EncoderConfig = zap.NewDevelopmentEncoderConfig()
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	default:
+		return fmt.Errorf("unsupported log format: %s", format)
 	}
 
 	// Parse log level
 	var zapLevel zapcore.Level
-	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
-		zapLevel = zapcore.InfoLevel
+	if err := zapLevel.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+	level.SetLevel(zapLevel)
+	config.Level = level
+
+	// Apply sampling only when configured so that no entries are dropped by default
+	config.Sampling = nil
+	if cfg.SamplingInitial > 0 {
+		// zap drops every entry past the initial ones when thereafter is zero
+		if cfg.SamplingThereafter < 1 {
+			return fmt.Errorf("sampling thereafter must be at least 1, got %d", cfg.SamplingThereafter)
+		}
+		config.Sampling = &zap.SamplingConfig{
+			Initial:    cfg.SamplingInitial,
+			Thereafter: cfg.SamplingThereafter,
+		}
 	}
-	config.Level = zap.NewAtomicLevelAt(zapLevel)
 
 	// Output to stdout for container compatibility
 	config.OutputPaths = []string{"stdout"}
@@ -44,6 +102,22 @@ func Init(level string, isProduction bool) error {
 	return nil
 }
 
+// SetLevel changes the level of the global logger at runtime
+func SetLevel(lvl string) error {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(lvl)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", lvl, err)
+	}
+	level.SetLevel(zapLevel)
+	return nil
+}
+
+// AtomicLevel returns the level of the global logger, which can be changed at
+// runtime without rebuilding the logger
+func AtomicLevel() zap.AtomicLevel {
+	return level
+}
+
 // Get returns the global logger instance
 func Get() *zap.Logger {
 	if log == nil {
@@ -80,15 +154,35 @@ func Fatal(msg string, fields ...zap.Field) {
 
 // WithRequestID adds request ID to context
 func WithRequestID(ctx context.Context, requestID string) context.Context {
-	return context.WithValue(ctx, requestIDKey, requestID)
+	return context.WithValue(ctx, ctxkey.RequestID, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in context, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(ctxkey.RequestID).(string)
+	return requestID
 }
 
-// FromContext returns a logger with request ID from context if available
+// FromContext returns a logger with request ID and trace context from context if available
 func FromContext(ctx context.Context) *zap.Logger {
-	if requestID, ok := ctx.Value(requestIDKey).(string); ok {
-		return Get().With(zap.String("request_id", requestID))
+	var fields []zap.Field
+
+	if requestID, ok := ctx.Value(ctxkey.RequestID).(string); ok {
+		fields = append(fields, zap.String("request_id", requestID))
+	}
+
+	// Correlate logs with traces when there is an active span
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", spanCtx.TraceID().String()),
+			zap.String("span_id", spanCtx.SpanID().String()),
+		)
+	}
+
+	if len(fields) == 0 {
+		return Get()
 	}
-	return Get()
+	return Get().With(fields...)
 }
 
 // Sync flushes any buffered log entries
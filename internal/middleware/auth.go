@@ -2,16 +2,25 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"go-starter/internal/models"
+	"go-starter/internal/ctxkey"
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
 	"go-starter/internal/services"
+
+	"go.uber.org/zap"
 )
 
-type contextKey string
+// bearerRealm is the realm advertised in WWW-Authenticate challenges
+const bearerRealm = "api"
 
-const userIDKey contextKey = "user_id"
+// maxTokenLength caps the accepted bearer token size; our tokens are far smaller
+const maxTokenLength = 4096
 
 // AuthMiddleware creates a middleware that validates JWT tokens
 func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.Handler {
@@ -20,46 +29,93 @@ func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.H
 			// Get authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				respondWithError(w, http.StatusUnauthorized, "missing authorization header")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+bearerRealm+`"`)
+				httpx.WriteError(w, r, http.StatusUnauthorized, "missing authorization header", "")
 				return
 			}
 
-			// Check Bearer prefix
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				respondWithError(w, http.StatusUnauthorized, "invalid authorization header format")
+			// Extract the token, rejecting malformed headers before validation
+			token, detail := parseBearerToken(authHeader)
+			if detail != "" {
+				setBearerChallenge(w, "invalid_request", detail)
+				httpx.WriteError(w, r, http.StatusUnauthorized, "invalid authorization header format", detail)
 				return
 			}
 
-			token := parts[1]
-
-			// Validate token
-			userID, err := authService.ValidateToken(token)
+			// Validate token; expired tokens are reported separately so clients know to refresh
+			userID, err := authService.ValidateToken(r.Context(), token)
 			if err != nil {
-				respondWithError(w, http.StatusUnauthorized, "invalid or expired token")
+				if errors.Is(err, services.ErrTokenExpired) {
+					setBearerChallenge(w, "invalid_token", "the access token expired")
+					httpx.WriteError(w, r, http.StatusUnauthorized, "token expired", "")
+					return
+				}
+				if !errors.Is(err, services.ErrTokenInvalid) {
+					// The token is well-formed but its revocation couldn't be checked
+					logger.FromContext(r.Context()).Error("failed to validate token", zap.Error(err))
+					httpx.WriteError(w, r, http.StatusServiceUnavailable, "service unavailable", "")
+					return
+				}
+				setBearerChallenge(w, "invalid_token", "the access token is invalid")
+				httpx.WriteError(w, r, http.StatusUnauthorized, "invalid token", "")
 				return
 			}
 
 			// Add user ID to request context
-			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx := context.WithValue(r.Context(), ctxkey.UserID, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// GetUserIDFromContext retrieves the user ID from the request context
-func GetUserIDFromContext(ctx context.Context) (int, bool) {
-	userID, ok := ctx.Value(userIDKey).(int)
-	return userID, ok
+// BearerUserKey returns a function that identifies the user of a request by its
+// bearer token, for rate limit rules keyed by user. Requests without a valid
+// token are not identified.
+func BearerUserKey(authService *services.AuthService) func(*http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		token, detail := parseBearerToken(r.Header.Get("Authorization"))
+		if detail != "" {
+			return "", false
+		}
+
+		userID, err := authService.ValidateToken(r.Context(), token)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Itoa(userID), true
+	}
+}
+
+// setBearerChallenge sets the RFC 6750 WWW-Authenticate header for a failed bearer auth
+func setBearerChallenge(w http.ResponseWriter, code, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+		`Bearer realm="%s", error="%s", error_description="%s"`,
+		bearerRealm, code, strings.ReplaceAll(description, `"`, `'`),
+	))
 }
 
-// respondWithError sends an error response
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	response := models.ErrorResponse{
-		Error: message,
+// parseBearerToken extracts the token from a "Bearer <token>" header. When the
+// header is malformed it returns a description of the problem instead.
+func parseBearerToken(header string) (token, detail string) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", `expected "Bearer <token>"`
 	}
-	// Simple JSON encoding without importing encoding/json in middleware
-	w.Write([]byte(`{"error":"` + response.Error + `"}`))
+
+	switch {
+	case token == "":
+		return "", "bearer token is empty"
+	case strings.ContainsAny(token, " \t"):
+		return "", "bearer token must not contain whitespace"
+	case len(token) > maxTokenLength:
+		return "", "bearer token is too long"
+	}
+
+	return token, ""
+}
+
+// GetUserIDFromContext retrieves the user ID from the request context
+func GetUserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(ctxkey.UserID).(int)
+	return userID, ok
 }
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-starter/internal/ctxkey"
+	"go-starter/internal/logger"
+	"go-starter/internal/services"
+)
+
+func TestParseBearerToken(t *testing.T) {
+	long := strings.Repeat("a", maxTokenLength+1)
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		detail string
+	}{
+		{"valid", "Bearer abc.def.ghi", "abc.def.ghi", ""},
+		{"scheme case", "bearer abc", "abc", ""},
+		{"longest accepted", "Bearer " + long[:maxTokenLength], long[:maxTokenLength], ""},
+		{"no space", "Bearerabc", "", `expected "Bearer <token>"`},
+		{"scheme only", "Bearer", "", `expected "Bearer <token>"`},
+		{"other scheme", "Basic YWRtaW46cGFzcw==", "", `expected "Bearer <token>"`},
+		{"token only", "abc.def.ghi", "", `expected "Bearer <token>"`},
+		{"empty token", "Bearer ", "", "bearer token is empty"},
+		{"two spaces", "Bearer  abc", "", "bearer token must not contain whitespace"},
+		{"extra part", "Bearer a b", "", "bearer token must not contain whitespace"},
+		{"tab", "Bearer a\tb", "", "bearer token must not contain whitespace"},
+		{"too long", "Bearer " + long, "", "bearer token is too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, detail := parseBearerToken(tt.header)
+			if token != tt.token || detail != tt.detail {
+				t.Errorf("parseBearerToken = %q, %q, want %q, %q", token, detail, tt.token, tt.detail)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsMalformedHeaders(t *testing.T) {
+	authService := services.NewAuthService(nil, "test-secret-that-is-long-enough-for-hs256", nil, time.Minute, time.Hour, nil)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler called for a rejected request")
+	})
+	handler := LoggerMiddleware(0, nil)(AuthMiddleware(authService)(next))
+
+	tests := []struct {
+		name      string
+		header    string
+		error     string
+		challenge string
+	}{
+		{"missing", "", "missing authorization header", `Bearer realm="` + bearerRealm + `"`},
+		{"wrong scheme", "Basic YWRtaW46cGFzcw==", "invalid authorization header format", `error="invalid_request"`},
+		{"empty token", "Bearer ", "invalid authorization header format", `error_description="bearer token is empty"`},
+		{"extra part", "Bearer a b", "invalid authorization header format", `error_description="bearer token must not contain whitespace"`},
+		{"oversized", "Bearer " + strings.Repeat("a", 64<<10), "invalid authorization header format", `error_description="bearer token is too long"`},
+		{"invalid token", "Bearer not.a.jwt", "invalid token", `error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", rec.Code)
+			}
+			if body := decodeError(t, rec); body.Error != tt.error {
+				t.Errorf("error = %q, want %q", body.Error, tt.error)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.challenge) {
+				t.Errorf("WWW-Authenticate = %q, want containing %q", challenge, tt.challenge)
+			}
+		})
+	}
+}
+
+func TestRequestIDAndUserIDDoNotCollide(t *testing.T) {
+	ctx := logger.WithRequestID(context.Background(), "42")
+	if _, ok := GetUserIDFromContext(ctx); ok {
+		t.Error("request ID read back as a user ID")
+	}
+
+	ctx = context.WithValue(ctx, ctxkey.UserID, 7)
+	if userID, ok := GetUserIDFromContext(ctx); !ok || userID != 7 {
+		t.Errorf("GetUserIDFromContext = %d, %v, want 7", userID, ok)
+	}
+	if requestID := logger.RequestIDFromContext(ctx); requestID != "42" {
+		t.Errorf("RequestIDFromContext = %q, want 42", requestID)
+	}
+}
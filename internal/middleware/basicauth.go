@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"go-starter/internal/ctxkey"
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const basicAuthRealm = "restricted"
+
+// dummyHash is compared against when the username is unknown so that
+// failed lookups take roughly as long as a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// BasicAuthMiddleware creates a middleware that protects routes with HTTP basic auth.
+// users maps usernames to bcrypt password hashes. The authenticated username
+// is available from GetAdminFromContext.
+func BasicAuthMiddleware(users map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok || !checkBasicAuth(users, username, password) {
+				logger.FromContext(r.Context()).Warn("basic auth failed",
+					zap.String("username", username),
+					zap.String("client_ip", getClientIP(r)),
+					zap.String("path", r.URL.Path),
+					zap.String("method", r.Method),
+				)
+
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+basicAuthRealm+`", charset="UTF-8"`)
+				httpx.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxkey.Admin, username)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetAdminFromContext returns the basic auth username of the request
+func GetAdminFromContext(ctx context.Context) (string, bool) {
+	admin, ok := ctx.Value(ctxkey.Admin).(string)
+	return admin, ok
+}
+
+// checkBasicAuth verifies the credentials against the configured users
+func checkBasicAuth(users map[string]string, username, password string) bool {
+	// Compare against every username so lookup time doesn't reveal which exist
+	var hash string
+	for name, h := range users {
+		if subtle.ConstantTimeCompare([]byte(name), []byte(username)) == 1 {
+			hash = h
+		}
+	}
+
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
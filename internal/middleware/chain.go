@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Chain is an ordered list of middleware; the first entry runs outermost, so
+// NewChain(a, b).Then(h) is a(b(h)). Building the global stack once as a
+// Chain keeps its order the same on every router and fallback handler.
+type Chain []func(http.Handler) http.Handler
+
+// NewChain creates a chain of middleware. Nil entries are skipped so that
+// optional middleware can be passed unconditionally.
+func NewChain(middleware ...func(http.Handler) http.Handler) Chain {
+	return Chain(nil).Append(middleware...)
+}
+
+// Append returns a new chain running middleware after (inside) those of c
+func (c Chain) Append(middleware ...func(http.Handler) http.Handler) Chain {
+	chain := make(Chain, 0, len(c)+len(middleware))
+	chain = append(chain, c...)
+	for _, mw := range middleware {
+		if mw != nil {
+			chain = append(chain, mw)
+		}
+	}
+	return chain
+}
+
+// Then wraps h in the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// Apply adds the chain to r in order. Like any router middleware it only
+// runs for matched routes; wrap the NotFound and MethodNotAllowed handlers
+// with Then.
+func (c Chain) Apply(r *mux.Router) {
+	for _, mw := range c {
+		r.Use(mux.MiddlewareFunc(mw))
+	}
+}
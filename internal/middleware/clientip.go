@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"go-starter/internal/ctxkey"
+)
+
+// DefaultRealIPHeaders is the header preference used when none is configured
+var DefaultRealIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// ClientIPMiddleware creates a middleware that resolves the client IP address once
+// per request and stores it in the context. headers are consulted in order of
+// preference only when the connection comes from one of trusted; otherwise the
+// connection's address is used, so clients can't spoof their IP.
+// It should run before any middleware that logs or limits by client IP.
+func ClientIPMiddleware(headers []string, trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, headers, trusted)
+			ctx := context.WithValue(r.Context(), ctxkey.ClientIP, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetClientIPFromContext retrieves the resolved client IP from the request context
+func GetClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ctxkey.ClientIP).(string)
+	return ip, ok
+}
+
+// getClientIP returns the client IP resolved by ClientIPMiddleware, falling back
+// to the connection's address when the middleware is not installed
+func getClientIP(r *http.Request) string {
+	if ip, ok := GetClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	return resolveClientIP(r, nil, nil)
+}
+
+// resolveClientIP returns the client IP from the first of headers present
+// when the connection comes from a trusted proxy, or the connection's
+// address otherwise
+func resolveClientIP(r *http.Request, headers []string, trusted []*net.IPNet) string {
+	remote := remoteIP(r)
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+
+	for _, header := range headers {
+		if ip := forwardedClient(r.Header.Values(header), trusted); ip != "" {
+			return ip
+		}
+	}
+	return remote
+}
+
+// forwardedClient returns the client address from the values of a header such
+// as X-Forwarded-For, where each proxy appends the address it received from.
+// Walking from the right, it skips trusted proxies and returns the first
+// other address, since anything left of that may have been sent by the client.
+func forwardedClient(values []string, trusted []*net.IPNet) string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if i == 0 || !isTrusted(hops[i], trusted) {
+			return hops[i]
+		}
+	}
+	return ""
+}
+
+// isTrusted reports whether addr is inside one of trusted
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address of the request's connection, which reflects
+// the PROXY protocol source when enabled
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromTrustedProxy reports whether the request's connection comes from one of trusted
+func fromTrustedProxy(r *http.Request, trusted []*net.IPNet) bool {
+	return isTrusted(remoteIP(r), trusted)
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func mustCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s): %v", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := mustCIDRs(t, "10.0.0.0/8")
+	headers := []string{"CF-Connecting-IP", "X-Forwarded-For", "X-Real-IP"}
+
+	tests := []struct {
+		name   string
+		remote string
+		header map[string]string
+		want   string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer spoofing XFF", "203.0.113.5:4000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.5"},
+		{"untrusted peer spoofing CF", "203.0.113.5:4000", map[string]string{"CF-Connecting-IP": "1.2.3.4"}, "203.0.113.5"},
+		{"untrusted peer spoofing X-Real-IP", "203.0.113.5:4000", map[string]string{"X-Real-IP": "1.2.3.4"}, "203.0.113.5"},
+		{"trusted proxy XFF", "10.0.0.2:4000", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"trusted proxy prefers CF", "10.0.0.2:4000", map[string]string{"CF-Connecting-IP": "198.51.100.8", "X-Forwarded-For": "198.51.100.7"}, "198.51.100.8"},
+		{"trusted proxy falls back to X-Real-IP", "10.0.0.2:4000", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"trusted proxy without headers", "10.0.0.2:4000", nil, "10.0.0.2"},
+		// The client prepended a fake hop; the proxy appended the real one
+		{"spoofed hop left of the real client", "10.0.0.2:4000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.2:4000", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.9, 10.0.0.3"}, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.2:4000", map[string]string{"X-Forwarded-For": "10.0.0.9, 10.0.0.3"}, "10.0.0.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			if got := resolveClientIP(req, headers, trusted); got != tt.want {
+				t.Errorf("resolveClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveClientIPWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := resolveClientIP(req, DefaultRealIPHeaders, nil); got != "10.0.0.2" {
+		t.Errorf("resolveClientIP = %q, want the peer address when no proxy is trusted", got)
+	}
+}
+
+func TestClientIPMiddlewareFeedsRateLimiterAndLogs(t *testing.T) {
+	trusted := mustCIDRs(t, "10.0.0.0/8")
+	limiter := NewRateLimiter(1, 1, nil)
+	recorder := &clientRecorder{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := ClientIPMiddleware([]string{"X-Forwarded-For"}, trusted)(
+		LoggerMiddleware(0, recorder)(limiter.Middleware()(ok)))
+
+	// Two clients behind the same proxy get separate limits
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.2:4000"
+		req.Header.Set("X-Forwarded-For", client)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("client %s: status %d, want 200", client, rec.Code)
+		}
+		if recorder.client != client {
+			t.Errorf("logged client %q, want %q", recorder.client, client)
+		}
+	}
+}
+
+// clientRecorder is a RequestRecorder keeping the last client
+type clientRecorder struct{ client string }
+
+func (r *clientRecorder) Record(client string, status int, duration time.Duration) { r.client = client }
+
+func TestProxyProtocolSetsRemoteAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	seen := make(chan string, 1)
+	srv := &http.Server{Handler: ClientIPMiddleware(nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- getClientIP(r)
+	}))}
+	go func() { _ = srv.Serve(&proxyproto.Listener{Listener: ln}) }()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	// A load balancer announces the original client before the HTTP request
+	header := &proxyproto.Header{
+		Version:           1,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("198.51.100.20"), Port: 5555},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80},
+	}
+	if _, err := header.WriteTo(conn); err != nil {
+		t.Fatalf("write PROXY header: %v", err)
+	}
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+
+	if got := <-seen; got != "198.51.100.20" {
+		t.Errorf("client IP = %q, want the PROXY protocol source", got)
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+// ConcurrencyLimiter bounds the number of requests handled at the same time
+type ConcurrencyLimiter struct {
+	sem          *semaphore.Weighted
+	queueTimeout time.Duration
+	inFlight     atomic.Int64
+	rejected     atomic.Int64
+}
+
+// NewConcurrencyLimiter creates a limiter allowing maxInFlight concurrent requests.
+// Requests beyond the limit wait up to queueTimeout for a free slot; with a
+// zero queueTimeout they are rejected at once.
+func NewConcurrencyLimiter(maxInFlight int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		sem:          semaphore.NewWeighted(int64(maxInFlight)),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// InFlight returns the number of requests currently being handled
+func (cl *ConcurrencyLimiter) InFlight() int64 {
+	return cl.inFlight.Load()
+}
+
+// Rejected returns the total number of requests rejected by the limiter
+func (cl *ConcurrencyLimiter) Rejected() int64 {
+	return cl.rejected.Load()
+}
+
+// Middleware returns a middleware that enforces the concurrency limit
+func (cl *ConcurrencyLimiter) Middleware() func(http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(cl.queueTimeout.Seconds()))))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := cl.acquire(r.Context()); err != nil {
+				cl.rejected.Add(1)
+
+				logger.FromContext(r.Context()).Warn("concurrency limit exceeded",
+					zap.String("path", r.URL.Path),
+					zap.String("method", r.Method),
+					zap.Int64("in_flight", cl.InFlight()),
+				)
+
+				w.Header().Set("Retry-After", retryAfter)
+				httpx.WriteError(w, r, http.StatusServiceUnavailable, "service unavailable", "server is at capacity")
+				return
+			}
+
+			cl.inFlight.Add(1)
+			defer func() {
+				cl.inFlight.Add(-1)
+				cl.sem.Release(1)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquire takes a slot, waiting up to queueTimeout when none is free. A free
+// slot is taken even when the wait has no time left.
+func (cl *ConcurrencyLimiter) acquire(ctx context.Context) error {
+	if cl.sem.TryAcquire(1) {
+		return nil
+	}
+	if cl.queueTimeout <= 0 {
+		return context.DeadlineExceeded
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cl.queueTimeout)
+	defer cancel()
+	return cl.sem.Acquire(ctx, 1)
+}
+
+// ConcurrencyLimitMiddleware creates a middleware that limits concurrent requests
+func ConcurrencyLimitMiddleware(maxInFlight int, queueTimeout time.Duration) func(http.Handler) http.Handler {
+	return NewConcurrencyLimiter(maxInFlight, queueTimeout).Middleware()
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterZeroQueueTimeout(t *testing.T) {
+	cl := NewConcurrencyLimiter(1, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := cl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// A free slot is taken even though the queue timeout is zero
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status with a free slot = %d, want 200", rec.Code)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+
+	// With the only slot busy the request is rejected without waiting
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status at capacity = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if cl.Rejected() != 1 {
+		t.Errorf("Rejected() = %d, want 1", cl.Rejected())
+	}
+
+	close(release)
+	<-done
+}
+
+func TestConcurrencyLimiterQueues(t *testing.T) {
+	cl := NewConcurrencyLimiter(1, time.Second)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := cl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-started
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+	// The queued request gets the slot once the first one finishes
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status after queueing = %d, want 200", rec.Code)
+	}
+}
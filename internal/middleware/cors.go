@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const corsMaxAge = 10 * 60
+
+var (
+	corsAllowedMethods = []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"}
+	corsAllowedHeaders = []string{"Authorization", "Content-Type", "Accept-Language", "X-Request-ID", "If-None-Match", IdempotencyKeyHeader}
+)
+
+// CORSMiddleware allows cross-origin requests from allowedOrigins ("*" allows
+// any origin) and answers preflight requests. It must wrap the router rather
+// than be added with Use, since preflight requests don't match any route.
+func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	allowAny := slices.Contains(allowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowAny && !slices.Contains(allowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			// Preflight
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Link, X-Total-Count, ETag, "+idempotentReplayedHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Drainer tracks in-flight requests and whether the server is shutting down,
+// so readiness can fail while remaining requests drain
+type Drainer struct {
+	inFlight atomic.Int64
+	draining atomic.Bool
+}
+
+// NewDrainer creates a new drainer
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// StartDraining marks the server as shutting down
+func (d *Drainer) StartDraining() {
+	d.draining.Store(true)
+}
+
+// Draining reports whether the server is shutting down
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// InFlight returns the number of requests currently being handled
+func (d *Drainer) InFlight() int64 {
+	return d.inFlight.Load()
+}
+
+// Middleware returns a middleware that counts in-flight requests
+func (d *Drainer) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d.inFlight.Add(1)
+			defer d.inFlight.Add(-1)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
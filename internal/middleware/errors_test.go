@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-starter/internal/models"
+	"go-starter/internal/services"
+)
+
+// decodeError unmarshals an error response body, failing t when it isn't
+// valid ErrorResponse JSON with an error and a request ID
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+	var body models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not valid JSON: %v\n%s", err, rec.Body.String())
+	}
+	if body.Error == "" {
+		t.Errorf("error is empty in %s", rec.Body.String())
+	}
+	if body.RequestID == "" || body.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Errorf("request_id = %q, want the X-Request-ID header %q", body.RequestID, rec.Header().Get("X-Request-ID"))
+	}
+	return body
+}
+
+func TestMiddlewareErrorsAreJSON(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	authService := services.NewAuthService(nil, "test-secret-that-is-long-enough-for-hs256", nil, time.Minute, time.Hour, nil)
+	limiter := NewRateLimiter(1, 1, nil)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		header  map[string]string
+		status  int
+		repeat  int
+	}{
+		{"missing bearer token", AuthMiddleware(authService)(ok), nil, http.StatusUnauthorized, 1},
+		// A quote in the detail must not break the JSON
+		{"malformed bearer header", AuthMiddleware(authService)(ok), map[string]string{"Authorization": `Token "abc"`}, http.StatusUnauthorized, 1},
+		{"invalid bearer token", AuthMiddleware(authService)(ok), map[string]string{"Authorization": "Bearer not.a.jwt"}, http.StatusUnauthorized, 1},
+		{"missing basic auth", BasicAuthMiddleware(map[string]string{"admin": "hash"})(ok), nil, http.StatusUnauthorized, 1},
+		{"rate limited", limiter.Middleware()(ok), nil, http.StatusTooManyRequests, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The request logger sets the request ID the error bodies carry
+			handler := LoggerMiddleware(0, nil)(tt.handler)
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.repeat; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = "192.0.2.10:1234"
+				for name, value := range tt.header {
+					req.Header.Set(name, value)
+				}
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+			}
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			decodeError(t, rec)
+		})
+	}
+}
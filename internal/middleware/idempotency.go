@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a retryable request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks responses replayed from the store
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds keys; UUIDs and similar fit comfortably
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize is the largest request body fingerprinted, matching
+	// the handlers' JSON body limit
+	maxIdempotentBodySize = 1 << 20
+	// idempotencySweepInterval is how often expired responses are dropped
+	idempotencySweepInterval = time.Minute
+)
+
+// Idempotency replays the stored response of a request when it is retried
+// with the same Idempotency-Key header, so a retry after a lost response
+// doesn't repeat its side effects. Keys are scoped to the caller, so clients
+// choosing the same key don't see each other's responses. Requests sharing a
+// key are serialized: a retry arriving while the original is in flight waits
+// for its response. Requests without the header are passed through unchanged.
+type Idempotency struct {
+	mu         sync.Mutex
+	entries    map[string]*idempotentEntry
+	ttl        time.Duration
+	maxEntries int
+	lastSweep  time.Time
+	// callerKey identifies authenticated callers; others are scoped by client IP
+	callerKey func(*http.Request) (string, bool)
+}
+
+// idempotentEntry is the state of one key: in flight until done is closed,
+// then the recorded response until expires
+type idempotentEntry struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	response    *recordedResponse
+	expires     time.Time
+}
+
+// recordedResponse is a response captured for replay
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewIdempotency creates a store keeping responses for ttl, holding at most
+// maxEntries keys
+func NewIdempotency(ttl time.Duration, maxEntries int) *Idempotency {
+	return &Idempotency{
+		entries:    make(map[string]*idempotentEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		lastSweep:  time.Now(),
+	}
+}
+
+// SetCallerKeyFunc sets how authenticated callers are identified. fn returns
+// false for unauthenticated requests, whose keys are then scoped by client IP.
+// It must be called before the middleware serves requests.
+func (id *Idempotency) SetCallerKeyFunc(fn func(*http.Request) (string, bool)) {
+	id.callerKey = fn
+}
+
+// Middleware returns a middleware that replays stored responses for repeated
+// Idempotency-Key values. Reusing a key with a different request body is
+// rejected with 422. Server errors are not stored, so they can be retried;
+// requests that waited for one are answered with 409 and should retry too.
+func (id *Idempotency) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				httpx.WriteError(w, r, http.StatusBadRequest, "invalid idempotency key", "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			// Fingerprint the body, leaving it readable for the handler
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+			if err != nil {
+				httpx.WriteError(w, r, http.StatusBadRequest, "invalid request body", "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			fingerprint := sha256.Sum256(body)
+
+			// Keys are scoped to the caller and the route, so one client can't
+			// replay another's response or another endpoint
+			storeKey := id.caller(r) + " " + r.Method + " " + r.URL.Path + " " + key
+
+			entry, owner := id.acquire(storeKey, fingerprint, time.Now())
+			switch {
+			case entry == nil:
+				// The store is full; serve without idempotency rather than fail
+				logger.FromContext(r.Context()).Warn("idempotency store full, key not recorded",
+					zap.Int("max_entries", id.maxEntries),
+				)
+				next.ServeHTTP(w, r)
+				return
+
+			case entry.fingerprint != fingerprint:
+				httpx.WriteError(w, r, http.StatusUnprocessableEntity, "idempotency key reused with a different request",
+					"Idempotency-Key was already used with a different request body")
+				return
+
+			case owner:
+				rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+				defer func() {
+					id.complete(storeKey, entry, rec, time.Now())
+				}()
+				next.ServeHTTP(rec, r)
+				return
+			}
+
+			// Wait for the original request to finish
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			if entry.response == nil {
+				// The original request failed and wasn't stored; the key is free
+				// again, so the client's next retry runs the request
+				httpx.WriteError(w, r, http.StatusConflict, "idempotent request failed",
+					"the request with this Idempotency-Key failed while this one waited; retry it")
+				return
+			}
+			entry.response.replay(w)
+		})
+	}
+}
+
+// caller identifies the client a key belongs to: the authenticated caller
+// when there is one, otherwise the client IP
+func (id *Idempotency) caller(r *http.Request) string {
+	if id.callerKey != nil {
+		if user, ok := id.callerKey(r); ok {
+			return "user:" + user
+		}
+	}
+	return "ip:" + getClientIP(r)
+}
+
+// acquire returns the entry for key, creating it when missing or expired, in
+// which case owner is true and the caller must complete it. It returns nil
+// when the store is full.
+func (id *Idempotency) acquire(key string, fingerprint [sha256.Size]byte, now time.Time) (entry *idempotentEntry, owner bool) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	id.sweepLocked(now)
+
+	if entry, ok := id.entries[key]; ok {
+		if entry.response == nil || now.Before(entry.expires) {
+			return entry, false
+		}
+		delete(id.entries, key)
+	}
+	if len(id.entries) >= id.maxEntries {
+		return nil, false
+	}
+
+	entry = &idempotentEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	id.entries[key] = entry
+	return entry, true
+}
+
+// complete stores the response recorded for key and releases waiting
+// retries. Server errors, and handlers that panicked, are forgotten instead.
+func (id *Idempotency) complete(key string, entry *idempotentEntry, rec *recordingWriter, now time.Time) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	if rec.wroteHeader && rec.status < http.StatusInternalServerError {
+		entry.response = &recordedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes()}
+		entry.expires = now.Add(id.ttl)
+	} else {
+		delete(id.entries, key)
+	}
+	close(entry.done)
+}
+
+// sweepLocked drops expired responses, at most once per idempotencySweepInterval
+func (id *Idempotency) sweepLocked(now time.Time) {
+	if now.Sub(id.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	id.lastSweep = now
+
+	for key, entry := range id.entries {
+		if entry.response != nil && !now.Before(entry.expires) {
+			delete(id.entries, key)
+		}
+	}
+}
+
+// replay writes the recorded response, marked as replayed. The request ID of
+// the current request is kept.
+func (rr *recordedResponse) replay(w http.ResponseWriter) {
+	for name, values := range rr.header {
+		if name == "X-Request-Id" {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(rr.status)
+	_, _ = w.Write(rr.body)
+}
+
+// recordingWriter passes a response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.header = w.ResponseWriter.Header().Clone()
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// idempotentRequest builds a registration from remote with key and body
+func idempotentRequest(remote, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(body))
+	req.RemoteAddr = remote + ":1234"
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req
+}
+
+// countingHandler answers 201 with the request body and counts its calls
+func countingHandler(calls *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	})
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	var calls atomic.Int64
+	handler := NewIdempotency(time.Hour, 100).Middleware()(countingHandler(&calls))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest("192.0.2.1", "k1", `{"a":1}`))
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest("192.0.2.1", "k1", `{"a":1}`))
+
+	if calls.Load() != 1 {
+		t.Errorf("handler calls = %d, want 1", calls.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != `{"a":1}` {
+		t.Errorf("replay = %d %q, want 201 with the original body", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("replay is missing %s", idempotentReplayedHeader)
+	}
+
+	reused := httptest.NewRecorder()
+	handler.ServeHTTP(reused, idempotentRequest("192.0.2.1", "k1", `{"a":2}`))
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body: status %d, want 422", reused.Code)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheCaller(t *testing.T) {
+	var calls atomic.Int64
+	id := NewIdempotency(time.Hour, 100)
+	id.SetCallerKeyFunc(func(r *http.Request) (string, bool) {
+		user := r.Header.Get("X-Test-User")
+		return user, user != ""
+	})
+	handler := id.Middleware()(countingHandler(&calls))
+
+	// Two anonymous clients and two users behind one IP pick the same key
+	requests := []*http.Request{
+		idempotentRequest("192.0.2.1", "shared", `{"client":1}`),
+		idempotentRequest("192.0.2.2", "shared", `{"client":2}`),
+		idempotentRequest("192.0.2.3", "shared", `{"client":3}`),
+		idempotentRequest("192.0.2.3", "shared", `{"client":4}`),
+	}
+	requests[2].Header.Set("X-Test-User", "7")
+	requests[3].Header.Set("X-Test-User", "8")
+
+	for _, req := range requests {
+		body, _ := io.ReadAll(req.Body)
+		req.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated || rec.Body.String() != string(body) {
+			t.Errorf("%s: got %d %q, want 201 with its own body", body, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get(idempotentReplayedHeader) != "" {
+			t.Errorf("%s: response replayed from another caller", body)
+		}
+	}
+	if calls.Load() != int64(len(requests)) {
+		t.Errorf("handler calls = %d, want %d", calls.Load(), len(requests))
+	}
+}
+
+func TestIdempotencyWaiterGetsErrorWhenOriginalFails(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int64
+	handler := NewIdempotency(time.Hour, 100).Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	original := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(original, idempotentRequest("192.0.2.1", "k", "{}"))
+	}()
+	<-started
+
+	waiter := httptest.NewRecorder()
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		handler.ServeHTTP(waiter, idempotentRequest("192.0.2.1", "k", "{}"))
+	}()
+	// Let the waiter reach the in-flight entry before the original fails
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+	<-waited
+
+	if original.Code != http.StatusInternalServerError {
+		t.Fatalf("original status = %d, want 500", original.Code)
+	}
+	if waiter.Code != http.StatusConflict {
+		t.Errorf("waiter status = %d, want 409", waiter.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler calls = %d, want 1; the waiter must not rerun the request", calls.Load())
+	}
+
+	// The failure wasn't stored, so a later retry runs the request
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, idempotentRequest("192.0.2.1", "k", "{}"))
+	if retry.Code != http.StatusCreated {
+		t.Errorf("retry status = %d, want 201", retry.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-starter/internal/i18n"
+)
+
+// LocaleMiddleware creates a middleware that negotiates the response locale
+// from the Accept-Language header and stores it in the request context
+func LocaleMiddleware(supported []string, fallback string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale := negotiateLocale(r.Header.Get("Accept-Language"), supported, fallback)
+
+			w.Header().Set("Content-Language", locale)
+			w.Header().Add("Vary", "Accept-Language")
+
+			ctx := i18n.WithLocale(r.Context(), locale)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// languageRange is a single Accept-Language entry with its quality value
+type languageRange struct {
+	tag     string
+	quality float64
+}
+
+// negotiateLocale picks the best supported locale for an Accept-Language header
+func negotiateLocale(header string, supported []string, fallback string) string {
+	ranges := parseAcceptLanguage(header)
+
+	for _, lr := range ranges {
+		if lr.tag == "*" {
+			return fallback
+		}
+
+		// Exact match first, then the primary subtag (e.g. "es-MX" -> "es")
+		primary, _, _ := strings.Cut(lr.tag, "-")
+		for _, candidate := range []string{lr.tag, primary} {
+			for _, locale := range supported {
+				if strings.EqualFold(locale, candidate) {
+					return locale
+				}
+			}
+		}
+	}
+
+	return fallback
+}
+
+// parseAcceptLanguage parses an Accept-Language header ordered by quality
+func parseAcceptLanguage(header string) []languageRange {
+	var ranges []languageRange
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, languageRange{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	return ranges
+}
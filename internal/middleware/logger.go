@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -28,12 +31,120 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-// LoggerMiddleware creates a middleware that logs HTTP requests
-func LoggerMiddleware() func(http.Handler) http.Handler {
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) flush() {
+	rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (rw *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return rw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (rw *responseWriter) readFrom(src io.Reader) (int64, error) {
+	n, err := rw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rw.written += n
+	return n, err
+}
+
+type flusherWriter struct{ *responseWriter }
+
+func (w flusherWriter) Flush() { w.flush() }
+
+type hijackerWriter struct{ *responseWriter }
+
+func (w hijackerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type readerFromWriter struct{ *responseWriter }
+
+func (w readerFromWriter) ReadFrom(src io.Reader) (int64, error) { return w.readFrom(src) }
+
+type flusherHijackerWriter struct{ *responseWriter }
+
+func (w flusherHijackerWriter) Flush() { w.flush() }
+func (w flusherHijackerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+type flusherReaderFromWriter struct{ *responseWriter }
+
+func (w flusherReaderFromWriter) Flush() { w.flush() }
+func (w flusherReaderFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.readFrom(src)
+}
+
+type hijackerReaderFromWriter struct{ *responseWriter }
+
+func (w hijackerReaderFromWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+func (w hijackerReaderFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.readFrom(src)
+}
+
+type flusherHijackerReaderFromWriter struct{ *responseWriter }
+
+func (w flusherHijackerReaderFromWriter) Flush() { w.flush() }
+func (w flusherHijackerReaderFromWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+func (w flusherHijackerReaderFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.readFrom(src)
+}
+
+// wrapResponseWriter wraps w so that status code and bytes written are recorded,
+// while preserving the optional http.Flusher, http.Hijacker and io.ReaderFrom
+// interfaces implemented by w.
+func wrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *responseWriter) {
+	rw := &responseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+
+	_, isFlusher := w.(http.Flusher)
+	_, isHijacker := w.(http.Hijacker)
+	_, isReaderFrom := w.(io.ReaderFrom)
+
+	switch {
+	case isFlusher && isHijacker && isReaderFrom:
+		return flusherHijackerReaderFromWriter{rw}, rw
+	case isFlusher && isHijacker:
+		return flusherHijackerWriter{rw}, rw
+	case isFlusher && isReaderFrom:
+		return flusherReaderFromWriter{rw}, rw
+	case isHijacker && isReaderFrom:
+		return hijackerReaderFromWriter{rw}, rw
+	case isFlusher:
+		return flusherWriter{rw}, rw
+	case isHijacker:
+		return hijackerWriter{rw}, rw
+	case isReaderFrom:
+		return readerFromWriter{rw}, rw
+	default:
+		return rw, rw
+	}
+}
+
+// RequestRecorder receives a summary of every completed request
+type RequestRecorder interface {
+	Record(client string, status int, duration time.Duration)
+}
+
+// LoggerMiddleware creates a middleware that logs HTTP requests.
+// Requests slower than slowThreshold are logged at warn level and
+// requests ending in a 5xx status are logged at error level.
+// recorder is optional and is fed every completed request.
+func LoggerMiddleware(slowThreshold time.Duration, recorder RequestRecorder) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Generate request ID
-			requestID := uuid.New().String()
+			// Reuse an upstream request ID when valid, otherwise generate one
+			requestID := r.Header.Get("X-Request-ID")
+			if !isValidRequestID(requestID) {
+				requestID = uuid.New().String()
+			}
 
 			// Add request ID to context
 			ctx := logger.WithRequestID(r.Context(), requestID)
@@ -43,16 +154,13 @@ func LoggerMiddleware() func(http.Handler) http.Handler {
 			w.Header().Set("X-Request-ID", requestID)
 
 			// Wrap response writer to capture status code
-			rw := &responseWriter{
-				ResponseWriter: w,
-				statusCode:     http.StatusOK,
-			}
+			ww, rw := wrapResponseWriter(w)
 
 			// Start timer
 			start := time.Now()
 
 			// Call next handler
-			next.ServeHTTP(rw, r)
+			next.ServeHTTP(ww, r)
 
 			// Calculate duration
 			duration := time.Since(start)
@@ -60,17 +168,58 @@ func LoggerMiddleware() func(http.Handler) http.Handler {
 			// Get client IP
 			clientIP := getClientIP(r)
 
-			// Log request
-			logger.FromContext(ctx).Info("http request",
+			if recorder != nil {
+				recorder.Record(clientIP, rw.statusCode, duration)
+			}
+
+			fields := []zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.String("query", r.URL.RawQuery),
 				zap.Int("status", rw.statusCode),
 				zap.Duration("duration", duration),
+				zap.Float64("duration_ms", float64(duration)/float64(time.Millisecond)),
 				zap.String("client_ip", clientIP),
 				zap.String("user_agent", r.UserAgent()),
 				zap.Int64("bytes_written", rw.written),
-			)
+			}
+
+			slow := slowThreshold > 0 && duration > slowThreshold
+			if slow {
+				fields = append(fields, zap.Bool("slow_request", true))
+			}
+
+			// Log request
+			log := logger.FromContext(ctx)
+			switch {
+			case rw.statusCode >= http.StatusInternalServerError:
+				log.Error("http request", fields...)
+			case slow:
+				log.Warn("http request", fields...)
+			default:
+				log.Info("http request", fields...)
+			}
 		})
 	}
 }
+
+// maxRequestIDLength bounds accepted upstream request IDs
+const maxRequestIDLength = 128
+
+// isValidRequestID reports whether an incoming request ID is safe to reuse
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-starter/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// fakeWriter records calls to the optional interfaces
+type fakeWriter struct {
+	*httptest.ResponseRecorder
+	flushed  int
+	hijacked int
+	readFrom int
+}
+
+func (w *fakeWriter) flush() { w.flushed++ }
+
+func (w *fakeWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked++
+	return nil, nil, nil
+}
+
+func (w *fakeWriter) readFromSrc(src io.Reader) (int64, error) {
+	w.readFrom++
+	return io.Copy(w.ResponseRecorder.Body, src)
+}
+
+// plainWriter implements only http.ResponseWriter; the field isn't embedded
+// so ResponseRecorder's Flush isn't promoted
+type plainWriter struct{ f *fakeWriter }
+
+func (w plainWriter) Header() http.Header         { return w.f.Header() }
+func (w plainWriter) Write(b []byte) (int, error) { return w.f.Write(b) }
+func (w plainWriter) WriteHeader(code int)        { w.f.WriteHeader(code) }
+
+type allWriter struct{ plainWriter }
+
+func (w allWriter) Flush()                                       { w.f.flush() }
+func (w allWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.f.hijack() }
+func (w allWriter) ReadFrom(src io.Reader) (int64, error)        { return w.f.readFromSrc(src) }
+
+type flushOnlyWriter struct{ plainWriter }
+
+func (w flushOnlyWriter) Flush() { w.f.flush() }
+
+type hijackOnlyWriter struct{ plainWriter }
+
+func (w hijackOnlyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.f.hijack() }
+
+type readerFromOnlyWriter struct{ plainWriter }
+
+func (w readerFromOnlyWriter) ReadFrom(src io.Reader) (int64, error) { return w.f.readFromSrc(src) }
+
+type flushHijackWriter struct{ hijackOnlyWriter }
+
+func (w flushHijackWriter) Flush() { w.f.flush() }
+
+type flushReaderFromWriter struct{ readerFromOnlyWriter }
+
+func (w flushReaderFromWriter) Flush() { w.f.flush() }
+
+type hijackReaderFromWriter struct{ readerFromOnlyWriter }
+
+func (w hijackReaderFromWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.f.hijack() }
+
+func TestWrapResponseWriterPreservesInterfaces(t *testing.T) {
+	tests := []struct {
+		name                      string
+		wrap                      func(*fakeWriter) http.ResponseWriter
+		flusher, hijacker, reader bool
+	}{
+		{"plain", func(f *fakeWriter) http.ResponseWriter { return plainWriter{f} }, false, false, false},
+		{"all", func(f *fakeWriter) http.ResponseWriter { return allWriter{plainWriter{f}} }, true, true, true},
+		{"flusher", func(f *fakeWriter) http.ResponseWriter { return flushOnlyWriter{plainWriter{f}} }, true, false, false},
+		{"hijacker", func(f *fakeWriter) http.ResponseWriter { return hijackOnlyWriter{plainWriter{f}} }, false, true, false},
+		{"reader from", func(f *fakeWriter) http.ResponseWriter { return readerFromOnlyWriter{plainWriter{f}} }, false, false, true},
+		{"flusher hijacker", func(f *fakeWriter) http.ResponseWriter { return flushHijackWriter{hijackOnlyWriter{plainWriter{f}}} }, true, true, false},
+		{"flusher reader from", func(f *fakeWriter) http.ResponseWriter {
+			return flushReaderFromWriter{readerFromOnlyWriter{plainWriter{f}}}
+		}, true, false, true},
+		{"hijacker reader from", func(f *fakeWriter) http.ResponseWriter {
+			return hijackReaderFromWriter{readerFromOnlyWriter{plainWriter{f}}}
+		}, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+			ww, rw := wrapResponseWriter(tt.wrap(fake))
+
+			flusher, isFlusher := ww.(http.Flusher)
+			hijacker, isHijacker := ww.(http.Hijacker)
+			readerFrom, isReaderFrom := ww.(io.ReaderFrom)
+			if isFlusher != tt.flusher || isHijacker != tt.hijacker || isReaderFrom != tt.reader {
+				t.Fatalf("wrapper implements Flusher=%v Hijacker=%v ReaderFrom=%v, want %v %v %v",
+					isFlusher, isHijacker, isReaderFrom, tt.flusher, tt.hijacker, tt.reader)
+			}
+
+			if isFlusher {
+				flusher.Flush()
+				if fake.flushed != 1 {
+					t.Errorf("Flush reached the underlying writer %d times, want 1", fake.flushed)
+				}
+			}
+			if isHijacker {
+				if _, _, err := hijacker.Hijack(); err != nil || fake.hijacked != 1 {
+					t.Errorf("Hijack reached the underlying writer %d times (err %v), want 1", fake.hijacked, err)
+				}
+			}
+
+			// Bytes are counted whichever path writes them
+			_, _ = ww.Write([]byte("hello "))
+			want := int64(len("hello "))
+			if isReaderFrom {
+				if _, err := readerFrom.ReadFrom(strings.NewReader("world")); err != nil || fake.readFrom != 1 {
+					t.Errorf("ReadFrom reached the underlying writer %d times (err %v), want 1", fake.readFrom, err)
+				}
+				want += int64(len("world"))
+			}
+			if rw.written != want {
+				t.Errorf("written = %d, want %d", rw.written, want)
+			}
+		})
+	}
+}
+
+func TestLoggerMiddlewareFlushesAndCounts(t *testing.T) {
+	fake := &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+	recorder := &statusRecorder{}
+	handler := LoggerMiddleware(0, recorder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("event: ping\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush through the middleware: %v", err)
+		}
+	}))
+
+	handler.ServeHTTP(allWriter{plainWriter{fake}}, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	if fake.flushed != 1 {
+		t.Errorf("Flush reached the underlying writer %d times, want 1", fake.flushed)
+	}
+	if recorder.status != http.StatusAccepted {
+		t.Errorf("recorded status = %d, want 202", recorder.status)
+	}
+}
+
+// statusRecorder is a RequestRecorder keeping the last status
+type statusRecorder struct{ status int }
+
+func (r *statusRecorder) Record(client string, status int, duration time.Duration) { r.status = status }
+
+func TestLoggerMiddlewareRequestID(t *testing.T) {
+	var seen string
+	handler := LoggerMiddleware(0, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logger.RequestIDFromContext(r.Context())
+	}))
+	serve := func(inbound string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if inbound != "" {
+			req.Header.Set("X-Request-ID", inbound)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Request-ID"); got != seen {
+			t.Errorf("echoed X-Request-ID %q differs from the context's %q", got, seen)
+		}
+		return seen
+	}
+
+	t.Run("present", func(t *testing.T) {
+		for _, id := range []string{"gw-7f3a9c", "a1b2c3d4-e5f6-7890-abcd-ef0123456789", "trace:span.1_x"} {
+			if got := serve(id); got != id {
+				t.Errorf("request ID = %q, want inbound %q", got, id)
+			}
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		first, second := serve(""), serve("")
+		if _, err := uuid.Parse(first); err != nil {
+			t.Errorf("generated request ID %q is not a UUID", first)
+		}
+		if first == second {
+			t.Error("generated request IDs repeat")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, id := range []string{strings.Repeat("a", maxRequestIDLength+1), "bad id", "x\"y", "line\nbreak", "ümlaut"} {
+			if got := serve(id); got == id {
+				t.Errorf("invalid inbound ID %q was reused", id)
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// loginThrottleSweepInterval is how often entries of clients that are no
+// longer blocked and have stopped failing are dropped
+const loginThrottleSweepInterval = time.Minute
+
+// LoginThrottle blocks client IPs after repeated failed logins, independent of
+// the global rate limiter. Once a client reaches maxFailures, each further
+// failure blocks it for twice as long as the previous block, up to maxBlock.
+// Successful logins halve the client's failure count.
+type LoginThrottle struct {
+	mu          sync.Mutex
+	clients     map[string]*loginFailures
+	maxFailures int
+	block       time.Duration
+	maxBlock    time.Duration
+	lastSweep   time.Time
+}
+
+// loginFailures tracks the failed logins of one client IP
+type loginFailures struct {
+	count        int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// NewLoginThrottle creates a throttle that blocks a client for block after
+// maxFailures failed logins, doubling on each further failure up to maxBlock
+func NewLoginThrottle(maxFailures int, block, maxBlock time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		clients:     make(map[string]*loginFailures),
+		maxFailures: maxFailures,
+		block:       block,
+		maxBlock:    maxBlock,
+		lastSweep:   time.Now(),
+	}
+}
+
+// Middleware returns a middleware that rejects blocked clients with 429 and
+// counts 401 responses as failed logins
+func (lt *LoginThrottle) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := getClientIP(r)
+
+			if wait := lt.blockedFor(ip, time.Now()); wait > 0 {
+				logger.FromContext(r.Context()).Warn("login blocked after repeated failures",
+					zap.String("client_ip", ip),
+					zap.Duration("retry_in", wait),
+				)
+
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				httpx.WriteError(w, r, http.StatusTooManyRequests, "too many requests", "too many failed login attempts")
+				return
+			}
+
+			ww, rw := wrapResponseWriter(w)
+			next.ServeHTTP(ww, r)
+
+			switch {
+			case rw.statusCode == http.StatusUnauthorized:
+				lt.recordFailure(ip, time.Now())
+			case rw.statusCode >= 200 && rw.statusCode < 300:
+				lt.recordSuccess(ip)
+			}
+		})
+	}
+}
+
+// blockedFor returns how long ip remains blocked, or 0
+func (lt *LoginThrottle) blockedFor(ip string, now time.Time) time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	entry, ok := lt.clients[ip]
+	if !ok || !now.Before(entry.blockedUntil) {
+		return 0
+	}
+	return entry.blockedUntil.Sub(now)
+}
+
+// recordFailure counts a failed login from ip, blocking it once the count
+// reaches maxFailures
+func (lt *LoginThrottle) recordFailure(ip string, now time.Time) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.sweepLocked(now)
+
+	entry, ok := lt.clients[ip]
+	if !ok {
+		entry = &loginFailures{}
+		lt.clients[ip] = entry
+	}
+	entry.count++
+	entry.lastFailure = now
+
+	if over := entry.count - lt.maxFailures; over >= 0 {
+		entry.blockedUntil = now.Add(lt.blockFor(over))
+	}
+}
+
+// blockFor returns the block after over failures beyond maxFailures: block
+// doubled over times, capped at maxBlock. Doubling stops at the cap, so the
+// duration can't overflow however long a client keeps failing.
+func (lt *LoginThrottle) blockFor(over int) time.Duration {
+	block := lt.block
+	for ; over > 0 && block < lt.maxBlock; over-- {
+		block *= 2
+	}
+	return min(block, lt.maxBlock)
+}
+
+// recordSuccess halves the failure count of ip
+func (lt *LoginThrottle) recordSuccess(ip string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	entry, ok := lt.clients[ip]
+	if !ok {
+		return
+	}
+	entry.count /= 2
+	if entry.count == 0 {
+		delete(lt.clients, ip)
+	}
+}
+
+// sweepLocked drops clients that are not blocked and haven't failed within
+// maxBlock, at most once per loginThrottleSweepInterval
+func (lt *LoginThrottle) sweepLocked(now time.Time) {
+	if now.Sub(lt.lastSweep) < loginThrottleSweepInterval {
+		return
+	}
+	lt.lastSweep = now
+
+	for ip, entry := range lt.clients {
+		if now.After(entry.blockedUntil) && now.Sub(entry.lastFailure) > lt.maxBlock {
+			delete(lt.clients, ip)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleBlockFor(t *testing.T) {
+	lt := NewLoginThrottle(5, time.Minute, time.Hour)
+
+	var prev time.Duration
+	for over := 0; over < 200; over++ {
+		block := lt.blockFor(over)
+		if block < prev || block > time.Hour {
+			t.Fatalf("blockFor(%d) = %v after %v, want non-decreasing and at most 1h", over, block, prev)
+		}
+		prev = block
+	}
+	if got := lt.blockFor(0); got != time.Minute {
+		t.Errorf("blockFor(0) = %v, want 1m", got)
+	}
+	if got := lt.blockFor(3); got != 8*time.Minute {
+		t.Errorf("blockFor(3) = %v, want 8m", got)
+	}
+	if got := lt.blockFor(1 << 40); got != time.Hour {
+		t.Errorf("blockFor(1<<40) = %v, want 1h", got)
+	}
+}
+
+func TestLoginThrottleHintsNeverDecrease(t *testing.T) {
+	lt := NewLoginThrottle(3, time.Minute, 24*time.Hour)
+	now := time.Now()
+
+	// A persistent client fails again each time its block expires, long
+	// past the point where an uncapped shift would overflow
+	var prev time.Duration
+	for i := 0; i < 100; i++ {
+		lt.recordFailure("203.0.113.7", now)
+		hint := lt.blockedFor("203.0.113.7", now)
+		if i < 2 {
+			if hint != 0 {
+				t.Fatalf("failure %d: blocked for %v before reaching the limit", i+1, hint)
+			}
+			continue
+		}
+		if hint <= 0 || hint < prev || hint > 24*time.Hour {
+			t.Fatalf("failure %d: hint %v after %v, want positive, non-decreasing and at most 24h", i+1, hint, prev)
+		}
+		prev = hint
+		now = now.Add(hint)
+	}
+	if prev != 24*time.Hour {
+		t.Errorf("final hint = %v, want the 24h cap", prev)
+	}
+}
+
+func TestLoginThrottleMiddleware(t *testing.T) {
+	lt := NewLoginThrottle(2, time.Minute, time.Hour)
+	status := http.StatusUnauthorized
+	handler := lt.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := login(); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	rec := login()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after the limit = %d, want 429", rec.Code)
+	}
+	if secs, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || secs < 1 || secs > 60 {
+		t.Errorf("Retry-After = %q, want 1-60 seconds", rec.Header().Get("Retry-After"))
+	}
+
+	// Another client is unaffected
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.RemoteAddr = "198.51.100.2:1234"
+	other := httptest.NewRecorder()
+	status = http.StatusOK
+	handler.ServeHTTP(other, req)
+	if other.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", other.Code)
+	}
+}
@@ -1,31 +1,177 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-starter/internal/httpx"
 	"go-starter/internal/logger"
 
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
-// RateLimiter manages rate limiting per IP address
+// rateLimitBypassHeader carries a token that lets trusted clients skip the limiter
+const rateLimitBypassHeader = "X-RateLimit-Bypass"
+
+const (
+	// minRetryAfter is the shortest Retry-After sent, so clients never retry
+	// straight into another 429
+	minRetryAfter = time.Second
+	// DefaultMaxRetryAfter caps escalated Retry-After hints
+	DefaultMaxRetryAfter = time.Minute
+)
+
+// penalty tracks a client that keeps being rejected
+type penalty struct {
+	// strikes counts rejections since the client last waited out its hint
+	strikes int
+	// hint is the last Retry-After sent, which expires at until
+	hint  time.Duration
+	until time.Time
+}
+
+// RateLimiter manages rate limiting per IP address, with optional per-route rules
 type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rps      int
-	burst    int
+	limiters     map[string]*rate.Limiter
+	ruleLimiters map[string]*rate.Limiter
+	mu           sync.RWMutex
+	rps          int
+	burst        int
+	rules        *RateLimitRules
+	userKey      func(*http.Request) (string, bool)
+	bypassTokens [][]byte
+	bypassed     atomic.Int64
+	// penalties escalate Retry-After per limiter, up to maxRetryAfter (0 disables)
+	penalties     map[*rate.Limiter]*penalty
+	maxRetryAfter time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(rps, burst int) *RateLimiter {
+// NewRateLimiter creates a new rate limiter. Requests presenting one of
+// bypassTokens in the X-RateLimit-Bypass header are not limited.
+func NewRateLimiter(rps, burst int, bypassTokens []string) *RateLimiter {
+	tokens := make([][]byte, 0, len(bypassTokens))
+	for _, token := range bypassTokens {
+		if token != "" {
+			tokens = append(tokens, []byte(token))
+		}
+	}
+
 	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		rps:      rps,
-		burst:    burst,
+		limiters:      make(map[string]*rate.Limiter),
+		ruleLimiters:  make(map[string]*rate.Limiter),
+		rps:           rps,
+		burst:         burst,
+		bypassTokens:  tokens,
+		penalties:     make(map[*rate.Limiter]*penalty),
+		maxRetryAfter: DefaultMaxRetryAfter,
+	}
+}
+
+// Bypassed returns the total number of requests that skipped the limiter
+func (rl *RateLimiter) Bypassed() int64 {
+	return rl.bypassed.Load()
+}
+
+// SetRules replaces the per-route rules. Clients are tracked afresh under the new rules.
+func (rl *RateLimiter) SetRules(rules *RateLimitRules) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.rules = rules
+	rl.ruleLimiters = make(map[string]*rate.Limiter)
+	rl.penalties = make(map[*rate.Limiter]*penalty)
+}
+
+// SetUserKeyFunc sets how rules keyed by user identify the caller. fn returns
+// false for unauthenticated requests, which are then limited by IP.
+func (rl *RateLimiter) SetUserKeyFunc(fn func(*http.Request) (string, bool)) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.userKey = fn
+}
+
+// SetLimits changes the default rate and burst applied to clients not matched
+// by a rule, including those already being tracked
+func (rl *RateLimiter) SetLimits(rps, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.rps = rps
+	rl.burst = burst
+	for _, limiter := range rl.limiters {
+		limiter.SetLimit(rate.Limit(rps))
+		limiter.SetBurst(burst)
+	}
+}
+
+// SetMaxRetryAfter sets the longest Retry-After that escalation for clients
+// retrying before their hint expires may reach. Zero disables escalation, so
+// hints only reflect when the next request would be allowed.
+func (rl *RateLimiter) SetMaxRetryAfter(d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.maxRetryAfter = d
+}
+
+// retryAfter returns the Retry-After hint for a request limiter rejected: the
+// time until it would be allowed, at least minRetryAfter. A client rejected
+// again before its previous hint expired has the hint doubled, up to
+// maxRetryAfter, and never shortened; waiting a hint out resets it.
+func (rl *RateLimiter) retryAfter(limiter *rate.Limiter) time.Duration {
+	now := time.Now()
+	// A limiter with no burst never allows a request
+	delay := DefaultMaxRetryAfter
+	if reservation := limiter.ReserveN(now, 1); reservation.OK() {
+		delay = reservation.DelayFrom(now)
+		reservation.CancelAt(now)
+	}
+	hint := max(delay, minRetryAfter)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.maxRetryAfter <= 0 {
+		return hint
+	}
+
+	p, exists := rl.penalties[limiter]
+	if !exists || now.After(p.until) {
+		p = &penalty{}
+		rl.penalties[limiter] = p
+	}
+	p.strikes++
+
+	escalated := minRetryAfter << min(p.strikes-1, 16)
+	hint = max(hint, min(escalated, rl.maxRetryAfter), p.hint)
+	p.hint = hint
+	p.until = now.Add(hint)
+
+	return hint
+}
+
+// hasBypassToken reports whether the request carries a valid bypass token
+func (rl *RateLimiter) hasBypassToken(r *http.Request) bool {
+	if len(rl.bypassTokens) == 0 {
+		return false
+	}
+
+	presented := []byte(r.Header.Get(rateLimitBypassHeader))
+	if len(presented) == 0 {
+		return false
+	}
+
+	// Check every token so timing doesn't reveal which one matched
+	match := 0
+	for _, token := range rl.bypassTokens {
+		match |= subtle.ConstantTimeCompare(presented, token)
 	}
+	return match == 1
 }
 
 // getLimiter returns a rate limiter for the given IP address
@@ -42,6 +188,43 @@ func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
+// limiterFor returns the limiter for a request: the matching rule's limiter
+// for the caller, or the default per-IP limiter
+func (rl *RateLimiter) limiterFor(r *http.Request, ip string) *rate.Limiter {
+	rl.mu.RLock()
+	rules, userKey := rl.rules, rl.userKey
+	rl.mu.RUnlock()
+
+	rule, index := rules.match(r.Method, r.URL.Path)
+	if rule == nil {
+		return rl.getLimiter(ip)
+	}
+
+	key := "ip:" + ip
+	if rule.Key == RateLimitKeyUser && userKey != nil {
+		if user, ok := userKey(r); ok {
+			key = "user:" + user
+		}
+	}
+	key = strconv.Itoa(index) + "|" + key
+
+	rl.mu.Lock()
+	// The rules may have been replaced while unlocked; use the default limiter for this request
+	if rl.rules != rules {
+		rl.mu.Unlock()
+		return rl.getLimiter(ip)
+	}
+
+	limiter, exists := rl.ruleLimiters[key]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Limit(rule.RPS), rule.Burst)
+		rl.ruleLimiters[key] = limiter
+	}
+	rl.mu.Unlock()
+
+	return limiter
+}
+
 // cleanup removes old entries from the limiters map
 func (rl *RateLimiter) cleanup() {
 	ticker := time.NewTicker(5 * time.Minute)
@@ -52,24 +235,35 @@ func (rl *RateLimiter) cleanup() {
 		// In production, you might want to track last access time
 		// For now, we clear all limiters periodically
 		rl.limiters = make(map[string]*rate.Limiter)
+		rl.ruleLimiters = make(map[string]*rate.Limiter)
+		rl.penalties = make(map[*rate.Limiter]*penalty)
 		rl.mu.Unlock()
 	}
 }
 
-// RateLimitMiddleware creates a middleware that rate limits requests by IP
-func RateLimitMiddleware(rps, burst int) func(http.Handler) http.Handler {
-	limiter := NewRateLimiter(rps, burst)
-
+// Middleware returns a middleware that rate limits requests by IP
+func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
 	// Start cleanup goroutine
-	go limiter.cleanup()
+	go rl.cleanup()
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get client IP
 			ip := getClientIP(r)
 
-			// Get or create limiter for this IP
-			ipLimiter := limiter.getLimiter(ip)
+			// Trusted clients skip the limiter but are still counted
+			if rl.hasBypassToken(r) {
+				rl.bypassed.Add(1)
+				logger.FromContext(r.Context()).Debug("rate limit bypassed",
+					zap.String("ip", ip),
+					zap.String("path", r.URL.Path),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Get or create limiter for this request
+			ipLimiter := rl.limiterFor(r, ip)
 
 			// Check if request is allowed
 			if !ipLimiter.Allow() {
@@ -80,20 +274,11 @@ func RateLimitMiddleware(rps, burst int) func(http.Handler) http.Handler {
 					zap.String("method", r.Method),
 				)
 
-				// Calculate retry-after duration
-				reservation := ipLimiter.Reserve()
-				if !reservation.OK() {
-					reservation.Cancel()
-					w.Header().Set("Retry-After", "60")
-				} else {
-					delay := reservation.Delay()
-					reservation.Cancel()
-					w.Header().Set("Retry-After", delay.String())
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"error":"too many requests","message":"rate limit exceeded"}`))
+				// Retry-After is in whole seconds, rounded up so the client doesn't retry early
+				retryAfter := rl.retryAfter(ipLimiter)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+				httpx.WriteError(w, r, http.StatusTooManyRequests, "too many requests", "rate limit exceeded")
 				return
 			}
 
@@ -102,21 +287,10 @@ func RateLimitMiddleware(rps, burst int) func(http.Handler) http.Handler {
 	}
 }
 
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for reverse proxies)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		return xff
-	}
-
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
-	}
-
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+// RateLimitMiddleware creates a middleware that rate limits requests by IP,
+// applying rules (which may be nil) to matching routes
+func RateLimitMiddleware(rps, burst int, bypassTokens []string, rules *RateLimitRules) func(http.Handler) http.Handler {
+	rl := NewRateLimiter(rps, burst, bypassTokens)
+	rl.SetRules(rules)
+	return rl.Middleware()
 }
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RateLimitKey selects what a rate limit rule counts requests against
+type RateLimitKey string
+
+const (
+	// RateLimitKeyIP limits each client IP separately
+	RateLimitKeyIP RateLimitKey = "ip"
+	// RateLimitKeyUser limits each authenticated user separately
+	RateLimitKeyUser RateLimitKey = "user"
+)
+
+// RateLimitRule overrides the default limit for requests whose path starts
+// with PathPrefix and, when Method is set, that use Method
+type RateLimitRule struct {
+	PathPrefix string
+	Method     string
+	RPS        int
+	Burst      int
+	Key        RateLimitKey
+}
+
+// RateLimitRules is a compiled, immutable set of rate limit rules
+type RateLimitRules struct {
+	rules []RateLimitRule
+}
+
+// CompileRateLimitRules validates rules and orders them for matching: longer
+// prefixes first and, for equal prefixes, method-specific rules first
+func CompileRateLimitRules(rules []RateLimitRule) (*RateLimitRules, error) {
+	compiled := make([]RateLimitRule, 0, len(rules))
+	seen := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		rule.Method = strings.ToUpper(rule.Method)
+		if rule.Key == "" {
+			rule.Key = RateLimitKeyIP
+		}
+
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			return nil, fmt.Errorf("rate limit rule %q: path prefix must start with /", rule.PathPrefix)
+		}
+		if rule.RPS <= 0 || rule.Burst <= 0 {
+			return nil, fmt.Errorf("rate limit rule %q: rps and burst must be positive", rule.PathPrefix)
+		}
+		if rule.Key != RateLimitKeyIP && rule.Key != RateLimitKeyUser {
+			return nil, fmt.Errorf("rate limit rule %q: unknown key %q", rule.PathPrefix, rule.Key)
+		}
+
+		id := rule.Method + " " + rule.PathPrefix
+		if seen[id] {
+			return nil, fmt.Errorf("rate limit rule %q: duplicate rule", strings.TrimSpace(id))
+		}
+		seen[id] = true
+
+		compiled = append(compiled, rule)
+	}
+
+	sort.SliceStable(compiled, func(i, j int) bool {
+		if len(compiled[i].PathPrefix) != len(compiled[j].PathPrefix) {
+			return len(compiled[i].PathPrefix) > len(compiled[j].PathPrefix)
+		}
+		return compiled[i].Method != "" && compiled[j].Method == ""
+	})
+
+	return &RateLimitRules{rules: compiled}, nil
+}
+
+// Rules returns the rules in matching order
+func (rs *RateLimitRules) Rules() []RateLimitRule {
+	if rs == nil {
+		return nil
+	}
+	return append([]RateLimitRule(nil), rs.rules...)
+}
+
+// match returns the first rule matching the request and its index, or nil
+func (rs *RateLimitRules) match(method, path string) (*RateLimitRule, int) {
+	if rs == nil {
+		return nil, -1
+	}
+	for i := range rs.rules {
+		rule := &rs.rules[i]
+		if rule.Method != "" && rule.Method != method {
+			continue
+		}
+		if strings.HasPrefix(path, rule.PathPrefix) {
+			return rule, i
+		}
+	}
+	return nil, -1
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// retryAfterHints sends n requests from one client and returns the
+// Retry-After of each rejected one, in seconds
+func retryAfterHints(t *testing.T, rl *RateLimiter, n int) []int {
+	t.Helper()
+	handler := rl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var hints []int
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusTooManyRequests {
+			continue
+		}
+
+		hint, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		if err != nil {
+			t.Fatalf("Retry-After %q is not whole seconds", rec.Header().Get("Retry-After"))
+		}
+		hints = append(hints, hint)
+	}
+	return hints
+}
+
+func TestRateLimitRetryAfterEscalates(t *testing.T) {
+	hints := retryAfterHints(t, NewRateLimiter(1, 1, nil), 11)
+
+	// The first request is allowed; hammering doubles the hint up to the cap
+	want := []int{1, 2, 4, 8, 16, 32, 60, 60, 60, 60}
+	if len(hints) != len(want) {
+		t.Fatalf("hints = %v, want %v", hints, want)
+	}
+	for i := range want {
+		if hints[i] != want[i] {
+			t.Fatalf("hints = %v, want %v", hints, want)
+		}
+	}
+}
+
+func TestRateLimitRetryAfterNeverZeroOrDecreasing(t *testing.T) {
+	tests := []struct {
+		name          string
+		rps, burst    int
+		maxRetryAfter time.Duration
+	}{
+		// The limiter alone would allow the next request within milliseconds
+		{"fast limit without escalation", 1000, 1, 0},
+		{"slow limit without escalation", 1, 2, 0},
+		{"short escalation cap", 100, 1, 3 * time.Second},
+		{"default escalation", 1, 1, DefaultMaxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(tt.rps, tt.burst, nil)
+			rl.SetMaxRetryAfter(tt.maxRetryAfter)
+
+			hints := retryAfterHints(t, rl, 50)
+			if len(hints) == 0 {
+				t.Fatal("no request was limited")
+			}
+			for i, hint := range hints {
+				if hint < 1 {
+					t.Fatalf("hint %d is %ds in %v; clients would retry into another 429", i, hint, hints)
+				}
+				if i > 0 && hint < hints[i-1] {
+					t.Fatalf("hint %d decreased in %v", i, hints)
+				}
+				if limit := int(tt.maxRetryAfter / time.Second); limit > 0 && hint > limit {
+					t.Fatalf("hint %d exceeds the %ds cap in %v", i, limit, hints)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitRetryAfterResetsOnceWaitedOut(t *testing.T) {
+	rl := NewRateLimiter(1, 1, nil)
+	limiter := rate.NewLimiter(1, 1)
+	limiter.Allow()
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := rl.retryAfter(limiter); got != want {
+			t.Fatalf("retryAfter = %v, want %v", got, want)
+		}
+	}
+
+	// The client waited out its last hint
+	rl.penalties[limiter].until = time.Now().Add(-time.Millisecond)
+	if got := rl.retryAfter(limiter); got != time.Second {
+		t.Errorf("retryAfter after waiting = %v, want %v", got, time.Second)
+	}
+}
+
+func TestRateLimitRetryAfterWithoutBurst(t *testing.T) {
+	rl := NewRateLimiter(1, 0, nil)
+	rl.SetMaxRetryAfter(0)
+	if got := rl.retryAfter(rate.NewLimiter(1, 0)); got != DefaultMaxRetryAfter {
+		t.Errorf("retryAfter = %v, want %v", got, DefaultMaxRetryAfter)
+	}
+}
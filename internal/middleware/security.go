@@ -1,25 +1,65 @@
 package middleware
 
 import (
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// SecurityHeadersConfig holds the values of the security headers added to
+// every response. Empty values omit the header.
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+	FrameOptions          string
+	// HSTSMaxAge is sent in Strict-Transport-Security (0 disables HSTS)
+	HSTSMaxAge time.Duration
+	// EnableHSTS allows HSTS to be sent; it is only ever sent over HTTPS
+	EnableHSTS bool
+	// TrustedProxies may report TLS termination with X-Forwarded-Proto
+	TrustedProxies []*net.IPNet
+}
+
 // SecurityHeadersMiddleware adds security headers to responses
-func SecurityHeadersMiddleware(isProduction bool) func(http.Handler) http.Handler {
+func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.EnableHSTS && cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10) + "; includeSubDomains"
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Set security headers
 			w.Header().Set("X-Content-Type-Options", "nosniff")
-			w.Header().Set("X-Frame-Options", "DENY")
 			w.Header().Set("X-XSS-Protection", "1; mode=block")
-			w.Header().Set("Content-Security-Policy", "default-src 'self'")
+			setIfNotEmpty(w.Header(), "X-Frame-Options", cfg.FrameOptions)
+			setIfNotEmpty(w.Header(), "Content-Security-Policy", cfg.ContentSecurityPolicy)
+			setIfNotEmpty(w.Header(), "Referrer-Policy", cfg.ReferrerPolicy)
 
-			// Add HSTS header in production
-			if isProduction {
-				w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+			// Browsers ignore HSTS received over plain HTTP
+			if hsts != "" && isHTTPS(r, cfg.TrustedProxies) {
+				w.Header().Set("Strict-Transport-Security", hsts)
 			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// setIfNotEmpty sets a header unless value is empty
+func setIfNotEmpty(h http.Header, key, value string) {
+	if value != "" {
+		h.Set(key, value)
+	}
+}
+
+// isHTTPS reports whether the request arrived over TLS, directly or via one of
+// trusted terminating TLS
+func isHTTPS(r *http.Request, trusted []*net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return fromTrustedProxy(r, trusted) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	cfg := SecurityHeadersConfig{
+		ContentSecurityPolicy: "default-src 'self'; img-src https://cdn.example",
+		ReferrerPolicy:        "no-referrer",
+		FrameOptions:          "SAMEORIGIN",
+		HSTSMaxAge:            24 * time.Hour,
+		EnableHSTS:            true,
+		TrustedProxies:        mustCIDRs(t, "10.0.0.0/8"),
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		cfg        SecurityHeadersConfig
+		remoteAddr string
+		tls        bool
+		proto      string
+		want       map[string]string
+	}{
+		{
+			name:       "https",
+			cfg:        cfg,
+			remoteAddr: "192.0.2.10:1234",
+			tls:        true,
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Content-Security-Policy":   "default-src 'self'; img-src https://cdn.example",
+				"Referrer-Policy":           "no-referrer",
+				"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+			},
+		},
+		{
+			name:       "plain http",
+			cfg:        cfg,
+			remoteAddr: "192.0.2.10:1234",
+			want: map[string]string{
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name:       "tls terminated by a trusted proxy",
+			cfg:        cfg,
+			remoteAddr: "10.1.2.3:1234",
+			proto:      "https",
+			want:       map[string]string{"Strict-Transport-Security": "max-age=86400; includeSubDomains"},
+		},
+		{
+			name:       "forwarded proto from an untrusted peer",
+			cfg:        cfg,
+			remoteAddr: "192.0.2.10:1234",
+			proto:      "https",
+			want:       map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name:       "hsts disabled outside production",
+			cfg:        SecurityHeadersConfig{HSTSMaxAge: 24 * time.Hour},
+			remoteAddr: "192.0.2.10:1234",
+			tls:        true,
+			want:       map[string]string{"X-Content-Type-Options": "nosniff", "Strict-Transport-Security": ""},
+		},
+		{
+			name:       "empty values omit headers",
+			cfg:        SecurityHeadersConfig{EnableHSTS: true},
+			remoteAddr: "192.0.2.10:1234",
+			tls:        true,
+			want: map[string]string{
+				"X-Frame-Options":           "",
+				"Content-Security-Policy":   "",
+				"Referrer-Policy":           "",
+				"Strict-Transport-Security": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			rec := httptest.NewRecorder()
+			SecurityHeadersMiddleware(tt.cfg)(ok).ServeHTTP(rec, req)
+
+			for name, want := range tt.want {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
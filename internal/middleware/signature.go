@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// HMACConfig holds webhook signature verification configuration
+type HMACConfig struct {
+	// Secret is the shared secret used to sign requests for this route
+	Secret []byte
+	// SignatureHeader holds the hex-encoded HMAC-SHA256, optionally prefixed with "sha256="
+	SignatureHeader string
+	// TimestampHeader holds the Unix timestamp the request was signed at
+	TimestampHeader string
+	// Tolerance is the maximum allowed age (or clock skew) of the timestamp
+	Tolerance time.Duration
+	// MaxBodySize caps the number of bytes buffered for verification
+	MaxBodySize int64
+}
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errInvalidTimestamp = errors.New("invalid timestamp")
+	errStaleTimestamp   = errors.New("timestamp outside tolerance")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+// HMACSignatureMiddleware creates a middleware that verifies the HMAC-SHA256
+// signature of the raw request body. The signed payload is "<timestamp>.<body>".
+// The body is buffered and restored so downstream handlers can read it again.
+func HMACSignatureMiddleware(cfg HMACConfig) func(http.Handler) http.Handler {
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = "X-Signature"
+	}
+	if cfg.TimestampHeader == "" {
+		cfg.TimestampHeader = "X-Signature-Timestamp"
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = 5 * time.Minute
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					httpx.WriteError(w, r, http.StatusRequestEntityTooLarge, "request body too large", "")
+					return
+				}
+				httpx.WriteError(w, r, http.StatusBadRequest, "invalid request body", "")
+				return
+			}
+
+			if err := verifySignature(cfg, r.Header, body, time.Now()); err != nil {
+				logger.FromContext(r.Context()).Warn("webhook signature verification failed",
+					zap.Error(err),
+					zap.String("client_ip", getClientIP(r)),
+					zap.String("path", r.URL.Path),
+				)
+				httpx.WriteError(w, r, http.StatusUnauthorized, "invalid signature", "")
+				return
+			}
+
+			// Restore the body for downstream handlers
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifySignature checks the timestamp tolerance and the HMAC of the body
+func verifySignature(cfg HMACConfig, header http.Header, body []byte, now time.Time) error {
+	signature := strings.TrimPrefix(header.Get(cfg.SignatureHeader), "sha256=")
+	timestamp := header.Get(cfg.TimestampHeader)
+	if signature == "" || timestamp == "" {
+		return errMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidTimestamp
+	}
+
+	age := now.Sub(time.Unix(unix, 0))
+	if age > cfg.Tolerance || age < -cfg.Tolerance {
+		return errStaleTimestamp
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return errInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, cfg.Secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errInvalidSignature
+	}
+
+	return nil
+}
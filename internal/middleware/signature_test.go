@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testWebhookSecret = []byte("webhook-secret")
+
+// sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" with secret
+func sign(secret []byte, timestamp, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	cfg := HMACConfig{
+		Secret:          testWebhookSecret,
+		SignatureHeader: "X-Signature",
+		TimestampHeader: "X-Signature-Timestamp",
+		Tolerance:       5 * time.Minute,
+	}
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := `{"event":"user.created"}`
+
+	type signatureCase struct {
+		name      string
+		signature string
+		timestamp string
+		body      string
+		want      error
+	}
+	tests := []signatureCase{
+		{"valid", sign(testWebhookSecret, ts, body), ts, body, nil},
+		{"valid with prefix", "sha256=" + sign(testWebhookSecret, ts, body), ts, body, nil},
+		{"tampered body", sign(testWebhookSecret, ts, body), ts, `{"event":"user.deleted"}`, errInvalidSignature},
+		{"wrong secret", sign([]byte("other-secret"), ts, body), ts, body, errInvalidSignature},
+		{"signed for another timestamp", sign(testWebhookSecret, ts, body), strconv.FormatInt(now.Unix()-1, 10), body, errInvalidSignature},
+		{"not hex", "sha256=not-a-hex-signature", ts, body, errInvalidSignature},
+		{"missing signature", "", ts, body, errMissingSignature},
+		{"missing timestamp", sign(testWebhookSecret, ts, body), "", body, errMissingSignature},
+		{"invalid timestamp", sign(testWebhookSecret, "soon", body), "soon", body, errInvalidTimestamp},
+	}
+	// Timestamps are accepted up to Tolerance away from now in either direction
+	for _, offset := range []time.Duration{-5 * time.Minute, 5 * time.Minute, -6 * time.Minute, 6 * time.Minute} {
+		stamp := strconv.FormatInt(now.Add(offset).Unix(), 10)
+		var want error
+		if offset.Abs() > cfg.Tolerance {
+			want = errStaleTimestamp
+		}
+		tests = append(tests, signatureCase{"timestamp " + offset.String(), sign(testWebhookSecret, stamp, body), stamp, body, want})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(cfg.SignatureHeader, tt.signature)
+			}
+			if tt.timestamp != "" {
+				header.Set(cfg.TimestampHeader, tt.timestamp)
+			}
+			if err := verifySignature(cfg, header, []byte(tt.body), now); !errors.Is(err, tt.want) {
+				t.Errorf("verifySignature error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// signedRequest builds a POST of body signed now with secret
+func signedRequest(secret []byte, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/test", strings.NewReader(body))
+	req.Header.Set("X-Signature", "sha256="+sign(secret, ts, body))
+	req.Header.Set("X-Signature-Timestamp", ts)
+	return req
+}
+
+func TestHMACSignatureMiddleware(t *testing.T) {
+	var received string
+	handler := HMACSignatureMiddleware(HMACConfig{Secret: testWebhookSecret, MaxBodySize: 64})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("reading restored body: %v", err)
+			}
+			received = string(body)
+		}),
+	)
+
+	// received is what the handler read; only verified requests reach it
+	tests := []struct {
+		name     string
+		req      *http.Request
+		status   int
+		received string
+	}{
+		{"valid", signedRequest(testWebhookSecret, `{"event":"ping"}`), http.StatusOK, `{"event":"ping"}`},
+		{"wrong secret", signedRequest([]byte("other-secret"), `{"event":"ping"}`), http.StatusUnauthorized, ""},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/webhooks/test", strings.NewReader(`{}`)), http.StatusUnauthorized, ""},
+		{"too large", signedRequest(testWebhookSecret, strings.Repeat("a", 65)), http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if received != tt.received {
+				t.Errorf("handler read %q, want %q", received, tt.received)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"go-starter/internal/httpx"
+	"go-starter/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// emptyUserAgentRule labels requests blocked for sending no User-Agent
+	emptyUserAgentRule = "empty_user_agent"
+	// globPrefix marks a pattern as a glob rather than a regular expression
+	globPrefix = "glob:"
+)
+
+// defaultAllowedUserAgents matches monitoring agents that are never blocked
+var defaultAllowedUserAgents = []string{`(?i)pingdom`, `(?i)kube-probe`}
+
+// UserAgentRules configures which user agents are blocked. Patterns are
+// regular expressions, or globs when prefixed with "glob:": a glob matches the
+// whole user agent case-insensitively, with * matching any run of characters
+// and ? any single one, e.g. "glob:*bot*".
+type UserAgentRules struct {
+	// Deny holds patterns; matching user agents are rejected
+	Deny []string
+	// Allow holds patterns that take precedence over Deny
+	Allow []string
+	// RejectEmptyPrefixes lists path prefixes where an empty User-Agent is rejected
+	RejectEmptyPrefixes []string
+}
+
+// compiledUserAgentRules is the compiled form of UserAgentRules
+type compiledUserAgentRules struct {
+	deny                []userAgentPattern
+	allow               []userAgentPattern
+	rejectEmptyPrefixes []string
+}
+
+// userAgentPattern is a compiled deny or allow pattern
+type userAgentPattern struct {
+	// rule is the pattern as configured, used to label blocked requests
+	rule string
+	re   *regexp.Regexp
+}
+
+// compileUserAgentPattern compiles a regular expression, or a glob with
+// globPrefix. Globs are translated to regular expressions rather than matched
+// with path.Match, whose * stops at the slashes found in most user agents.
+func compileUserAgentPattern(pattern string) (userAgentPattern, error) {
+	expr := pattern
+	if glob, ok := strings.CutPrefix(pattern, globPrefix); ok {
+		var b strings.Builder
+		b.WriteString("(?i)^")
+		for _, r := range glob {
+			switch r {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteString(".")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		b.WriteString("$")
+		expr = b.String()
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return userAgentPattern{}, err
+	}
+	return userAgentPattern{rule: pattern, re: re}, nil
+}
+
+// UserAgentFilter blocks requests based on their User-Agent header
+type UserAgentFilter struct {
+	rules   atomic.Pointer[compiledUserAgentRules]
+	blocked *expvar.Map
+}
+
+// NewUserAgentFilter creates a user agent filter with the given rules
+func NewUserAgentFilter(rules UserAgentRules) (*UserAgentFilter, error) {
+	f := &UserAgentFilter{
+		blocked: new(expvar.Map).Init(),
+	}
+	if err := f.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetRules compiles and atomically replaces the filter rules
+func (f *UserAgentFilter) SetRules(rules UserAgentRules) error {
+	compiled := &compiledUserAgentRules{
+		rejectEmptyPrefixes: rules.RejectEmptyPrefixes,
+	}
+
+	for _, pattern := range rules.Deny {
+		p, err := compileUserAgentPattern(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid user agent deny pattern %q: %w", pattern, err)
+		}
+		compiled.deny = append(compiled.deny, p)
+	}
+
+	for _, pattern := range slices.Concat(defaultAllowedUserAgents, rules.Allow) {
+		p, err := compileUserAgentPattern(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid user agent allow pattern %q: %w", pattern, err)
+		}
+		compiled.allow = append(compiled.allow, p)
+	}
+
+	f.rules.Store(compiled)
+	return nil
+}
+
+// BlockedCounts returns the blocked request counters keyed by rule
+func (f *UserAgentFilter) BlockedCounts() *expvar.Map {
+	return f.blocked
+}
+
+// match returns the rule that blocks the request, or an empty string
+func (f *UserAgentFilter) match(r *http.Request) string {
+	rules := f.rules.Load()
+	userAgent := r.UserAgent()
+
+	if userAgent == "" {
+		for _, prefix := range rules.rejectEmptyPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return emptyUserAgentRule
+			}
+		}
+		return ""
+	}
+
+	for _, p := range rules.allow {
+		if p.re.MatchString(userAgent) {
+			return ""
+		}
+	}
+
+	for _, p := range rules.deny {
+		if p.re.MatchString(userAgent) {
+			return p.rule
+		}
+	}
+
+	return ""
+}
+
+// Middleware returns a middleware that rejects blocked user agents with 403
+func (f *UserAgentFilter) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rule := f.match(r); rule != "" {
+				f.blocked.Add(rule, 1)
+
+				logger.FromContext(r.Context()).Warn("user agent blocked",
+					zap.String("rule", rule),
+					zap.String("user_agent", r.UserAgent()),
+					zap.String("client_ip", getClientIP(r)),
+					zap.String("path", r.URL.Path),
+				)
+
+				httpx.WriteError(w, r, http.StatusForbidden, "forbidden", "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UserAgentFilterMiddleware creates a middleware that blocks user agents matching rules
+func UserAgentFilterMiddleware(rules UserAgentRules) (func(http.Handler) http.Handler, error) {
+	f, err := NewUserAgentFilter(rules)
+	if err != nil {
+		return nil, err
+	}
+	return f.Middleware(), nil
+}
+
+// LoadUserAgentRulesFile reads user agent rules from a file. Each non-empty
+// line is "deny <pattern>" or "allow <pattern>", with patterns as in
+// UserAgentRules; lines starting with # are ignored.
+func LoadUserAgentRulesFile(path string) (UserAgentRules, error) {
+	var rules UserAgentRules
+
+	file, err := os.Open(path)
+	if err != nil {
+		return rules, fmt.Errorf("failed to open user agent rules file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action, pattern, _ := strings.Cut(line, " ")
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			return rules, fmt.Errorf("user agent rules file line %d: missing pattern", lineNum)
+		}
+
+		switch action {
+		case "deny":
+			rules.Deny = append(rules.Deny, pattern)
+		case "allow":
+			rules.Allow = append(rules.Allow, pattern)
+		default:
+			return rules, fmt.Errorf("user agent rules file line %d: unknown action %q", lineNum, action)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return rules, fmt.Errorf("failed to read user agent rules file: %w", err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// userAgentRequest builds a GET of path with the given User-Agent
+func userAgentRequest(path, userAgent string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Del("User-Agent")
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return req
+}
+
+func TestUserAgentFilterMatch(t *testing.T) {
+	f, err := NewUserAgentFilter(UserAgentRules{
+		Deny:                []string{`(?i)python-requests`, "glob:*bot*", "glob:curl/?.*"},
+		Allow:               []string{"glob:*Googlebot*", `^MonitorBot/`},
+		RejectEmptyPrefixes: []string{"/auth"},
+	})
+	if err != nil {
+		t.Fatalf("NewUserAgentFilter: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		userAgent string
+		want      string
+	}{
+		{"browser", "/api/v1/users", "Mozilla/5.0 (X11; Linux x86_64)", ""},
+		{"regex deny", "/api/v1/users", "Python-Requests/2.31", `(?i)python-requests`},
+		{"glob deny across slashes", "/api/v1/users", "Mozilla/5.0 (compatible; AhrefsBot/7.0)", "glob:*bot*"},
+		{"glob question mark", "/api/v1/users", "curl/8.4.0", "glob:curl/?.*"},
+		{"glob is anchored", "/api/v1/users", "libcurl/8.4.0", ""},
+		{"allow glob wins over deny", "/api/v1/users", "Mozilla/5.0 (compatible; Googlebot/2.1)", ""},
+		{"allow regex wins over deny", "/api/v1/users", "MonitorBot/1.0", ""},
+		{"default allow wins over deny", "/api/v1/users", "kube-probe-bot/1.29", ""},
+		{"empty on rejected prefix", "/auth/login", "", emptyUserAgentRule},
+		{"empty elsewhere", "/api/v1/users", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.match(userAgentRequest(tt.path, tt.userAgent)); got != tt.want {
+				t.Errorf("match = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserAgentFilterMiddleware(t *testing.T) {
+	f, err := NewUserAgentFilter(UserAgentRules{Deny: []string{"glob:*bot*"}, RejectEmptyPrefixes: []string{"/auth"}})
+	if err != nil {
+		t.Fatalf("NewUserAgentFilter: %v", err)
+	}
+	handler := f.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, req := range []*http.Request{
+		userAgentRequest("/api/v1/users", "SomeBot/1.0"),
+		userAgentRequest("/auth/register", ""),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s with User-Agent %q: status = %d, want %d", req.URL.Path, req.UserAgent(), rec.Code, http.StatusForbidden)
+		}
+	}
+
+	if got := f.BlockedCounts().Get("glob:*bot*"); got == nil || got.String() != "1" {
+		t.Errorf("blocked count for glob:*bot* = %v, want 1", got)
+	}
+	if got := f.BlockedCounts().Get(emptyUserAgentRule); got == nil || got.String() != "1" {
+		t.Errorf("blocked count for %s = %v, want 1", emptyUserAgentRule, got)
+	}
+}
+
+func TestUserAgentRulesRejectInvalidPatterns(t *testing.T) {
+	for _, rules := range []UserAgentRules{
+		{Deny: []string{"(unclosed"}},
+		{Allow: []string{"[a-"}},
+	} {
+		if _, err := NewUserAgentFilter(rules); err == nil {
+			t.Errorf("NewUserAgentFilter(%+v) accepted an invalid pattern", rules)
+		}
+	}
+	// Globs have no syntax errors, even with regexp metacharacters
+	if _, err := NewUserAgentFilter(UserAgentRules{Deny: []string{"glob:*(bot[*"}}); err != nil {
+		t.Errorf("glob with metacharacters: %v", err)
+	}
+}
+
+func TestLoadUserAgentRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ua.rules")
+	content := "# crawlers\ndeny glob:*bot*\n\nallow  glob:*Googlebot*\ndeny (?i)python-requests\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadUserAgentRulesFile(path)
+	if err != nil {
+		t.Fatalf("LoadUserAgentRulesFile: %v", err)
+	}
+	if len(rules.Deny) != 2 || rules.Deny[0] != "glob:*bot*" || rules.Deny[1] != "(?i)python-requests" {
+		t.Errorf("Deny = %q", rules.Deny)
+	}
+	if len(rules.Allow) != 1 || rules.Allow[0] != "glob:*Googlebot*" {
+		t.Errorf("Allow = %q", rules.Allow)
+	}
+
+	if err := os.WriteFile(path, []byte("block *bot*\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadUserAgentRulesFile(path); err == nil {
+		t.Error("LoadUserAgentRulesFile accepted an unknown action")
+	}
+}
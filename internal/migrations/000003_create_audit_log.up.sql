@@ -0,0 +1,26 @@
+-- user_id has no foreign key so that records outlive deleted accounts
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    event_type VARCHAR(64) NOT NULL,
+    user_id INTEGER,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    outcome VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id, created_at);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+-- The audit trail is append-only
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_modify
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
@@ -0,0 +1,9 @@
+-- Written by cmd/seed, one row per seeder run
+CREATE TABLE IF NOT EXISTS seed_history (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    env VARCHAR(32) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_seed_history_name ON seed_history(name, applied_at);
@@ -0,0 +1,4 @@
+-- Soft delete: deleted users keep their row, and their email, until purged
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
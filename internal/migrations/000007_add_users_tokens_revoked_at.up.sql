@@ -0,0 +1,2 @@
+-- Tokens of a user issued at or before this time are rejected
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMPTZ;
@@ -0,0 +1,173 @@
+// Package migrations embeds the SQL schema migrations so they can be run from
+// the binary without the source tree.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+const (
+	// pgUndefinedTable is the SQLSTATE returned when schema_migrations doesn't exist yet
+	pgUndefinedTable = "42P01"
+	// advisoryLockID serializes Up across replicas starting at the same time
+	advisoryLockID = 7_364_211_098
+)
+
+// ErrDirty is returned when the last migration failed part way and the schema
+// needs repairing with the migrate tool's force command
+var ErrDirty = errors.New("database schema is dirty")
+
+// Source returns a golang-migrate source driver reading the embedded migrations
+func Source() (source.Driver, error) {
+	return iofs.New(files, ".")
+}
+
+// Version returns the schema version recorded by golang-migrate and whether
+// the last migration failed part way (dirty). It returns version 0 when no
+// migration has been applied.
+func Version(ctx context.Context, db *sql.DB) (uint, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == pgUndefinedTable) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint(version), dirty, nil
+}
+
+// Latest returns the highest embedded migration version
+func Latest() (uint, error) {
+	src, err := Source()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+// Up applies the pending embedded migrations one at a time, calling applied
+// after each. It holds a Postgres advisory lock for the whole run, so
+// replicas starting together wait for the first to finish and then find
+// nothing left to do. It returns ErrDirty without migrating when a previous
+// migration failed part way.
+func Up(ctx context.Context, db *sql.DB, applied func(version uint, name string)) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	// The lock belongs to the session, so take it on the connection the
+	// migrations run on and release it before the connection goes back to the pool
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockID); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	var m *migrate.Migrate
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "RESET statement_timeout")
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockID)
+		if m != nil {
+			// Closes the source and conn
+			m.Close()
+		} else {
+			conn.Close()
+		}
+	}()
+
+	// Migrations may legitimately run longer than the pool's statement_timeout
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		return fmt.Errorf("failed to disable statement timeout: %w", err)
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	src, err := Source()
+	if err != nil {
+		return err
+	}
+	m, err = migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		src.Close()
+		return fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+
+	current, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		current, err = src.First()
+		if err != nil {
+			return fmt.Errorf("failed to read migrations: %w", err)
+		}
+		if err := migrateTo(m, src, current, applied); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read schema version: %w", err)
+	case dirty:
+		return fmt.Errorf("%w at version %d", ErrDirty, current)
+	}
+
+	for {
+		next, err := src.Next(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read migrations: %w", err)
+		}
+		if err := migrateTo(m, src, next, applied); err != nil {
+			return err
+		}
+		current = next
+	}
+}
+
+// migrateTo applies the migration up to version and reports it
+func migrateTo(m *migrate.Migrate, src source.Driver, version uint, applied func(version uint, name string)) error {
+	if err := m.Migrate(version); err != nil {
+		return fmt.Errorf("failed to apply migration %d: %w", version, err)
+	}
+
+	name := ""
+	if body, identifier, err := src.ReadUp(version); err == nil {
+		body.Close()
+		name = identifier
+	}
+	applied(version, name)
+	return nil
+}
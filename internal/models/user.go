@@ -11,6 +11,11 @@ type User struct {
 	PasswordHash string    `json:"-"` // Never expose password hash in JSON
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// Version is incremented by every update; send it back to update only the
+	// version that was read
+	Version int `json:"version"`
+	// DeletedAt is set when the account is soft-deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // LoginRequest represents a login request payload
@@ -25,14 +30,38 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+// UpdateMeRequest represents a partial profile update payload. Omitted
+// fields are left unchanged.
+type UpdateMeRequest struct {
+	Email *string `json:"email,omitempty" validate:"omitempty,email"`
+	// Version, when set, must match the current profile version, otherwise
+	// the update is rejected so the client can refetch
+	Version *int `json:"version,omitempty" validate:"omitempty,min=1"`
+}
+
+// DeleteMeRequest represents an account deletion request payload
+type DeleteMeRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
 // AuthResponse represents an authentication response
 type AuthResponse struct {
 	Token string `json:"token"`
-	User  *User  `json:"user"`
+	// ExpiresAt is when the access token expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// RefreshExpiresAt is when the session can no longer be refreshed and the
+	// user must log in again
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	User             *User     `json:"user"`
 }
 
-// ErrorResponse represents an error response
+// ErrorResponse represents an error response. Validation failures use the
+// same shape, with the failed rules described in Message.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	// Error is a short, translated description of the problem
+	Error string `json:"error" example:"validation failed"`
+	// Message optionally gives more detail about the problem
+	Message string `json:"message,omitempty" example:"Key: 'RegisterRequest.Email' Error:Field validation for 'Email' failed on the 'email' tag"`
+	// RequestID identifies the request in server logs
+	RequestID string `json:"request_id,omitempty" example:"3f2c9a1e-7b4d-4e8a-9c1f-2d6b8e0a5f13"`
 }
@@ -0,0 +1,142 @@
+// Package pagination parses paging query parameters and writes the matching
+// Link and X-Total-Count response headers, so list endpoints page the same way.
+//
+// Offset paging (limit/offset) allows jumping to any page and reports a total,
+// but gets slower deep into large tables and can skip or repeat rows when rows
+// are inserted concurrently; use it for small admin views. Cursor (keyset)
+// paging (limit/cursor) only moves forward but stays fast and stable on large,
+// changing tables.
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Page is the window of results requested by a client
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Parse reads the limit and offset query parameters. A missing limit uses
+// defaultLimit; limits outside 1..maxLimit and negative offsets are rejected
+// with an error suitable for the client.
+func Parse(r *http.Request, defaultLimit, maxLimit int) (Page, error) {
+	page := Page{Limit: defaultLimit}
+	query := r.URL.Query()
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return Page{}, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		page.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return Page{}, fmt.Errorf("offset must be a non-negative integer")
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+// SetHeaders writes X-Total-Count and an RFC 5988 Link header with next and
+// prev relations for page, given total matching results. Links keep the
+// request's other query parameters.
+func SetHeaders(w http.ResponseWriter, r *http.Request, page Page, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	var links []string
+	if next := page.Offset + page.Limit; next < total {
+		links = append(links, link(r, page.Limit, next, "next"))
+	}
+	if page.Offset > 0 {
+		prev := max(page.Offset-page.Limit, 0)
+		links = append(links, link(r, page.Limit, prev, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// link formats a Link header entry pointing at the request URL with the given window
+func link(r *http.Request, limit, offset int, rel string) string {
+	query := r.URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+}
+
+// cursorPrefix marks cursors so values from elsewhere are rejected
+const cursorPrefix = "id:"
+
+// Cursor is a keyset page: up to Limit results with an ID greater than After
+type Cursor struct {
+	Limit int
+	After int
+}
+
+// ParseCursor reads the limit and cursor query parameters. A missing cursor
+// starts from the beginning; limits are validated as in Parse.
+func ParseCursor(r *http.Request, defaultLimit, maxLimit int) (Cursor, error) {
+	page, err := Parse(r, defaultLimit, maxLimit)
+	if err != nil {
+		return Cursor{}, err
+	}
+	cursor := Cursor{Limit: page.Limit}
+
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		after, err := DecodeCursor(value)
+		if err != nil {
+			return Cursor{}, err
+		}
+		cursor.After = after
+	}
+
+	return cursor, nil
+}
+
+// EncodeCursor returns an opaque cursor resuming after the given ID
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(id)))
+}
+
+// DecodeCursor returns the ID encoded by EncodeCursor
+func DecodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if value, ok := strings.CutPrefix(string(data), cursorPrefix); ok {
+			if id, err := strconv.Atoi(value); err == nil && id >= 0 {
+				return id, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("cursor is invalid")
+}
+
+// SetCursorLink writes an RFC 5988 Link header with a next relation for the
+// given cursor, if any. Links keep the request's other query parameters.
+func SetCursorLink(w http.ResponseWriter, r *http.Request, limit int, next string) {
+	if next == "" {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("cursor", next)
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI()))
+}
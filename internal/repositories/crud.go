@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-starter/pkg/database"
+)
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// reader returns the transaction ctx carries, so reads inside it see its
+// uncommitted writes, or a read handle otherwise
+func reader(ctx context.Context, db *database.DB) database.Querier {
+	if tx, ok := database.TxFromContext(ctx); ok {
+		return tx
+	}
+	return db.Reader()
+}
+
+// writer returns the transaction ctx carries or the primary
+func writer(ctx context.Context, db *database.DB) database.Querier {
+	return db.Writer().Querier(ctx)
+}
+
+// table describes how a repository reads entities of type T from one table.
+// Table and column names are interpolated into queries, so they must be
+// constants, never user input.
+type table[T any] struct {
+	// name is the table name
+	name string
+	// entity names T in error messages, e.g. "user"
+	entity string
+	// columns is the select list read by scan
+	columns string
+	// scan reads one row of columns
+	scan func(rowScanner) (*T, error)
+	// notFound is returned when no row matches
+	notFound error
+	// live, when set, is the condition excluding soft-deleted rows
+	live string
+}
+
+// getBy returns the single row of t whose column equals value, using the
+// reader and retrying transient failures. Soft-deleted rows are skipped
+// unless includeDeleted is set.
+func getBy[T any](ctx context.Context, db *database.DB, t table[T], column string, value interface{}, includeDeleted bool) (*T, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1", t.columns, t.name, column)
+	if t.live != "" && !includeDeleted {
+		query += " AND " + t.live
+	}
+
+	var entity *T
+	err := retryRead(ctx, func() error {
+		var err error
+		entity, err = t.scan(reader(ctx, db).QueryRowContext(ctx, query, value))
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, t.notFound
+		}
+		if mapped := mapPgError(err); mapped != nil {
+			return nil, mapped
+		}
+		return nil, fmt.Errorf("failed to get %s by %s: %w", t.entity, column, err)
+	}
+
+	return entity, nil
+}
+
+// getByID returns the row of t with the given id
+func getByID[T any](ctx context.Context, db *database.DB, t table[T], id int, includeDeleted bool) (*T, error) {
+	return getBy(ctx, db, t, "id", id, includeDeleted)
+}
+
+// queryAll runs query, which must select t.columns, on the reader and scans
+// every row. Errors are returned unwrapped for the caller to describe.
+func queryAll[T any](ctx context.Context, db *database.DB, t table[T], query string, args ...interface{}) ([]*T, error) {
+	var entities []*T
+	err := retryRead(ctx, func() error {
+		rows, err := reader(ctx, db).QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		entities = make([]*T, 0)
+		for rows.Next() {
+			entity, err := t.scan(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", t.entity, err)
+			}
+			entities = append(entities, entity)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return nil, mapped
+		}
+		return nil, err
+	}
+
+	return entities, nil
+}
+
+// deleteByID deletes the row of t with the given id on the writer, whether
+// soft-deleted or not, returning t.notFound when there is none
+func deleteByID[T any](ctx context.Context, db *database.DB, t table[T], id int) error {
+	result, err := writer(ctx, db).ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", t.name), id)
+	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("failed to delete %s: %w", t.entity, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return t.notFound
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres SQLSTATE codes of integrity constraint violations
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	// pgQueryCanceled is returned when statement_timeout cancels a statement
+	pgQueryCanceled = "57014"
+)
+
+var (
+	// ErrConflict is returned for unique violations of constraints without a more specific error
+	ErrConflict = errors.New("conflicting record exists")
+	// ErrInvalidReference is returned for foreign key violations
+	ErrInvalidReference = errors.New("referenced record does not exist")
+	// ErrMissingValue is returned for not-null violations
+	ErrMissingValue = errors.New("required value is missing")
+	// ErrQueryTimeout is returned when a query exceeds its context deadline or
+	// the server's statement_timeout
+	ErrQueryTimeout = errors.New("query timed out")
+)
+
+// constraintErrors maps constraint names to the repository error their
+// violation signals
+var constraintErrors = map[string]error{
+	"users_email_key": ErrUserAlreadyExists,
+}
+
+// mapPgError classifies a constraint violation or timeout in err. Violations
+// of a constraint listed in constraintErrors return its error; other unique,
+// foreign key and not-null violations return ErrConflict, ErrInvalidReference
+// and ErrMissingValue wrapped with the constraint or column name. Deadlines
+// and statement timeouts return ErrQueryTimeout wrapping err. It returns nil
+// for any other error.
+func mapPgError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch pgErr.Code {
+	case pgQueryCanceled:
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	case pgUniqueViolation, pgForeignKeyViolation:
+		if mapped, ok := constraintErrors[pgErr.ConstraintName]; ok {
+			return mapped
+		}
+		if pgErr.Code == pgUniqueViolation {
+			return fmt.Errorf("%w: %s", ErrConflict, pgErr.ConstraintName)
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidReference, pgErr.ConstraintName)
+	case pgNotNullViolation:
+		return fmt.Errorf("%w: %s.%s", ErrMissingValue, pgErr.TableName, pgErr.ColumnName)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go-starter/internal/testutil/pgtest"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMapPgError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"mapped constraint", &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "users_email_key"}, ErrUserAlreadyExists},
+		{"wrapped", fmt.Errorf("failed to commit transaction: %w", &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "users_email_key"}), ErrUserAlreadyExists},
+		{"other unique", &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "users_name_key"}, ErrConflict},
+		{"foreign key", &pgconn.PgError{Code: pgForeignKeyViolation, ConstraintName: "posts_user_id_fkey"}, ErrInvalidReference},
+		{"not null", &pgconn.PgError{Code: pgNotNullViolation, TableName: "users", ColumnName: "email"}, ErrMissingValue},
+		{"statement timeout", &pgconn.PgError{Code: pgQueryCanceled}, ErrQueryTimeout},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), ErrQueryTimeout},
+		{"other code", &pgconn.PgError{Code: "42P01"}, nil},
+		{"not a postgres error", errors.New("users_email_key"), nil},
+		{"no rows", sql.ErrNoRows, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapPgError(tt.err)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("mapPgError = %v, want nil", got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("mapPgError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Generic errors name what was violated
+	got := mapPgError(&pgconn.PgError{Code: pgNotNullViolation, TableName: "users", ColumnName: "email"})
+	if got.Error() != "required value is missing: users.email" {
+		t.Errorf("not-null error = %q", got)
+	}
+}
+
+// TestMapPgErrorFromPostgres checks the classification against errors raised
+// by a real server, including the constraint names Postgres generates
+func TestMapPgErrorFromPostgres(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (email, password_hash) VALUES ('taken@example.com', 'hash')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  error
+	}{
+		{"duplicate email", "INSERT INTO users (email, password_hash) VALUES ('taken@example.com', 'hash')", ErrUserAlreadyExists},
+		{"null email", "INSERT INTO users (email, password_hash) VALUES (NULL, 'hash')", ErrMissingValue},
+		{"missing user", "INSERT INTO user_refs (user_id) VALUES (999999)", ErrInvalidReference},
+		{"other unique", "INSERT INTO user_refs (user_id, code) VALUES ((SELECT id FROM users LIMIT 1), 'dup'), ((SELECT id FROM users LIMIT 1), 'dup')", ErrConflict},
+		{"statement timeout", "SELECT pg_sleep(1)", ErrQueryTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The failing query rolls back the transaction, table included
+			err := db.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, `CREATE TABLE user_refs (
+					user_id INTEGER REFERENCES users(id),
+					code TEXT UNIQUE
+				)`); err != nil {
+					t.Fatalf("create table: %v", err)
+				}
+				if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 100"); err != nil {
+					t.Fatalf("set statement_timeout: %v", err)
+				}
+				_, err := tx.ExecContext(ctx, tt.query)
+				return err
+			})
+			if err == nil {
+				t.Fatal("query succeeded")
+			}
+			if got := mapPgError(err); !errors.Is(got, tt.want) {
+				t.Errorf("mapPgError(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,43 +5,177 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"go-starter/internal/logger"
 	"go-starter/internal/models"
+	"go-starter/pkg/database"
+
+	"go.uber.org/zap"
 )
 
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	// ErrUnknownField is returned by UpdateFields for columns outside updatableFields
+	ErrUnknownField = errors.New("unknown field")
+	// ErrVersionConflict is returned by Update and UpdateFields when the user
+	// changed since it was read
+	ErrVersionConflict = errors.New("user was modified concurrently")
 )
 
+// updatableFields lists the users columns UpdateFields may set. Keys are
+// interpolated into the query, so only listed names are accepted.
+var updatableFields = map[string]bool{
+	"email":         true,
+	"password_hash": true,
+}
+
 // UserRepository handles database operations for users
 type UserRepository struct {
-	db *sql.DB
+	db *database.DB
+	// queryTimeout bounds each method call, including callers without a deadline
+	queryTimeout time.Duration
+	// tx, when set by WithTx, runs every query in that transaction
+	tx *sql.Tx
+}
+
+// usersTable reads users; the password hash is selected for authentication
+// and kept out of JSON by models.User
+var usersTable = table[models.User]{
+	name:     "users",
+	entity:   "user",
+	columns:  "id, email, password_hash, created_at, updated_at, deleted_at, version",
+	scan:     scanUser,
+	notFound: ErrUserNotFound,
+	live:     "deleted_at IS NULL",
+}
+
+// scanUser reads a row of usersTable.columns
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Version); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// QueryOption adjusts which users a read returns
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	includeDeleted bool
+}
+
+// IncludeDeleted makes a read also return soft-deleted users
+func IncludeDeleted() QueryOption {
+	return func(o *queryOptions) { o.includeDeleted = true }
+}
+
+// applyOptions collects opts
+func applyOptions(opts []QueryOption) queryOptions {
+	var o queryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// liveFilter returns the condition of a users query restricting it to users
+// that aren't soft-deleted, or TRUE when opts include them
+func liveFilter(opts []QueryOption) string {
+	if applyOptions(opts).includeDeleted {
+		return "TRUE"
+	}
+	return usersTable.live
+}
+
+// NewUserRepository creates a new user repository whose queries time out
+// after queryTimeout (0 leaves the caller's deadline alone)
+func NewUserRepository(db *database.DB, queryTimeout time.Duration) *UserRepository {
+	return &UserRepository{db: db, queryTimeout: queryTimeout}
+}
+
+// readRetryPolicy retries reads through a failover without holding the
+// request for long
+var readRetryPolicy = database.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    500 * time.Millisecond,
+	MaxElapsed:  time.Second,
+}
+
+// WithTx returns a copy of the repository whose queries run in tx. Callers
+// inside WithTransaction can use the repository directly instead, since the
+// context they are given already carries the transaction.
+func (r *UserRepository) WithTx(tx *sql.Tx) *UserRepository {
+	txRepo := *r
+	txRepo.tx = tx
+	return &txRepo
+}
+
+// queryContext prepares ctx for one method call: it carries r.tx when set and
+// is bounded by r.queryTimeout
+func (r *UserRepository) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.tx != nil {
+		ctx = database.ContextWithTx(ctx, r.tx)
+	}
+	return withQueryTimeout(ctx, r.queryTimeout)
+}
+
+// retryRead runs fn under readRetryPolicy, repeating it on lost connections
+// and other transient errors. Only reads may use it; writes could be applied
+// twice. Inside a transaction fn runs once: a lost connection aborts the
+// transaction, so retrying the read alone can't succeed.
+func retryRead(ctx context.Context, fn func() error) error {
+	if _, ok := database.TxFromContext(ctx); ok {
+		return fn()
+	}
+
+	policy := readRetryPolicy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		logger.FromContext(ctx).Warn("database read failed transiently, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+	}
+	return database.Retry(ctx, policy, func(context.Context) error { return fn() })
 }
 
-// NewUserRepository creates a new user repository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// withQueryTimeout returns ctx with a deadline d from now, or ctx's own
+// deadline when that is sooner. d <= 0 returns ctx unchanged.
+func withQueryTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
 }
 
 // Create creates a new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	query := `
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query, args, err := database.Named(`
 		INSERT INTO users (email, password_hash, created_at, updated_at)
-		VALUES ($1, $2, NOW(), NOW())
-		RETURNING id, created_at, updated_at
-	`
+		VALUES (:email, :password_hash, NOW(), NOW())
+		RETURNING id, created_at, updated_at, version
+	`, database.NamedArgs{
+		"email":         user.Email,
+		"password_hash": user.PasswordHash,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		user.Email,
-		user.PasswordHash,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err = writer(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Version)
 
 	if err != nil {
-		if err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"` {
-			return ErrUserAlreadyExists
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
 		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -49,80 +183,237 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// GetByEmail retrieves a user by email
-func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
+// maxBatchSize is the maximum number of rows inserted by a single statement
+const maxBatchSize = 500
 
-	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
+// CreateBatch creates many users in a single transaction using multi-row inserts.
+// Inputs larger than maxBatchSize are split into chunks. IDs and timestamps are
+// populated on the created users. The returned slice holds a per-user error,
+// ErrUserAlreadyExists for duplicate emails, or nil when the user was created.
+func (r *UserRepository) CreateBatch(ctx context.Context, users []*models.User) ([]error, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	rowErrs := make([]error, len(users))
+
+	err := r.db.Writer().WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for start := 0; start < len(users); start += maxBatchSize {
+			end := min(start+maxBatchSize, len(users))
+			if err := insertBatch(ctx, tx, users[start:end], rowErrs[start:end]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return nil, mapped
+		}
+		return nil, fmt.Errorf("failed to create users: %w", err)
+	}
+
+	return rowErrs, nil
+}
+
+// insertBatch inserts one chunk of users, skipping emails that already exist
+func insertBatch(ctx context.Context, tx *sql.Tx, users []*models.User, rowErrs []error) error {
+	var (
+		query strings.Builder
+		args  = make([]interface{}, 0, len(users)*2)
 	)
 
+	query.WriteString("INSERT INTO users (email, password_hash, created_at, updated_at) VALUES ")
+	for i, user := range users {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "($%d, $%d, NOW(), NOW())", len(args)+1, len(args)+2)
+		args = append(args, user.Email, user.PasswordHash)
+	}
+	query.WriteString(" ON CONFLICT (email) DO NOTHING RETURNING id, email, created_at, updated_at, version")
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrUserNotFound
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
 		}
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return fmt.Errorf("failed to insert batch: %w", err)
 	}
+	defer rows.Close()
 
-	return user, nil
+	// Map inserted rows back to the input by email
+	pending := make(map[string][]*models.User, len(users))
+	for _, user := range users {
+		pending[user.Email] = append(pending[user.Email], user)
+	}
+
+	inserted := make(map[*models.User]bool, len(users))
+	for rows.Next() {
+		var (
+			id, version          int
+			email                string
+			createdAt, updatedAt time.Time
+		)
+		if err := rows.Scan(&id, &email, &createdAt, &updatedAt, &version); err != nil {
+			return fmt.Errorf("failed to scan inserted user: %w", err)
+		}
+
+		if candidates := pending[email]; len(candidates) > 0 {
+			user := candidates[0]
+			pending[email] = candidates[1:]
+			user.ID, user.CreatedAt, user.UpdatedAt, user.Version = id, createdAt, updatedAt, version
+			inserted[user] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read inserted users: %w", err)
+	}
+
+	// Rows that weren't returned conflicted with an existing email
+	for i, user := range users {
+		if !inserted[user] {
+			rowErrs[i] = ErrUserAlreadyExists
+		}
+	}
+
+	return nil
+}
+
+// GetByEmail retrieves a user by email. Soft-deleted users are not found
+// unless IncludeDeleted is passed.
+func (r *UserRepository) GetByEmail(ctx context.Context, email string, opts ...QueryOption) (*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	return getBy(ctx, r.db, usersTable, "email", email, applyOptions(opts).includeDeleted)
+}
+
+// GetByID retrieves a user by ID. Soft-deleted users are not found unless
+// IncludeDeleted is passed.
+func (r *UserRepository) GetByID(ctx context.Context, id int, opts ...QueryOption) (*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	return getByID(ctx, r.db, usersTable, id, applyOptions(opts).includeDeleted)
 }
 
-// GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+// MaxSearchLimit caps the number of users returned by SearchByEmail
+const MaxSearchLimit = 100
+
+// likeEscaper escapes LIKE wildcards so user input matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchByEmail returns up to limit users, skipping the first offset, whose
+// email starts with prefix case-insensitively. Soft-deleted users are skipped
+// unless IncludeDeleted is passed.
+func (r *UserRepository) SearchByEmail(ctx context.Context, prefix string, limit, offset int, opts ...QueryOption) ([]*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT ` + usersTable.columns + `
 		FROM users
-		WHERE id = $1
+		WHERE email ILIKE $1 || '%' AND ` + liveFilter(opts) + `
+		ORDER BY email, id
+		LIMIT $2 OFFSET $3
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	users, err := queryAll(ctx, r.db, usersTable, query, likeEscaper.Replace(prefix), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
 
+	return users, nil
+}
+
+// ListAfter returns up to limit users with an ID greater than afterID, ordered
+// by ID. Unlike offset paging it stays fast on large tables and doesn't skip
+// or repeat users when others are inserted between pages. Soft-deleted users
+// are skipped unless IncludeDeleted is passed.
+func (r *UserRepository) ListAfter(ctx context.Context, afterID int, limit int, opts ...QueryOption) ([]*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	if limit <= 0 || limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	query := `
+		SELECT ` + usersTable.columns + `
+		FROM users
+		WHERE id > $1 AND ` + liveFilter(opts) + `
+		ORDER BY id
+		LIMIT $2
+	`
+
+	users, err := queryAll(ctx, r.db, usersTable, query, afterID, limit)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrUserNotFound
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountByEmail returns the number of users whose email starts with prefix
+// case-insensitively. Soft-deleted users are skipped unless IncludeDeleted is
+// passed.
+func (r *UserRepository) CountByEmail(ctx context.Context, prefix string, opts ...QueryOption) (int, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := `SELECT COUNT(*) FROM users WHERE email ILIKE $1 || '%' AND ` + liveFilter(opts)
+
+	var count int
+	err := retryRead(ctx, func() error {
+		return reader(ctx, r.db).QueryRowContext(ctx, query, likeEscaper.Replace(prefix)).Scan(&count)
+	})
+	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return 0, mapped
 		}
-		return nil, fmt.Errorf("failed to get user by id: %w", err)
+		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
 
-	return user, nil
+	return count, nil
 }
 
-// Update updates a user
+// Update updates a user that isn't soft-deleted, provided it is still at
+// user.Version, and increments the version. It returns ErrVersionConflict
+// when the user was changed since it was read.
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	query := `
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query, args, err := database.Named(`
 		UPDATE users
-		SET email = $1, password_hash = $2, updated_at = NOW()
-		WHERE id = $3
-		RETURNING updated_at
-	`
+		SET email = :email, password_hash = :password_hash, updated_at = NOW(), version = version + 1
+		WHERE id = :id AND version = :version AND deleted_at IS NULL
+		RETURNING updated_at, version
+	`, database.NamedArgs{
+		"id":            user.ID,
+		"email":         user.Email,
+		"password_hash": user.PasswordHash,
+		"version":       user.Version,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		user.Email,
-		user.PasswordHash,
-		user.ID,
-	).Scan(&user.UpdatedAt)
+	err = writer(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&user.UpdatedAt, &user.Version)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return ErrUserNotFound
+			return r.missedUpdate(ctx, user.ID)
+		}
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
 		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -130,12 +421,80 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// Delete deletes a user
+// missedUpdate explains an update of id that matched no row: ErrVersionConflict
+// when the user still exists, ErrUserNotFound otherwise
+func (r *UserRepository) missedUpdate(ctx context.Context, id int) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`
+	if err := writer(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("failed to check user exists: %w", err)
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrUserNotFound
+}
+
+// UpdateFields sets only the given columns of a user that isn't soft-deleted,
+// plus updated_at, provided it is still at version, increments the version
+// and returns the updated user. It returns ErrVersionConflict when the user
+// was changed since it was read. Columns must be listed in updatableFields.
+func (r *UserRepository) UpdateFields(ctx context.Context, id, version int, fields map[string]interface{}) (*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !updatableFields[column] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, column)
+		}
+		columns = append(columns, column)
+	}
+	// A stable order keeps the statement text, and its cached plan, the same
+	sort.Strings(columns)
+
+	var query strings.Builder
+	args := make([]interface{}, 0, len(columns)+2)
+	query.WriteString("UPDATE users SET ")
+	for _, column := range columns {
+		args = append(args, fields[column])
+		fmt.Fprintf(&query, "%s = $%d, ", column, len(args))
+	}
+	args = append(args, id, version)
+	fmt.Fprintf(&query, "updated_at = NOW(), version = version + 1 WHERE id = $%d AND version = $%d AND %s RETURNING %s",
+		len(args)-1, len(args), usersTable.live, usersTable.columns)
+
+	user, err := scanUser(writer(ctx, r.db).QueryRowContext(ctx, query.String(), args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, r.missedUpdate(ctx, id)
+		}
+		if mapped := mapPgError(err); mapped != nil {
+			return nil, mapped
+		}
+		return nil, fmt.Errorf("failed to update user fields: %w", err)
+	}
+
+	return user, nil
+}
+
+// Delete soft-deletes a user: the row is kept, with deleted_at set, so the
+// account can be restored. Reads skip it by default, and its email stays
+// taken until the row is purged with HardDelete.
 func (r *UserRepository) Delete(ctx context.Context, id int) error {
-	query := `DELETE FROM users WHERE id = $1`
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = NOW(), updated_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := writer(ctx, r.db).ExecContext(ctx, query, id)
 	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
+		}
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
@@ -143,10 +502,97 @@ func (r *UserRepository) Delete(ctx context.Context, id int) error {
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Restore undoes the soft deletion of a user and returns it. It returns
+// ErrUserNotFound when there is no soft-deleted user with the ID.
+func (r *UserRepository) Restore(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + usersTable.columns
+
+	user, err := scanUser(writer(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		if mapped := mapPgError(err); mapped != nil {
+			return nil, mapped
+		}
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	return user, nil
+}
+
+// HardDelete permanently removes a user row, soft-deleted or not. It is
+// reserved for the retention sweeper purging old soft-deleted accounts;
+// everything else deletes with Delete.
+func (r *UserRepository) HardDelete(ctx context.Context, id int) error {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	return deleteByID(ctx, r.db, usersTable, id)
+}
+
+// RevokeTokens records that the tokens of a user, soft-deleted or not,
+// issued at or before before are revoked. An earlier time never replaces a
+// later one.
+func (r *UserRepository) RevokeTokens(ctx context.Context, id int, before time.Time) error {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET tokens_revoked_at = GREATEST(tokens_revoked_at, $2) WHERE id = $1`
+
+	result, err := writer(ctx, r.db).ExecContext(ctx, query, id, before)
+	if err != nil {
+		if mapped := mapPgError(err); mapped != nil {
+			return mapped
+		}
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
 
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 	if rows == 0 {
 		return ErrUserNotFound
 	}
 
 	return nil
 }
+
+// TokensRevokedBefore returns the time at or before which the tokens of a
+// user, soft-deleted or not, are revoked, or the zero time when none are. It
+// reads from the primary so a revocation applies as soon as it commits.
+func (r *UserRepository) TokensRevokedBefore(ctx context.Context, id int) (time.Time, error) {
+	ctx, cancel := r.queryContext(ctx)
+	defer cancel()
+
+	var revokedAt sql.NullTime
+	query := `SELECT tokens_revoked_at FROM users WHERE id = $1`
+	err := retryRead(ctx, func() error {
+		return writer(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&revokedAt)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, ErrUserNotFound
+		}
+		if mapped := mapPgError(err); mapped != nil {
+			return time.Time{}, mapped
+		}
+		return time.Time{}, fmt.Errorf("failed to get token revocation: %w", err)
+	}
+
+	return revokedAt.Time, nil
+}
@@ -0,0 +1,261 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"go-starter/internal/models"
+	"go-starter/internal/testutil/pgtest"
+	"go-starter/pkg/database"
+)
+
+func TestMain(m *testing.M) { pgtest.Main(m) }
+
+// newTestRepository returns a repository on an empty test database
+func newTestRepository(t *testing.T) *UserRepository {
+	t.Helper()
+	return NewUserRepository(pgtest.New(t), 5*time.Second)
+}
+
+// createTestUser inserts a user with email
+func createTestUser(t *testing.T, repo *UserRepository, email string) *models.User {
+	t.Helper()
+	user := &models.User{Email: email, PasswordHash: "hash"}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create(%s): %v", email, err)
+	}
+	return user
+}
+
+func TestUpdateFieldsVersionConflict(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	created := createTestUser(t, repo, "a@example.com")
+
+	// Two clients read the same version of the user
+	first, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	second, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	// The first write wins and bumps the version
+	updated, err := repo.UpdateFields(ctx, first.ID, first.Version, map[string]interface{}{"email": "first@example.com"})
+	if err != nil {
+		t.Fatalf("first UpdateFields: %v", err)
+	}
+	if updated.Version != first.Version+1 {
+		t.Errorf("version = %d, want %d", updated.Version, first.Version+1)
+	}
+
+	// The second write was based on the old version and must not apply
+	_, err = repo.UpdateFields(ctx, second.ID, second.Version, map[string]interface{}{"email": "second@example.com"})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("second UpdateFields error = %v, want ErrVersionConflict", err)
+	}
+
+	current, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if current.Email != "first@example.com" || current.Version != updated.Version {
+		t.Errorf("user = %s v%d, want first@example.com v%d", current.Email, current.Version, updated.Version)
+	}
+}
+
+func TestUpdateFieldsMissingUser(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	_, err := repo.UpdateFields(ctx, 12345, 1, map[string]interface{}{"email": "x@example.com"})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateFields on missing user error = %v, want ErrUserNotFound", err)
+	}
+
+	user := createTestUser(t, repo, "deleted@example.com")
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = repo.UpdateFields(ctx, user.ID, user.Version, map[string]interface{}{"email": "y@example.com"})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateFields on deleted user error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUpdateFieldsRejectsUnknownColumns(t *testing.T) {
+	// Checked before any query, so no database is needed
+	repo := NewUserRepository(nil, 0)
+	_, err := repo.UpdateFields(context.Background(), 1, 1, map[string]interface{}{"id = 1; --": 1})
+	if !errors.Is(err, ErrUnknownField) {
+		t.Errorf("UpdateFields error = %v, want ErrUnknownField", err)
+	}
+}
+
+func TestRetryReadRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	err := retryRead(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("retryRead = %v after %d calls, want success after 2", err, calls)
+	}
+
+	// Inside a transaction the read can't be retried on its own
+	calls = 0
+	ctx := database.ContextWithTx(context.Background(), new(sql.Tx))
+	err = retryRead(ctx, func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if !errors.Is(err, driver.ErrBadConn) || calls != 1 {
+		t.Errorf("retryRead in a transaction = %v after %d calls, want the error after 1", err, calls)
+	}
+}
+
+// TestReadsSurviveTerminatedConnections kills the pool's connections on the
+// server, as a Postgres restart would, and checks reads recover
+func TestReadsSurviveTerminatedConnections(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "survivor@example.com")
+
+	// A second connection terminates every other backend of the database,
+	// including the idle one the repository will reuse
+	killer, err := repo.db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	defer killer.Close()
+	if _, err := killer.ExecContext(ctx, `
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid()
+	`); err != nil {
+		t.Fatalf("terminate backends: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID after connection loss: %v", err)
+	}
+	if got.Email != user.Email {
+		t.Errorf("email = %q, want %q", got.Email, user.Email)
+	}
+}
+
+func TestCreateDuplicateEmail(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	existing := createTestUser(t, repo, "taken@example.com")
+
+	err := repo.Create(ctx, &models.User{Email: "taken@example.com", PasswordHash: "hash"})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("Create with a taken email error = %v, want ErrUserAlreadyExists", err)
+	}
+
+	// Soft-deleted users keep their email until they are purged
+	if err := repo.Delete(ctx, existing.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	err = repo.Create(ctx, &models.User{Email: "taken@example.com", PasswordHash: "hash"})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("Create with a soft-deleted user's email error = %v, want ErrUserAlreadyExists", err)
+	}
+
+	if err := repo.HardDelete(ctx, existing.ID); err != nil {
+		t.Fatalf("HardDelete: %v", err)
+	}
+	createTestUser(t, repo, "taken@example.com")
+}
+
+func TestCreateBatchDuplicateEmails(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	createTestUser(t, repo, "existing@example.com")
+
+	users := []*models.User{
+		{Email: "new@example.com", PasswordHash: "hash"},
+		{Email: "existing@example.com", PasswordHash: "hash"},
+		{Email: "new@example.com", PasswordHash: "hash"},
+	}
+	rowErrs, err := repo.CreateBatch(ctx, users)
+	if err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+
+	want := []error{nil, ErrUserAlreadyExists, ErrUserAlreadyExists}
+	for i := range users {
+		if !errors.Is(rowErrs[i], want[i]) {
+			t.Errorf("row %d error = %v, want %v", i, rowErrs[i], want[i])
+		}
+	}
+	if users[0].ID == 0 || users[2].ID != 0 {
+		t.Errorf("IDs = %d, %d, want only the first new user created", users[0].ID, users[2].ID)
+	}
+}
+
+func TestUpdateToDuplicateEmail(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	createTestUser(t, repo, "a@example.com")
+	b := createTestUser(t, repo, "b@example.com")
+
+	b.Email = "a@example.com"
+	if err := repo.Update(ctx, b); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Update error = %v, want ErrUserAlreadyExists", err)
+	}
+	_, err := repo.UpdateFields(ctx, b.ID, b.Version, map[string]interface{}{"email": "a@example.com"})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("UpdateFields error = %v, want ErrUserAlreadyExists", err)
+	}
+}
+
+func TestUserNotFound(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	const missingID = 12345
+
+	deleted := createTestUser(t, repo, "deleted@example.com")
+	if err := repo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	live := createTestUser(t, repo, "live@example.com")
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"GetByID missing", func() error { _, err := repo.GetByID(ctx, missingID); return err }},
+		{"GetByID deleted", func() error { _, err := repo.GetByID(ctx, deleted.ID); return err }},
+		{"GetByEmail missing", func() error { _, err := repo.GetByEmail(ctx, "nobody@example.com"); return err }},
+		{"GetByEmail deleted", func() error { _, err := repo.GetByEmail(ctx, "deleted@example.com"); return err }},
+		{"Update missing", func() error { return repo.Update(ctx, &models.User{ID: missingID, Email: "x@example.com", Version: 1}) }},
+		{"Delete missing", func() error { return repo.Delete(ctx, missingID) }},
+		{"Delete twice", func() error { return repo.Delete(ctx, deleted.ID) }},
+		{"Restore missing", func() error { _, err := repo.Restore(ctx, missingID); return err }},
+		{"Restore live", func() error { _, err := repo.Restore(ctx, live.ID); return err }},
+		{"TokensRevokedBefore missing", func() error { _, err := repo.TokensRevokedBefore(ctx, missingID); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("error = %v, want ErrUserNotFound", err)
+			}
+		})
+	}
+
+	// Soft-deleted users are still found on request
+	if _, err := repo.GetByID(ctx, deleted.ID, IncludeDeleted()); err != nil {
+		t.Errorf("GetByID with IncludeDeleted: %v", err)
+	}
+}
@@ -2,47 +2,251 @@ package services
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	"go-starter/internal/audit"
+	"go-starter/internal/logger"
 	"go-starter/internal/models"
 	"go-starter/internal/repositories"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrTokenInvalid       = errors.New("invalid token")
+	ErrEmailUndeliverable = errors.New("email domain cannot receive mail")
+	ErrCannotDeleteSelf   = errors.New("cannot delete own account")
+	// ErrAccountDeleted is returned when registering with the email of a
+	// soft-deleted account, which support can restore instead
+	ErrAccountDeleted = errors.New("account was deleted")
+	// ErrVersionConflict is returned when a user changed since the client or
+	// service read it; the client should refetch and retry
+	ErrVersionConflict = errors.New("user was modified concurrently")
+	// ErrTimeout is wrapped by errors of operations whose database queries timed out
+	ErrTimeout = repositories.ErrQueryTimeout
 )
 
+// UserChangedChannel is the notification channel on which user updates and
+// deletions are published, with the user ID as payload
+const UserChangedChannel = "user_changed"
+
+// revocationCacheTTL is how long a user's token revocation read from the
+// database is trusted. It bounds how long an instance that missed a
+// UserChangedChannel notification keeps accepting revoked tokens.
+const revocationCacheTTL = 5 * time.Second
+
+// Notifier publishes notifications to the other instances, e.g. Postgres NOTIFY
+type Notifier interface {
+	Notify(ctx context.Context, channel, payload string) error
+}
+
+// Transactor runs fn in a transaction carried by the context it is given,
+// e.g. *database.DB
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(context.Context, *sql.Tx) error) error
+}
+
+// EmailChecker verifies that an email address can receive mail
+type EmailChecker interface {
+	Check(ctx context.Context, email string) error
+}
+
+// EmailChangedNotifier is told about a successful email change, e.g. to send
+// a verification message to the new address and a notice to the old one
+type EmailChangedNotifier interface {
+	EmailChanged(ctx context.Context, user *models.User, oldEmail string) error
+}
+
 // AuthService handles authentication business logic
 type AuthService struct {
-	userRepo  *repositories.UserRepository
-	jwtSecret []byte
+	userRepo *repositories.UserRepository
+	// keys verify tokens; keys[0] is the current secret and signs new tokens
+	keys      []signingKey
+	accessTTL time.Duration
+	// refreshTTL bounds how long a session can be extended before logging in again
+	refreshTTL time.Duration
+	audit      *audit.Recorder
+	// emailChecker optionally rejects undeliverable addresses; nil disables it
+	emailChecker EmailChecker
+	// emailChanged is optionally told about email changes; nil disables it
+	emailChanged EmailChangedNotifier
+	// notifier optionally tells other instances about user changes; nil disables it
+	notifier Notifier
+	// transactor makes multi-step writes atomic; nil runs the steps without a transaction
+	transactor Transactor
+	// adminUserIDs maps basic auth usernames to the admins' own user IDs
+	adminUserIDs map[string]int
+
+	// revocations caches the users.tokens_revoked_at values read by
+	// ValidateToken. UserChanged drops entries when another instance
+	// revokes tokens, and entries expire after revocationCacheTTL.
+	revocations map[int]revocation
+	// revocationsSwept is when expired revocations were last dropped
+	revocationsSwept time.Time
+	revokedMu        sync.RWMutex
+}
+
+// revocation is a cached users.tokens_revoked_at value
+type revocation struct {
+	// before is the time at or before which tokens are rejected; zero when
+	// none are
+	before time.Time
+	// checked is when before was read
+	checked time.Time
 }
 
-// NewAuthService creates a new authentication service
-func NewAuthService(userRepo *repositories.UserRepository, jwtSecret string) *AuthService {
+// signingKey is an HMAC secret and the key ID identifying it in token headers
+type signingKey struct {
+	id     string
+	secret []byte
+}
+
+// newSigningKey derives a key ID from secret without revealing it
+func newSigningKey(secret string) signingKey {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("jwt key id"))
+	return signingKey{
+		id:     hex.EncodeToString(mac.Sum(nil)[:8]),
+		secret: []byte(secret),
+	}
+}
+
+// NewAuthService creates a new authentication service. Tokens are signed with
+// jwtSecret; tokens signed with one of previousSecrets are still accepted so
+// the secret can be rotated without logging everyone out. Auth events are
+// written to auditor, which may be nil to disable auditing.
+func NewAuthService(userRepo *repositories.UserRepository, jwtSecret string, previousSecrets []string, accessTTL, refreshTTL time.Duration, auditor *audit.Recorder) *AuthService {
+	keys := []signingKey{newSigningKey(jwtSecret)}
+	for _, secret := range previousSecrets {
+		keys = append(keys, newSigningKey(secret))
+	}
+
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: []byte(jwtSecret),
+		userRepo:    userRepo,
+		keys:        keys,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		audit:       auditor,
+		revocations: make(map[int]revocation),
+	}
+}
+
+// SetEmailChecker sets the deliverability check applied to new email addresses
+func (s *AuthService) SetEmailChecker(checker EmailChecker) {
+	s.emailChecker = checker
+}
+
+// SetEmailChangedNotifier sets the notifier told about successful email
+// changes, e.g. to re-trigger email verification
+func (s *AuthService) SetEmailChangedNotifier(notifier EmailChangedNotifier) {
+	s.emailChanged = notifier
+}
+
+// SetNotifier sets the notifier used to publish user changes on UserChangedChannel
+func (s *AuthService) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// SetTransactor sets the transactor that makes multi-step writes, such as a
+// registration and its audit event, atomic
+func (s *AuthService) SetTransactor(transactor Transactor) {
+	s.transactor = transactor
+}
+
+// SetAdminUserIDs sets the user IDs of the admins' own accounts, keyed by
+// basic auth username, which DeleteUser refuses to delete for them
+func (s *AuthService) SetAdminUserIDs(ids map[string]int) {
+	s.adminUserIDs = ids
+}
+
+// AdminUserID returns the user ID of admin's own account, if configured
+func (s *AuthService) AdminUserID(admin string) (int, bool) {
+	id, ok := s.adminUserIDs[admin]
+	return id, ok
+}
+
+// inTransaction runs fn in a transaction when a transactor is set
+func (s *AuthService) inTransaction(ctx context.Context, fn func(context.Context) error) error {
+	if s.transactor == nil {
+		return fn(ctx)
+	}
+	return s.transactor.WithTransaction(ctx, func(ctx context.Context, _ *sql.Tx) error {
+		return fn(ctx)
+	})
+}
+
+// publishUserChanged tells other instances that userID changed. Failures are
+// logged; the change itself has already succeeded.
+func (s *AuthService) publishUserChanged(ctx context.Context, userID int) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.Notify(ctx, UserChangedChannel, strconv.Itoa(userID)); err != nil {
+		logger.FromContext(ctx).Warn("failed to publish user change", zap.Int("user_id", userID), zap.Error(err))
 	}
 }
 
+// UserChanged handles a UserChangedChannel payload published by another
+// instance. The user's cached token revocation is dropped, so their next
+// token is checked against the database.
+func (s *AuthService) UserChanged(ctx context.Context, payload string) error {
+	userID, err := strconv.Atoi(payload)
+	if err != nil {
+		return fmt.Errorf("invalid user changed payload %q", payload)
+	}
+
+	s.revokedMu.Lock()
+	defer s.revokedMu.Unlock()
+	delete(s.revocations, userID)
+	return nil
+}
+
+// checkEmail returns ErrEmailUndeliverable when the email checker rejects email
+func (s *AuthService) checkEmail(ctx context.Context, email string) error {
+	if s.emailChecker == nil {
+		return nil
+	}
+	if err := s.emailChecker.Check(ctx, email); err != nil {
+		return fmt.Errorf("%w: %w", ErrEmailUndeliverable, err)
+	}
+	return nil
+}
+
 // Register registers a new user
 func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest) (*models.AuthResponse, error) {
-	// Check if user already exists
-	existingUser, err := s.userRepo.GetByEmail(ctx, req.Email)
+	// Check if user already exists; a soft-deleted account keeps its email
+	existingUser, err := s.userRepo.GetByEmail(ctx, req.Email, repositories.IncludeDeleted())
 	if err != nil && err != repositories.ErrUserNotFound {
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
 	if existingUser != nil {
+		if existingUser.DeletedAt != nil {
+			s.audit.Record(ctx, audit.Event{Type: audit.EventRegister, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "account deleted"})
+			return nil, ErrAccountDeleted
+		}
+		s.audit.Record(ctx, audit.Event{Type: audit.EventRegister, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "email taken"})
 		return nil, ErrUserExists
 	}
 
+	if err := s.checkEmail(ctx, req.Email); err != nil {
+		s.audit.Record(ctx, audit.Event{Type: audit.EventRegister, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "email undeliverable"})
+		return nil, err
+	}
+
 	// Hash password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -55,23 +259,23 @@ func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest)
 		PasswordHash: string(passwordHash),
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		if err == repositories.ErrUserAlreadyExists {
+	// The user and its audit event commit together when auditing to the database
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return err
+		}
+		s.audit.Record(ctx, audit.Event{Type: audit.EventRegister, UserID: user.ID, Email: user.Email, Outcome: audit.OutcomeSuccess})
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserAlreadyExists) {
+			s.audit.Record(ctx, audit.Event{Type: audit.EventRegister, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "email taken"})
 			return nil, ErrUserExists
 		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
-	}
-
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return s.newAuthResponse(user)
 }
 
 // Login authenticates a user and returns a JWT token
@@ -80,6 +284,7 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if err == repositories.ErrUserNotFound {
+			s.audit.Record(ctx, audit.Event{Type: audit.EventLoginFailed, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "unknown email"})
 			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -87,64 +292,396 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		s.audit.Record(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: user.ID, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "wrong password"})
 		return nil, ErrInvalidCredentials
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user.ID)
+	response, err := s.newAuthResponse(user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
+	s.audit.Record(ctx, audit.Event{Type: audit.EventLogin, UserID: user.ID, Email: user.Email, Outcome: audit.OutcomeSuccess})
 
-	return &models.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return response, nil
+}
+
+// GetUser returns the user with the given ID
+func (s *AuthService) GetUser(ctx context.Context, userID int) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
 }
 
-// ValidateToken validates a JWT token and returns the user ID
-func (s *AuthService) ValidateToken(tokenString string) (int, error) {
+// UpdateMe applies a partial profile update. Fields omitted from req are left
+// unchanged; an empty update returns the current user. When req.Version is
+// set, the update is rejected with ErrVersionConflict unless it is current.
+func (s *AuthService) UpdateMe(ctx context.Context, userID int, req *models.UpdateMeRequest) (*models.User, error) {
+	var version int
+	if req.Version != nil {
+		version = *req.Version
+	}
+
+	if req.Email == nil {
+		user, err := s.GetUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && user.Version != version {
+			return nil, ErrVersionConflict
+		}
+		return user, nil
+	}
+	return s.UpdateEmail(ctx, userID, *req.Email, version)
+}
+
+// UpdateEmail changes only the email address of a user. A non-zero version
+// must match the user's current version. The write only applies to the
+// version read here, so a concurrent update makes it fail with
+// ErrVersionConflict rather than being overwritten. The email changed
+// notifier, if set, is told about the change.
+func (s *AuthService) UpdateEmail(ctx context.Context, userID int, newEmail string, version int) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if version != 0 && user.Version != version {
+		return nil, ErrVersionConflict
+	}
+	if user.Email == newEmail {
+		return user, nil
+	}
+
+	// Check the new email is not taken by another user
+	existingUser, err := s.userRepo.GetByEmail(ctx, newEmail)
+	if err != nil && err != repositories.ErrUserNotFound {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+	if existingUser != nil {
+		s.audit.Record(ctx, audit.Event{Type: audit.EventEmailChange, UserID: userID, Email: newEmail, Outcome: audit.OutcomeFailure, Reason: "email taken"})
+		return nil, ErrUserExists
+	}
+
+	if err := s.checkEmail(ctx, newEmail); err != nil {
+		s.audit.Record(ctx, audit.Event{Type: audit.EventEmailChange, UserID: userID, Email: newEmail, Outcome: audit.OutcomeFailure, Reason: "email undeliverable"})
+		return nil, err
+	}
+
+	oldEmail := user.Email
+	user, err = s.userRepo.UpdateFields(ctx, userID, user.Version, map[string]interface{}{"email": newEmail})
+	if err != nil {
+		switch err {
+		case repositories.ErrUserAlreadyExists:
+			return nil, ErrUserExists
+		case repositories.ErrUserNotFound:
+			return nil, ErrUserNotFound
+		case repositories.ErrVersionConflict:
+			s.audit.Record(ctx, audit.Event{Type: audit.EventEmailChange, UserID: userID, Email: newEmail, Outcome: audit.OutcomeFailure, Reason: "version conflict"})
+			return nil, ErrVersionConflict
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	s.publishUserChanged(ctx, userID)
+	s.audit.Record(ctx, audit.Event{Type: audit.EventEmailChange, UserID: userID, Email: newEmail, Outcome: audit.OutcomeSuccess})
+
+	// The change is committed, so a failed notification is only logged
+	if s.emailChanged != nil {
+		if err := s.emailChanged.EmailChanged(ctx, user, oldEmail); err != nil {
+			logger.FromContext(ctx).Warn("failed to notify email change", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}
+
+	return user, nil
+}
+
+// DeleteAccount deletes a user after confirming their password and revokes their tokens
+func (s *AuthService) DeleteAccount(ctx context.Context, userID int, password string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Verify password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		s.audit.Record(ctx, audit.Event{Type: audit.EventAccountDelete, UserID: userID, Email: user.Email, Outcome: audit.OutcomeFailure, Reason: "wrong password"})
+		return ErrInvalidCredentials
+	}
+
+	if err := s.deleteAndRevoke(ctx, userID); err != nil {
+		return err
+	}
+	s.publishUserChanged(ctx, userID)
+	s.audit.Record(ctx, audit.Event{Type: audit.EventAccountDelete, UserID: userID, Email: user.Email, Outcome: audit.OutcomeSuccess})
+	return nil
+}
+
+// DeleteUser deletes a user on behalf of admin, the basic auth username. An
+// admin can't delete their own account, as set by SetAdminUserIDs, this way,
+// so a mistyped ID can't lock them out.
+func (s *AuthService) DeleteUser(ctx context.Context, userID int, admin string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if id, ok := s.AdminUserID(admin); ok && id == userID {
+		return ErrCannotDeleteSelf
+	}
+
+	if err := s.deleteAndRevoke(ctx, userID); err != nil {
+		return err
+	}
+	s.publishUserChanged(ctx, userID)
+	s.audit.Record(ctx, audit.Event{Type: audit.EventAdminDelete, UserID: userID, Email: user.Email, Outcome: audit.OutcomeSuccess, Reason: "deleted by admin " + admin})
+	return nil
+}
+
+// RestoreUser undoes the deletion of a user on behalf of admin. Tokens issued
+// before the deletion stay revoked, so the user logs in again.
+func (s *AuthService) RestoreUser(ctx context.Context, userID int, admin string) (*models.User, error) {
+	user, err := s.userRepo.Restore(ctx, userID)
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{Type: audit.EventAdminRestore, UserID: userID, Email: user.Email, Outcome: audit.OutcomeSuccess, Reason: "restored by admin " + admin})
+	return user, nil
+}
+
+// SearchUsers returns a page of users whose email starts with prefix, along
+// with the total number of matching users
+func (s *AuthService) SearchUsers(ctx context.Context, prefix string, limit, offset int) ([]*models.User, int, error) {
+	total, err := s.userRepo.CountByEmail(ctx, prefix)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	users, err := s.userRepo.SearchByEmail(ctx, prefix, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// ListUsers returns up to limit users with an ID greater than afterID, ordered by ID
+func (s *AuthService) ListUsers(ctx context.Context, afterID int, limit int) ([]*models.User, error) {
+	users, err := s.userRepo.ListAfter(ctx, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// deleteAndRevoke soft-deletes a user and revokes every token issued so far,
+// together so a deleted user's tokens are rejected by every instance, including
+// ones started later
+func (s *AuthService) deleteAndRevoke(ctx context.Context, userID int) error {
+	now := time.Now()
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Delete(ctx, userID); err != nil {
+			return err
+		}
+		return s.userRepo.RevokeTokens(ctx, userID, now)
+	})
+	if err != nil {
+		if err == repositories.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	s.cacheRevocation(userID, revocation{before: now, checked: now})
+	return nil
+}
+
+// isRevoked reports whether a token issued at issuedAt for a user has been
+// revoked. The revocation is read from the database unless a cached one is
+// younger than revocationCacheTTL. Tokens of users that no longer exist are
+// revoked.
+func (s *AuthService) isRevoked(ctx context.Context, userID int, issuedAt time.Time) (bool, error) {
+	now := time.Now()
+
+	s.revokedMu.RLock()
+	cached, ok := s.revocations[userID]
+	s.revokedMu.RUnlock()
+
+	if !ok || now.Sub(cached.checked) >= revocationCacheTTL {
+		before, err := s.userRepo.TokensRevokedBefore(ctx, userID)
+		if err != nil && err != repositories.ErrUserNotFound {
+			return false, err
+		}
+		if err == repositories.ErrUserNotFound {
+			before = now
+		}
+
+		cached = revocation{before: before, checked: now}
+		s.cacheRevocation(userID, cached)
+	}
+
+	return !cached.before.IsZero() && !issuedAt.After(cached.before), nil
+}
+
+// cacheRevocation stores r for userID. Expired revocations are dropped at
+// most once per revocationCacheTTL, so the cache only holds recently active
+// users instead of everyone who ever authenticated.
+func (s *AuthService) cacheRevocation(userID int, r revocation) {
+	s.revokedMu.Lock()
+	defer s.revokedMu.Unlock()
+
+	if r.checked.Sub(s.revocationsSwept) >= revocationCacheTTL {
+		s.revocationsSwept = r.checked
+		for id, cached := range s.revocations {
+			if r.checked.Sub(cached.checked) >= revocationCacheTTL {
+				delete(s.revocations, id)
+			}
+		}
+	}
+	s.revocations[userID] = r
+}
+
+// CheckSigning issues a token with the current key and validates it, so a
+// misconfigured secret is caught before the first login
+func (s *AuthService) CheckSigning(ctx context.Context) error {
+	token, err := s.generateToken(0, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, _, err := s.parseToken(token); err != nil {
+		return fmt.Errorf("failed to validate own token: %w", err)
+	}
+	return nil
+}
+
+// ValidateToken validates a JWT token, including that it hasn't been
+// revoked, and returns the user ID. Failures wrap ErrTokenExpired when the
+// token has expired and ErrTokenInvalid when it is invalid or revoked; other
+// errors mean the revocation couldn't be checked.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (int, error) {
+	userID, issuedAt, err := s.parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.isRevoked(ctx, userID, issuedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return 0, fmt.Errorf("%w: token has been revoked", ErrTokenInvalid)
+	}
+
+	return userID, nil
+}
+
+// parseToken verifies the signature and expiry of a JWT token and returns
+// its user ID and issue time
+func (s *AuthService) parseToken(tokenString string) (userID int, issuedAt time.Time, err error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return s.jwtSecret, nil
+		return s.verificationKey(token)
 	})
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse token: %w", err)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return 0, time.Time{}, fmt.Errorf("%w: %w", ErrTokenExpired, err)
+		}
+		return 0, time.Time{}, fmt.Errorf("%w: failed to parse token: %w", ErrTokenInvalid, err)
 	}
 
 	if !token.Valid {
-		return 0, errors.New("invalid token")
+		return 0, time.Time{}, ErrTokenInvalid
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, errors.New("invalid token claims")
+		return 0, time.Time{}, fmt.Errorf("%w: invalid claims", ErrTokenInvalid)
 	}
 
 	// Extract user ID from subject
 	sub, ok := claims["sub"].(float64)
 	if !ok {
-		return 0, errors.New("invalid token subject")
+		return 0, time.Time{}, fmt.Errorf("%w: invalid subject", ErrTokenInvalid)
+	}
+
+	// The issue time is compared with revocations
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return 0, time.Time{}, fmt.Errorf("%w: invalid issued at", ErrTokenInvalid)
 	}
 
-	return int(sub), nil
+	return int(sub), iat.Time, nil
 }
 
-// generateToken generates a JWT token for a user
-func (s *AuthService) generateToken(userID int) (string, error) {
+// verificationKey returns the key named by the token's kid header. Tokens
+// without a kid, issued before key IDs were added, are tried against every key.
+func (s *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok {
+		for _, key := range s.keys {
+			if key.id == kid {
+				return key.secret, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	var set jwt.VerificationKeySet
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.secret)
+	}
+	return set, nil
+}
+
+// newAuthResponse issues an access token for user along with its expirations
+func (s *AuthService) newAuthResponse(user *models.User) (*models.AuthResponse, error) {
 	now := time.Now()
+	token, err := s.generateToken(user.ID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &models.AuthResponse{
+		Token:            token,
+		ExpiresAt:        now.Add(s.accessTTL).UTC(),
+		RefreshExpiresAt: now.Add(s.refreshTTL).UTC(),
+		User:             user,
+	}, nil
+}
+
+// generateToken generates a JWT token for a user, issued at now
+func (s *AuthService) generateToken(userID int, now time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": userID,
 		"iat": now.Unix(),
-		"exp": now.Add(24 * time.Hour).Unix(),
+		"exp": now.Add(s.accessTTL).Unix(),
 	}
 
+	key := s.keys[0]
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtSecret)
+	token.Header["kid"] = key.id
+	tokenString, err := token.SignedString(key.secret)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go-starter/internal/models"
+	"go-starter/internal/repositories"
+	"go-starter/internal/testutil/pgtest"
+)
+
+func TestMain(m *testing.M) { pgtest.Main(m) }
+
+const testSecret = "test-secret-that-is-long-enough-for-hs256"
+
+// newTestAuthService returns a service on an empty test database along with
+// its repository
+func newTestAuthService(t *testing.T) (*AuthService, *repositories.UserRepository) {
+	t.Helper()
+	repo := repositories.NewUserRepository(pgtest.New(t), 5*time.Second)
+	return NewAuthService(repo, testSecret, nil, 15*time.Minute, 24*time.Hour, nil), repo
+}
+
+func TestUpdateMeVersionConflict(t *testing.T) {
+	svc, repo := newTestAuthService(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "me@example.com", PasswordHash: "hash"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	read := user.Version
+
+	// Two clients send PATCH /me based on the version they both read
+	first := "first@example.com"
+	updated, err := svc.UpdateMe(ctx, user.ID, &models.UpdateMeRequest{Email: &first, Version: &read})
+	if err != nil {
+		t.Fatalf("first UpdateMe: %v", err)
+	}
+	second := "second@example.com"
+	if _, err := svc.UpdateMe(ctx, user.ID, &models.UpdateMeRequest{Email: &second, Version: &read}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("second UpdateMe error = %v, want ErrVersionConflict", err)
+	}
+
+	// Refetching and retrying with the current version succeeds
+	current := updated.Version
+	retried, err := svc.UpdateMe(ctx, user.ID, &models.UpdateMeRequest{Email: &second, Version: &current})
+	if err != nil {
+		t.Fatalf("retried UpdateMe: %v", err)
+	}
+	if retried.Email != second || retried.Version != current+1 {
+		t.Errorf("user = %s v%d, want %s v%d", retried.Email, retried.Version, second, current+1)
+	}
+}
+
+func TestRevocationSurvivesRestart(t *testing.T) {
+	svc, repo := newTestAuthService(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "gone@example.com", PasswordHash: "hash"}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token, err := svc.generateToken(user.ID, time.Now())
+	if err != nil {
+		t.Fatalf("generateToken: %v", err)
+	}
+	if _, err := svc.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("ValidateToken before deletion: %v", err)
+	}
+
+	if err := svc.DeleteUser(ctx, user.ID, "admin"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := svc.ValidateToken(ctx, token); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("ValidateToken after deletion error = %v, want ErrTokenInvalid", err)
+	}
+
+	// A restarted instance, or one that missed the notification, reads the
+	// revocation from the database
+	restarted := NewAuthService(repo, testSecret, nil, 15*time.Minute, 24*time.Hour, nil)
+	if _, err := restarted.ValidateToken(ctx, token); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("ValidateToken on a new instance error = %v, want ErrTokenInvalid", err)
+	}
+
+	// Restoring the account keeps tokens issued before the deletion revoked
+	if _, err := svc.RestoreUser(ctx, user.ID, "admin"); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if _, err := restarted.ValidateToken(ctx, token); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("ValidateToken after restore error = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestCheckSigningNeedsNoDatabase(t *testing.T) {
+	svc := NewAuthService(nil, testSecret, nil, 15*time.Minute, 24*time.Hour, nil)
+	if err := svc.CheckSigning(context.Background()); err != nil {
+		t.Errorf("CheckSigning: %v", err)
+	}
+}
+
+func TestRevocationCacheDropsExpiredEntries(t *testing.T) {
+	svc := NewAuthService(nil, testSecret, nil, 15*time.Minute, 24*time.Hour, nil)
+	start := time.Now()
+
+	for id := 1; id <= 100; id++ {
+		svc.cacheRevocation(id, revocation{checked: start})
+	}
+	// A write once the entries have expired sweeps them
+	later := start.Add(revocationCacheTTL)
+	svc.cacheRevocation(101, revocation{before: later, checked: later})
+
+	if len(svc.revocations) != 1 {
+		t.Errorf("cache holds %d revocations, want only the fresh one", len(svc.revocations))
+	}
+	if _, ok := svc.revocations[101]; !ok {
+		t.Error("fresh revocation was dropped")
+	}
+}
+
+func TestDeleteUserRefusesAdminsOwnAccount(t *testing.T) {
+	svc, repo := newTestAuthService(t)
+	ctx := context.Background()
+
+	own := &models.User{Email: "ops@example.com", PasswordHash: "hash"}
+	other := &models.User{Email: "other@example.com", PasswordHash: "hash"}
+	for _, user := range []*models.User{own, other} {
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	svc.SetAdminUserIDs(map[string]int{"ops": own.ID})
+
+	if err := svc.DeleteUser(ctx, own.ID, "ops"); !errors.Is(err, ErrCannotDeleteSelf) {
+		t.Errorf("deleting own account error = %v, want ErrCannotDeleteSelf", err)
+	}
+	// Other admins, and other accounts, are not affected
+	if err := svc.DeleteUser(ctx, other.ID, "ops"); err != nil {
+		t.Errorf("deleting another account: %v", err)
+	}
+	if err := svc.DeleteUser(ctx, own.ID, "alice"); err != nil {
+		t.Errorf("deleting the account as another admin: %v", err)
+	}
+}
+
+// recordingEmailNotifier records the email changes it is told about
+type recordingEmailNotifier struct {
+	changes []string
+}
+
+func (n *recordingEmailNotifier) EmailChanged(_ context.Context, user *models.User, oldEmail string) error {
+	n.changes = append(n.changes, oldEmail+" -> "+user.Email)
+	return nil
+}
+
+func TestUpdateEmailNotifiesChange(t *testing.T) {
+	svc, repo := newTestAuthService(t)
+	ctx := context.Background()
+	notifier := &recordingEmailNotifier{}
+	svc.SetEmailChangedNotifier(notifier)
+
+	user := &models.User{Email: "old@example.com", PasswordHash: "hash"}
+	taken := &models.User{Email: "taken@example.com", PasswordHash: "hash"}
+	for _, u := range []*models.User{user, taken} {
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if _, err := svc.UpdateEmail(ctx, user.ID, "new@example.com", 0); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+	// Unchanged and rejected emails are not notified
+	if _, err := svc.UpdateEmail(ctx, user.ID, "new@example.com", 0); err != nil {
+		t.Fatalf("UpdateEmail to the same email: %v", err)
+	}
+	if _, err := svc.UpdateEmail(ctx, user.ID, "taken@example.com", 0); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("UpdateEmail to a taken email error = %v, want ErrUserExists", err)
+	}
+
+	if want := []string{"old@example.com -> new@example.com"}; !slices.Equal(notifier.changes, want) {
+		t.Errorf("notified %q, want %q", notifier.changes, want)
+	}
+}
@@ -0,0 +1,163 @@
+// Package stats collects lightweight in-memory request statistics per client.
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencySamples is the number of recent latencies kept per client for p95
+	latencySamples = 128
+	// evictionSamples is the number of clients compared to pick one to evict
+	evictionSamples = 5
+)
+
+// ClientStats summarizes recent traffic from a single client
+type ClientStats struct {
+	Client   string  `json:"client"`
+	Requests float64 `json:"requests"`
+	Errors   float64 `json:"errors"`
+	P95Ms    float64 `json:"p95_ms"`
+}
+
+// clientEntry holds the decayed counters and recent latencies for a client
+type clientEntry struct {
+	requests   float64
+	errors     float64
+	updatedAt  time.Time
+	latencies  [latencySamples]time.Duration
+	numSamples int
+	next       int
+}
+
+// ClientCollector tracks per-client request counts, error counts and latency.
+// Counts decay exponentially with the configured half-life so that the
+// statistics reflect a sliding window, and at most maxClients are tracked:
+// when full, the client with the least recent traffic among a few sampled
+// ones is evicted, so recording stays cheap however many clients are tracked.
+type ClientCollector struct {
+	mu         sync.Mutex
+	clients    map[string]*clientEntry
+	maxClients int
+	halfLife   time.Duration
+	now        func() time.Time
+}
+
+// NewClientCollector creates a collector tracking up to maxClients clients
+// whose counts halve every halfLife
+func NewClientCollector(maxClients int, halfLife time.Duration) *ClientCollector {
+	return &ClientCollector{
+		clients:    make(map[string]*clientEntry, maxClients),
+		maxClients: maxClients,
+		halfLife:   halfLife,
+		now:        time.Now,
+	}
+}
+
+// Record adds a completed request for client
+func (c *ClientCollector) Record(client string, status int, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry, ok := c.clients[client]
+	if !ok {
+		if len(c.clients) >= c.maxClients {
+			c.evictLocked(now)
+		}
+		entry = &clientEntry{updatedAt: now}
+		c.clients[client] = entry
+	}
+
+	c.decayLocked(entry, now)
+	entry.requests++
+	if status >= 500 {
+		entry.errors++
+	}
+
+	entry.latencies[entry.next] = duration
+	entry.next = (entry.next + 1) % latencySamples
+	if entry.numSamples < latencySamples {
+		entry.numSamples++
+	}
+}
+
+// Top returns the n clients with the most recent requests
+func (c *ClientCollector) Top(n int) []ClientStats {
+	c.mu.Lock()
+	now := c.now()
+	result := make([]ClientStats, 0, len(c.clients))
+	for client, entry := range c.clients {
+		c.decayLocked(entry, now)
+		result = append(result, ClientStats{
+			Client:   client,
+			Requests: math.Round(entry.requests*100) / 100,
+			Errors:   math.Round(entry.errors*100) / 100,
+			P95Ms:    float64(entry.p95()) / float64(time.Millisecond),
+		})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Requests > result[j].Requests
+	})
+
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// decayLocked applies exponential decay to the entry's counters
+func (c *ClientCollector) decayLocked(entry *clientEntry, now time.Time) {
+	elapsed := now.Sub(entry.updatedAt)
+	if elapsed <= 0 {
+		return
+	}
+
+	factor := math.Pow(0.5, float64(elapsed)/float64(c.halfLife))
+	entry.requests *= factor
+	entry.errors *= factor
+	entry.updatedAt = now
+}
+
+// evictLocked removes the client with the lowest decayed request count among
+// evictionSamples of them. Map iteration starts at a random entry, so the
+// first clients visited are a random sample, as in Redis' approximated LRU.
+func (c *ClientCollector) evictLocked(now time.Time) {
+	var (
+		victim  string
+		lowest  = math.Inf(1)
+		sampled int
+	)
+
+	for client, entry := range c.clients {
+		c.decayLocked(entry, now)
+		if entry.requests < lowest {
+			victim = client
+			lowest = entry.requests
+		}
+		if sampled++; sampled == evictionSamples {
+			break
+		}
+	}
+
+	delete(c.clients, victim)
+}
+
+// p95 returns the 95th percentile of the recent latencies
+func (e *clientEntry) p95() time.Duration {
+	if e.numSamples == 0 {
+		return 0
+	}
+
+	samples := make([]time.Duration, e.numSamples)
+	copy(samples, e.latencies[:e.numSamples])
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	idx := int(math.Ceil(0.95*float64(len(samples)))) - 1
+	return samples[idx]
+}
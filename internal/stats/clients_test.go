@@ -0,0 +1,27 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClientCollectorEvictsQuietClients(t *testing.T) {
+	c := NewClientCollector(100, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 1000; i++ {
+		c.Record("busy", 200, time.Millisecond)
+	}
+	for i := 0; i < 10000; i++ {
+		c.Record(fmt.Sprintf("client-%d", i), 200, time.Millisecond)
+	}
+
+	if len(c.clients) != 100 {
+		t.Errorf("tracking %d clients, want at most 100", len(c.clients))
+	}
+	if top := c.Top(1); len(top) != 1 || top[0].Client != "busy" {
+		t.Errorf("Top(1) = %v, want the busy client to survive eviction", top)
+	}
+}
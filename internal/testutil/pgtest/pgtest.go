@@ -0,0 +1,164 @@
+// Package pgtest provides Postgres databases for integration tests. Tests use
+// the database at TEST_DATABASE_URL when it is set, e.g. one provisioned by
+// CI; otherwise a disposable container is started with the docker CLI. Tests
+// are skipped when neither is available.
+//
+// A package using New should run its tests through Main, which removes the
+// container when they finish:
+//
+//	func TestMain(m *testing.M) { pgtest.Main(m) }
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-starter/internal/migrations"
+	"go-starter/pkg/database"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// EnvURL names the variable holding the URL of an existing test database.
+	// Its tables are truncated by every test, so it must not hold real data.
+	EnvURL = "TEST_DATABASE_URL"
+	// image matches the Postgres version of docker-compose.yml
+	image = "postgres:15-alpine"
+)
+
+var (
+	setupOnce sync.Once
+	// dsn is the migrated test database; empty when none is available
+	dsn string
+	// skipReason explains why dsn is empty
+	skipReason string
+	// container is the ID of the container started for the run, if any
+	container string
+)
+
+// Main runs the tests of a package and removes the container they used
+func Main(m *testing.M) {
+	code := m.Run()
+	if container != "" {
+		_ = exec.Command("docker", "rm", "-f", container).Run()
+	}
+	os.Exit(code)
+}
+
+// New returns a connection to a migrated test database with every table
+// except schema_migrations emptied. The connection is closed when t ends. New
+// skips t when no database is available and fails it when setup fails.
+func New(t testing.TB) *database.DB {
+	t.Helper()
+
+	setupOnce.Do(setup)
+	if dsn == "" {
+		t.Skip(skipReason)
+	}
+
+	db, err := database.New(database.Config{DSN: dsn, MaxConns: 4}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("pgtest: failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := truncate(context.Background(), db); err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+
+	return db
+}
+
+// setup finds or starts the test database and applies the migrations
+func setup() {
+	dsn = os.Getenv(EnvURL)
+	if dsn == "" {
+		var err error
+		if dsn, err = startContainer(); err != nil {
+			dsn, skipReason = "", fmt.Sprintf("pgtest: %s is not set and no container could be started: %v", EnvURL, err)
+			return
+		}
+	}
+
+	// Connecting retries while a new container finishes starting
+	db, err := database.New(database.Config{DSN: dsn, MaxConns: 1, PingRetries: 8, PingBaseDelay: 250 * time.Millisecond}, zap.NewNop())
+	if err != nil {
+		dsn, skipReason = "", fmt.Sprintf("pgtest: failed to connect: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if err := migrations.Up(context.Background(), db.DB, func(uint, string) {}); err != nil {
+		dsn, skipReason = "", fmt.Sprintf("pgtest: failed to migrate: %v", err)
+	}
+}
+
+// startContainer runs a Postgres container on a random local port and
+// returns its URL
+func startContainer() (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", err
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_USER=pgtest",
+		"-e", "POSTGRES_PASSWORD=pgtest",
+		"-e", "POSTGRES_DB=pgtest",
+		"-p", "127.0.0.1::5432",
+		image,
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("docker run: %w", err)
+	}
+	container = strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", container, "5432/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("docker port: %w", err)
+	}
+	// The first line is the mapping, e.g. "127.0.0.1:49153"
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+
+	return fmt.Sprintf("postgres://pgtest:pgtest@%s/pgtest?sslmode=disable", addr), nil
+}
+
+// truncate empties every table of the current schema except the migration
+// history, restarting identity sequences
+func truncate(ctx context.Context, db *database.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT quote_ident(tablename)
+		FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, "TRUNCATE "+strings.Join(tables, ", ")+" RESTART IDENTITY CASCADE"); err != nil {
+		return fmt.Errorf("failed to truncate tables: %w", err)
+	}
+	return nil
+}
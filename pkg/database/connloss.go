@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// SQLSTATE codes sent when the server terminates connections (class 57)
+const (
+	sqlStateAdminShutdown          = "57P01"
+	sqlStateCrashShutdown          = "57P02"
+	sqlStateCannotConnectNow       = "57P03"
+	sqlStateConnectionFailure      = "08006"
+	sqlStateConnectionDoesNotExist = "08003"
+)
+
+// IsTransient reports whether err is a lost or refused connection that a new
+// connection may not hit: a bad or reset connection, a refused dial, a server
+// shutting down or restarting, or an error pgconn marks as safe to retry
+// because the statement was never sent. Context errors are never transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case sqlStateAdminShutdown, sqlStateCrashShutdown, sqlStateCannotConnectNow,
+			sqlStateConnectionFailure, sqlStateConnectionDoesNotExist:
+			return true
+		}
+		return false
+	}
+
+	var netErr *net.OpError
+	return errors.As(err, &netErr)
+}
+
+// connLossMonitor logs when queries start failing with lost connections and
+// when a new connection is established afterwards
+type connLossMonitor struct {
+	logger *zap.Logger
+	lost   atomic.Bool
+}
+
+// observe records a failed query, logging the first lost connection
+func (m *connLossMonitor) observe(err error) {
+	if IsTransient(err) && m.lost.CompareAndSwap(false, true) {
+		m.logger.Warn("database connection lost", zap.Error(err))
+	}
+}
+
+// afterConnect is the pool's AfterConnect hook, logging the first connection
+// made after a loss
+func (m *connLossMonitor) afterConnect(_ context.Context, _ *pgx.Conn) error {
+	if m.lost.CompareAndSwap(true, false) {
+		m.logger.Info("database connection re-established")
+	}
+	return nil
+}
+
+// beforeAcquire is the pool's BeforeAcquire hook; it discards connections
+// that were closed while idle. pgxpool also pings connections idle for over
+// a second before handing them out.
+func (m *connLossMonitor) beforeAcquire(_ context.Context, conn *pgx.Conn) bool {
+	return !conn.IsClosed()
+}
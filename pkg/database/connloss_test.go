@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad connection", driver.ErrBadConn, true},
+		{"wrapped bad connection", fmt.Errorf("query: %w", driver.ErrBadConn), true},
+		{"connection reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"cannot connect now", &pgconn.PgError{Code: "57P03"}, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"plain error", errors.New("connection reset by peer"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConnLossMonitorLogsLossAndRecoveryOnce(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	m := &connLossMonitor{logger: zap.New(core)}
+
+	// Failures that aren't connection losses are ignored
+	m.observe(&pgconn.PgError{Code: "23505"})
+	// Only the first of many failed queries is logged
+	for i := 0; i < 3; i++ {
+		m.observe(driver.ErrBadConn)
+	}
+	// and only the first new connection afterwards
+	for i := 0; i < 2; i++ {
+		if err := m.afterConnect(context.Background(), nil); err != nil {
+			t.Fatalf("afterConnect: %v", err)
+		}
+	}
+
+	var got []string
+	for _, entry := range logs.All() {
+		got = append(got, entry.Message)
+	}
+	want := []string{"database connection lost", "database connection re-established"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+// flakyQuery fails with err the first failures calls, then succeeds
+type flakyQuery struct {
+	err      error
+	failures int
+	calls    int
+}
+
+func (q *flakyQuery) run(context.Context) error {
+	q.calls++
+	if q.calls <= q.failures {
+		return q.err
+	}
+	return nil
+}
+
+func TestRetryRecoversFromTransientErrors(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	var retried []int
+	policy.OnRetry = func(attempt int, _ time.Duration, _ error) { retried = append(retried, attempt) }
+
+	q := &flakyQuery{err: driver.ErrBadConn, failures: 2}
+	before := RetryStats()
+	if err := Retry(context.Background(), policy, q.run); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if q.calls != 3 || fmt.Sprint(retried) != "[1 2]" {
+		t.Errorf("calls = %d, retries = %v, want 3 calls after retries [1 2]", q.calls, retried)
+	}
+	if got := RetryStats().Retries - before.Retries; got != 2 {
+		t.Errorf("retry counter grew by %d, want 2", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	// Errors a new connection won't fix are returned at once
+	q := &flakyQuery{err: &pgconn.PgError{Code: "23505"}, failures: 5}
+	if err := Retry(context.Background(), policy, q.run); !errors.Is(err, q.err) || q.calls != 1 {
+		t.Errorf("non-transient: error = %v after %d calls, want it after 1", err, q.calls)
+	}
+
+	// A connection that stays down exhausts the policy
+	before := RetryStats()
+	q = &flakyQuery{err: driver.ErrBadConn, failures: 5}
+	if err := Retry(context.Background(), policy, q.run); !errors.Is(err, driver.ErrBadConn) || q.calls != 3 {
+		t.Errorf("persistent: error = %v after %d calls, want it after 3", err, q.calls)
+	}
+	if got := RetryStats().Exhausted - before.Exhausted; got != 1 {
+		t.Errorf("exhausted counter grew by %d, want 1", got)
+	}
+
+	// MaxElapsed stops before a wait that would overrun it
+	q = &flakyQuery{err: driver.ErrBadConn, failures: 5}
+	policy = RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxElapsed: 100 * time.Millisecond}
+	start := time.Now()
+	if err := Retry(context.Background(), policy, q.run); err == nil || q.calls != 1 {
+		t.Errorf("elapsed: error = %v after %d calls, want it after 1", err, q.calls)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, want no wait past MaxElapsed", elapsed)
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	q := &flakyQuery{err: driver.ErrBadConn, failures: 100}
+	err := Retry(ctx, RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second}, q.run)
+	if !errors.Is(err, driver.ErrBadConn) || q.calls != 1 {
+		t.Errorf("error = %v after %d calls, want the last error after 1", err, q.calls)
+	}
+}
@@ -4,106 +4,319 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
 
-// DB wraps the database connection
+// DB wraps the database connection. The embedded *sql.DB draws its
+// connections from a pgxpool.Pool, which Pool exposes for native pgx access
+// (batches, COPY); both paths share the same connections and limits.
 type DB struct {
 	*sql.DB
+	pool   *pgxpool.Pool
 	logger *zap.Logger
+	// done stops the stats reporter
+	done chan struct{}
+
+	// replicas serve read-only queries; empty when reads go to the primary
+	replicas    []*DB
+	nextReplica atomic.Uint64
 }
 
 // Config holds database connection configuration
 type Config struct {
-	DSN             string
-	MaxOpenConns    int
-	MaxIdleConns    int
-	ConnMaxLifetime time.Duration
-	ConnMaxIdleTime time.Duration
+	DSN string
+	// ReplicaDSNs optionally lists read replicas used by Reader
+	ReplicaDSNs []string
+	// MaxConns and MinConns bound the pgxpool size (pgxpool defaults when 0)
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// HealthCheckPeriod is how often idle connections are checked and expired
+	HealthCheckPeriod time.Duration
+	// PingRetries is the number of connection attempts on startup (default 5)
+	PingRetries int
+	// PingBaseDelay is the initial backoff between attempts, doubled each retry (default 500ms)
+	PingBaseDelay time.Duration
+	// SlowQueryThreshold logs queries taking longer than this at warn level
+	// instead of debug (0 disables)
+	SlowQueryThreshold time.Duration
+	// ContextLogger optionally returns a request-scoped logger for query logs
+	ContextLogger func(context.Context) *zap.Logger
+	// StatsInterval logs pool statistics this often (0 disables)
+	StatsInterval time.Duration
+	// StatementTimeout is set as statement_timeout on every connection (0 keeps the server default)
+	StatementTimeout time.Duration
+}
+
+const (
+	defaultPingRetries   = 5
+	defaultPingBaseDelay = 500 * time.Millisecond
+	// pingAttemptTimeout bounds a single ping attempt
+	pingAttemptTimeout = 5 * time.Second
+)
+
+// pinger is the subset of *sql.DB used to check connectivity
+type pinger interface {
+	PingContext(ctx context.Context) error
 }
 
-// New creates a new database connection
+// New creates a new database connection to the primary and any configured replicas
 func New(cfg Config, logger *zap.Logger) (*DB, error) {
-	db, err := sql.Open("pgx", cfg.DSN)
+	db, err := open(cfg.DSN, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, dsn := range cfg.ReplicaDSNs {
+		replica, err := open(dsn, cfg, logger.With(zap.Int("replica", i)))
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		db.replicas = append(db.replicas, replica)
+	}
+
+	logger.Info("database connection established",
+		zap.Int32("max_conns", db.pool.Config().MaxConns),
+		zap.Int32("min_conns", db.pool.Config().MinConns),
+		zap.Duration("max_conn_lifetime", db.pool.Config().MaxConnLifetime),
+		zap.Duration("max_conn_idle_time", db.pool.Config().MaxConnIdleTime),
+		zap.Duration("health_check_period", db.pool.Config().HealthCheckPeriod),
+		zap.Int("replicas", len(db.replicas)),
+	)
+
+	if cfg.StatsInterval > 0 {
+		go db.reportStats(cfg.StatsInterval)
+	}
+
+	return db, nil
+}
+
+// open opens a connection pool for dsn and waits until it responds
+func open(dsn string, cfg Config, logger *zap.Logger) (*DB, error) {
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	// Set connection pool settings, keeping pgxpool defaults for zero values
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxConns)
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = int32(cfg.MinConns)
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	// The server cancels statements running longer than this on every
+	// connection; a session can still override it with SET
+	if cfg.StatementTimeout > 0 {
+		poolCfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	// Log every query with its duration and affected rows, and connections
+	// being lost and re-established
+	connLoss := &connLossMonitor{logger: logger}
+	poolCfg.ConnConfig.Tracer = &queryTracer{
+		logger:             logger,
+		slowQueryThreshold: cfg.SlowQueryThreshold,
+		contextLogger:      cfg.ContextLogger,
+		connLoss:           connLoss,
+	}
+	poolCfg.AfterConnect = connLoss.afterConnect
+	poolCfg.BeforeAcquire = connLoss.beforeAcquire
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	// The sql.DB keeps no idle connections of its own, they stay in the pool
+	db := stdlib.OpenDBFromPool(pool)
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(cfg.MaxOpenConns)
-	db.SetMaxIdleConns(cfg.MaxIdleConns)
-	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
-	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	retries := cfg.PingRetries
+	if retries <= 0 {
+		retries = defaultPingRetries
+	}
+	baseDelay := cfg.PingBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultPingBaseDelay
+	}
 
-	// Test connection with retries
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Test connection with retries, allowing enough time for the whole schedule
+	ctx, cancel := context.WithTimeout(context.Background(), retryScheduleDuration(retries, baseDelay))
 	defer cancel()
 
-	if err := pingWithRetry(ctx, db, 5, logger); err != nil {
+	if err := pingWithRetry(ctx, db, retries, baseDelay, logger); err != nil {
 		db.Close()
+		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	logger.Info("database connection established",
-		zap.Int("max_open_conns", cfg.MaxOpenConns),
-		zap.Int("max_idle_conns", cfg.MaxIdleConns),
-	)
-
 	return &DB{
 		DB:     db,
+		pool:   pool,
 		logger: logger,
+		done:   make(chan struct{}),
 	}, nil
 }
 
-// pingWithRetry attempts to ping the database with retries
-func pingWithRetry(ctx context.Context, db *sql.DB, maxRetries int, logger *zap.Logger) error {
+// Pool returns the underlying pgx pool for native access such as batches
+// and COPY. It is shared with the embedded *sql.DB.
+func (db *DB) Pool() *pgxpool.Pool {
+	return db.pool
+}
+
+// Writer returns the handle for queries that modify data (the primary)
+func (db *DB) Writer() *DB {
+	return db
+}
+
+// Reader returns a handle for read-only queries, rotating between replicas.
+// It returns the primary when no replicas are configured.
+func (db *DB) Reader() *DB {
+	if len(db.replicas) == 0 {
+		return db
+	}
+	i := db.nextReplica.Add(1)
+	return db.replicas[i%uint64(len(db.replicas))]
+}
+
+// pingWithRetry attempts to ping the database with exponential backoff and jitter
+func pingWithRetry(ctx context.Context, db pinger, maxRetries int, baseDelay time.Duration, logger *zap.Logger) error {
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		err = db.PingContext(ctx)
+		attemptCtx, cancel := context.WithTimeout(ctx, pingAttemptTimeout)
+		err = db.PingContext(attemptCtx)
+		cancel()
 		if err == nil {
 			return nil
 		}
 
+		// No need to wait after the last attempt
+		if i == maxRetries-1 {
+			break
+		}
+
+		delay := backoffDelay(baseDelay, i)
 		logger.Warn("failed to ping database, retrying",
 			zap.Int("attempt", i+1),
 			zap.Int("max_retries", maxRetries),
+			zap.Duration("retry_in", delay),
 			zap.Error(err),
 		)
 
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(time.Second * time.Duration(i+1)):
-			continue
+		case <-time.After(delay):
 		}
 	}
 	return err
 }
 
-// Close closes the database connection
+// backoffDelay returns the delay before retry attempt+1: base * 2^attempt,
+// with the upper half randomized so instances don't retry in lockstep
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << attempt
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryScheduleDuration returns the longest time a full retry schedule can take
+func retryScheduleDuration(retries int, baseDelay time.Duration) time.Duration {
+	total := time.Duration(retries) * pingAttemptTimeout
+	for i := 0; i < retries-1; i++ {
+		total += baseDelay << i
+	}
+	return total
+}
+
+// Close closes the database connection and any replica connections
 func (db *DB) Close() error {
+	for _, replica := range db.replicas {
+		if err := replica.Close(); err != nil {
+			db.logger.Error("failed to close replica connection", zap.Error(err))
+		}
+	}
+
+	close(db.done)
 	db.logger.Info("closing database connection")
-	return db.DB.Close()
+	err := db.DB.Close()
+	db.pool.Close()
+	return err
 }
 
-// Health checks the database connection health
+// healthRetryPolicy lets a health check ride out a single lost connection
+var healthRetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: 50 * time.Millisecond}
+
+// Health checks the health of the primary and replica connections
 func (db *DB) Health(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	if err := db.PingContext(ctx); err != nil {
+	if err := Retry(ctx, healthRetryPolicy, db.PingContext); err != nil {
 		return fmt.Errorf("database health check failed: %w", err)
 	}
 
+	for i, replica := range db.replicas {
+		if err := Retry(ctx, healthRetryPolicy, replica.PingContext); err != nil {
+			return fmt.Errorf("replica %d health check failed: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
-// WithTransaction executes a function within a database transaction
-func (db *DB) WithTransaction(ctx context.Context, fn func(*sql.Tx) error) error {
-	tx, err := db.BeginTx(ctx, nil)
+// CheckAcquire checks that a connection can be taken from the primary pool
+// within timeout, returning it straight away. Unlike a ping it fails when the
+// pool is exhausted.
+func (db *DB) CheckAcquire(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	conn.Release()
+	return nil
+}
+
+// WithTransaction executes a function within a database transaction. fn
+// receives a context carrying the transaction; see WithTransactionOpts.
+func (db *DB) WithTransaction(ctx context.Context, fn func(context.Context, *sql.Tx) error) error {
+	return db.WithTransactionOpts(ctx, sql.TxOptions{}, fn)
+}
+
+// WithTransactionOpts executes a function within a database transaction
+// started with the given isolation level and read-only setting. fn receives
+// a context carrying the transaction, which queries made through Querier
+// join.
+//
+// When ctx already carries a transaction, fn runs inside a savepoint of it
+// instead and opts are ignored: a failure rolls back only fn's changes, and
+// the outer transaction decides whether they commit.
+func (db *DB) WithTransactionOpts(ctx context.Context, opts sql.TxOptions, fn func(context.Context, *sql.Tx) error) error {
+	if active, ok := ctx.Value(txKey{}).(activeTx); ok {
+		return db.withSavepoint(ctx, active, fn)
+	}
+
+	tx, err := db.BeginTx(ctx, &opts)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -115,7 +328,7 @@ func (db *DB) WithTransaction(ctx context.Context, fn func(*sql.Tx) error) error
 		}
 	}()
 
-	if err := fn(tx); err != nil {
+	if err := fn(context.WithValue(ctx, txKey{}, activeTx{tx: tx}), tx); err != nil {
 		if rbErr := tx.Rollback(); rbErr != nil {
 			db.logger.Error("failed to rollback transaction",
 				zap.Error(rbErr),
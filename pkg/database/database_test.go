@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// failingPinger fails the first failures pings, then succeeds
+type failingPinger struct {
+	failures int
+	calls    int
+}
+
+func (p *failingPinger) PingContext(ctx context.Context) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestPingWithRetryRecovers(t *testing.T) {
+	p := &failingPinger{failures: 2}
+	if err := pingWithRetry(context.Background(), p, 5, time.Millisecond, zap.NewNop()); err != nil {
+		t.Fatalf("pingWithRetry: %v", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("pings = %d, want 3", p.calls)
+	}
+}
+
+func TestPingWithRetryGivesUp(t *testing.T) {
+	p := &failingPinger{failures: 100}
+	err := pingWithRetry(context.Background(), p, 4, time.Millisecond, zap.NewNop())
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("error = %v, want the last ping error", err)
+	}
+	if p.calls != 4 {
+		t.Errorf("pings = %d, want 4", p.calls)
+	}
+}
+
+func TestPingWithRetryStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	p := &failingPinger{failures: 100}
+	start := time.Now()
+	err := pingWithRetry(ctx, p, 10, time.Second, zap.NewNop())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v; the backoff wait ignored the context", elapsed)
+	}
+	if p.calls != 1 {
+		t.Errorf("pings = %d, want 1", p.calls)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 6; attempt++ {
+		full := base << attempt
+		for i := 0; i < 50; i++ {
+			if d := backoffDelay(base, attempt); d < full/2 || d > full {
+				t.Fatalf("backoffDelay(%v, %d) = %v, want within [%v, %v]", base, attempt, d, full/2, full)
+			}
+		}
+	}
+}
+
+func TestRetryScheduleDurationCoversEveryAttempt(t *testing.T) {
+	// Five attempts of up to 5s each plus waits of 0.5s, 1s, 2s and 4s
+	want := 5*pingAttemptTimeout + 7500*time.Millisecond
+	if got := retryScheduleDuration(5, 500*time.Millisecond); got != want {
+		t.Errorf("retryScheduleDuration = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NamedArgs maps parameter names used as :name in a query to their values
+type NamedArgs map[string]interface{}
+
+// Named rewrites a query using :name parameters into PostgreSQL positional
+// $n parameters and returns the matching argument list. Repeated names reuse
+// the same position, "::" type casts and quoted strings are left untouched.
+func Named(query string, args NamedArgs) (string, []interface{}, error) {
+	var (
+		b         strings.Builder
+		values    []interface{}
+		positions = make(map[string]int)
+	)
+
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			// Copy quoted literals and identifiers verbatim
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// Type cast such as ::text
+			b.WriteString("::")
+			i++
+
+		case c == ':' && i+1 < len(query) && isNameChar(query[i+1]):
+			start := i + 1
+			end := start
+			for end < len(query) && isNameChar(query[end]) {
+				end++
+			}
+			name := query[start:end]
+
+			pos, ok := positions[name]
+			if !ok {
+				value, found := args[name]
+				if !found {
+					return "", nil, fmt.Errorf("missing named parameter %q", name)
+				}
+				values = append(values, value)
+				pos = len(values)
+				positions[name] = pos
+			}
+
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(pos))
+			i = end - 1
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), values, nil
+}
+
+// isNameChar reports whether c can appear in a parameter name
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// NamedExecContext executes a query with :name parameters
+func (db *DB) NamedExecContext(ctx context.Context, query string, args NamedArgs) (sql.Result, error) {
+	q, values, err := Named(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, q, values...)
+}
+
+// NamedQueryRowContext executes a query with :name parameters that returns at most one row
+func (db *DB) NamedQueryRowContext(ctx context.Context, query string, args NamedArgs) (*sql.Row, error) {
+	q, values, err := Named(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryRowContext(ctx, q, values...), nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// listenBaseDelay and listenMaxDelay bound the backoff between reconnects
+	listenBaseDelay = 500 * time.Millisecond
+	listenMaxDelay  = 30 * time.Second
+)
+
+// Notify sends payload to the listeners of channel (pg_notify). Notifications
+// are delivered when the surrounding transaction, if any, commits.
+func (db *DB) Notify(ctx context.Context, channel, payload string) error {
+	if _, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", channel, err)
+	}
+	return nil
+}
+
+// Listen subscribes to channel on a dedicated connection outside the pool and
+// calls handler with the payload of each notification, one at a time, until
+// ctx is canceled or the DB is closed. A lost connection is re-established
+// with backoff and resubscribed; notifications sent while disconnected are
+// lost. Listen blocks, so run it in its own goroutine.
+func (db *DB) Listen(ctx context.Context, channel string, handler func(payload string)) error {
+	if channel == "" {
+		return errors.New("listen channel must not be empty")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-db.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logger := db.logger.With(zap.String("channel", channel))
+	for attempt := 0; ; attempt++ {
+		subscribed, err := db.listenOnce(ctx, channel, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if subscribed {
+			attempt = 0
+		}
+
+		delay := min(backoffDelay(listenBaseDelay, min(attempt, 10)), listenMaxDelay)
+		logger.Warn("lost listen connection, reconnecting",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// listenOnce connects, subscribes and delivers notifications until the
+// connection fails or ctx is canceled. subscribed reports whether LISTEN
+// succeeded, which resets the reconnect backoff.
+func (db *DB) listenOnce(ctx context.Context, channel string, handler func(payload string)) (subscribed bool, err error) {
+	conn, err := pgx.ConnectConfig(ctx, db.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn.Close(closeCtx)
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return false, fmt.Errorf("failed to listen: %w", err)
+	}
+	db.logger.Debug("listening for notifications", zap.String("channel", channel))
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		handler(notification.Payload)
+	}
+}
@@ -0,0 +1,138 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-starter/internal/testutil/pgtest"
+	"go-starter/pkg/database"
+)
+
+// startListener runs Listen on channel until the test ends and returns the
+// payloads it receives
+func startListener(t *testing.T, db *database.DB, channel string) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	payloads := make(chan string, 100)
+	done := make(chan error, 1)
+	go func() { done <- db.Listen(ctx, channel, func(payload string) { payloads <- payload }) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Listen: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("Listen did not return after cancellation")
+		}
+	})
+	return payloads
+}
+
+// awaitSubscribed notifies channel until the listener receives a
+// notification, draining it, as Listen subscribes asynchronously
+func awaitSubscribed(t *testing.T, db *database.DB, channel string, payloads <-chan string) {
+	t.Helper()
+	deadline := time.After(15 * time.Second)
+	for {
+		if err := db.Notify(context.Background(), channel, "ready"); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		select {
+		case <-payloads:
+			// Drop further "ready" notifications still in flight
+			for {
+				select {
+				case <-payloads:
+				case <-time.After(100 * time.Millisecond):
+					return
+				}
+			}
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("listener never received a notification")
+		}
+	}
+}
+
+// receive returns the next payload, failing t when none arrives in time
+func receive(t *testing.T, payloads <-chan string) string {
+	t.Helper()
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+		return ""
+	}
+}
+
+func TestListenRejectsEmptyChannel(t *testing.T) {
+	// The channel is checked before the database is used
+	if err := new(database.DB).Listen(context.Background(), "", func(string) {}); err == nil {
+		t.Error("Listen accepted an empty channel")
+	}
+}
+
+func TestListenDeliversNotifications(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	const channel = "test_delivery"
+
+	payloads := startListener(t, db, channel)
+	awaitSubscribed(t, db, channel, payloads)
+
+	for _, payload := range []string{"user_changed:1", "user_changed:2"} {
+		if err := db.Notify(ctx, channel, payload); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	// Notifications on other channels are not delivered
+	if err := db.Notify(ctx, "test_other", "user_changed:3"); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	for _, want := range []string{"user_changed:1", "user_changed:2"} {
+		if got := receive(t, payloads); got != want {
+			t.Errorf("payload = %q, want %q", got, want)
+		}
+	}
+	select {
+	case payload := <-payloads:
+		t.Errorf("unexpected payload %q", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestListenResubscribesAfterConnectionLoss(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	const channel = "test_reconnect"
+
+	payloads := startListener(t, db, channel)
+	awaitSubscribed(t, db, channel, payloads)
+
+	// Kill the listener's backend as a server restart would
+	var killed int
+	err := db.QueryRowContext(ctx, `
+		SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid() AND query = 'LISTEN "`+channel+`"'
+	`).Scan(&killed)
+	if err != nil {
+		t.Fatalf("terminate listener: %v", err)
+	}
+	if killed != 1 {
+		t.Fatalf("terminated %d listener connections, want 1", killed)
+	}
+
+	// Listen reconnects with backoff and receives again
+	awaitSubscribed(t, db, channel, payloads)
+	if err := db.Notify(ctx, channel, "after reconnect"); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got := receive(t, payloads); got != "after reconnect" {
+		t.Errorf("payload = %q, want %q", got, "after reconnect")
+	}
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// SQLSTATE codes of transaction failures that succeed when retried
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// retryBaseDelay is the initial backoff between transaction attempts
+const retryBaseDelay = 10 * time.Millisecond
+
+// TxResult reports how a retried transaction ran
+type TxResult struct {
+	// Attempts is the number of times the transaction was run, including the last
+	Attempts int
+}
+
+// WithRetryTransaction executes fn within a transaction started with opts,
+// re-running the whole transaction with jittered backoff when it fails with a
+// serialization failure or deadlock, up to maxAttempts times in total. The last
+// error is returned when every attempt fails.
+//
+// fn may run more than once, so it must be safe to re-run: it should only
+// change state through tx, which is rolled back before each retry, and must
+// not rely on side effects of a previous attempt.
+//
+// When ctx already carries a transaction, fn runs once in a savepoint: a
+// serialization failure aborts the outer transaction, so only its owner can
+// retry.
+func (db *DB) WithRetryTransaction(ctx context.Context, opts sql.TxOptions, maxAttempts int, fn func(context.Context, *sql.Tx) error) (TxResult, error) {
+	var result TxResult
+	if _, ok := TxFromContext(ctx); ok || maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for {
+		result.Attempts++
+		err := db.WithTransactionOpts(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) || result.Attempts >= maxAttempts {
+			return result, err
+		}
+
+		delay := backoffDelay(retryBaseDelay, result.Attempts-1)
+		db.logger.Warn("transaction conflict, retrying",
+			zap.Int("attempt", result.Attempts),
+			zap.Int("max_attempts", maxAttempts),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// IsRetryable reports whether err is a Postgres serialization failure or
+// deadlock, after which the whole transaction can be retried
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// RetryPolicy bounds how Retry repeats a failing operation
+type RetryPolicy struct {
+	// MaxAttempts is the total number of runs, including the first (at least 1)
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubled on each further
+	// retry with jitter, up to MaxDelay when set
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxElapsed stops retrying once the next attempt would start later than
+	// this after the first (0 means no limit)
+	MaxElapsed time.Duration
+	// OnRetry is optionally called before each retry
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// RetryCounts reports the work done by Retry across the process
+type RetryCounts struct {
+	// Retries is the number of repeated attempts
+	Retries int64 `json:"retries"`
+	// Exhausted is the number of operations that still failed transiently
+	// when their policy ran out
+	Exhausted int64 `json:"exhausted"`
+}
+
+var retryRetries, retryExhausted atomic.Int64
+
+// RetryStats returns the process-wide Retry counters
+func RetryStats() RetryCounts {
+	return RetryCounts{Retries: retryRetries.Load(), Exhausted: retryExhausted.Load()}
+}
+
+// Retry runs fn, repeating it with backoff while it fails with a transient
+// error (IsTransient) or a serialization failure or deadlock (IsRetryable),
+// until policy runs out or ctx is done. The last error is returned.
+//
+// fn may run more than once, so only wrap reads and other idempotent work;
+// a write whose connection was lost after sending may already be applied.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !(IsTransient(err) || IsRetryable(err)) {
+			return err
+		}
+
+		delay := backoffDelay(policy.BaseDelay, min(attempt-1, 20))
+		if policy.MaxDelay > 0 {
+			delay = min(delay, policy.MaxDelay)
+		}
+		if attempt >= policy.MaxAttempts || (policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed) {
+			retryExhausted.Add(1)
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, delay, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		retryRetries.Add(1)
+	}
+}
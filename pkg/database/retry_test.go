@@ -0,0 +1,190 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go-starter/internal/testutil/pgtest"
+	"go-starter/pkg/database"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMain(m *testing.M) { pgtest.Main(m) }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{&pgconn.PgError{Code: "40P01"}, true},
+		{fmt.Errorf("failed to commit transaction: %w", &pgconn.PgError{Code: "40001"}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("40001"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := database.IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// countUsers returns the number of users with email
+func countUsers(ctx context.Context, t *testing.T, q database.Querier, email string) int {
+	t.Helper()
+	var n int
+	if err := q.QueryRowContext(ctx, "SELECT count(*) FROM users WHERE email = $1", email).Scan(&n); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	return n
+}
+
+// insertUser adds a user with email through q
+func insertUser(ctx context.Context, q database.Querier, email string) error {
+	_, err := q.ExecContext(ctx, "INSERT INTO users (email, password_hash) VALUES ($1, 'hash')", email)
+	return err
+}
+
+func TestWithRetryTransactionRerunsFromScratch(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	const email = "retry@example.com"
+
+	calls := 0
+	result, err := db.WithRetryTransaction(ctx, sql.TxOptions{Isolation: sql.LevelSerializable}, 5, func(ctx context.Context, tx *sql.Tx) error {
+		calls++
+		// Each attempt starts from a rolled-back state
+		if n := countUsers(ctx, t, tx, email); n != 0 {
+			t.Errorf("attempt %d sees %d rows from earlier attempts", calls, n)
+		}
+		if err := insertUser(ctx, tx, email); err != nil {
+			return err
+		}
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRetryTransaction: %v", err)
+	}
+	if result.Attempts != 3 || calls != 3 {
+		t.Errorf("attempts = %d (calls %d), want 3", result.Attempts, calls)
+	}
+	if n := countUsers(ctx, t, db, email); n != 1 {
+		t.Errorf("%d rows committed, want 1", n)
+	}
+}
+
+func TestWithRetryTransactionReturnsLastError(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"retryable until exhausted", &pgconn.PgError{Code: "40P01", Message: "deadlock detected"}, 3},
+		{"not retryable", &pgconn.PgError{Code: "23505", Message: "duplicate key"}, 1},
+		{"plain error", errors.New("boom"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := db.WithRetryTransaction(ctx, sql.TxOptions{}, 3, func(ctx context.Context, tx *sql.Tx) error {
+				if err := insertUser(ctx, tx, "failed@example.com"); err != nil {
+					return err
+				}
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+			if result.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", result.Attempts, tt.wantAttempts)
+			}
+			if n := countUsers(ctx, t, db, "failed@example.com"); n != 0 {
+				t.Errorf("%d rows committed by failed attempts", n)
+			}
+		})
+	}
+}
+
+func TestWithRetryTransactionRunsOnceInsideTransaction(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	conflict := &pgconn.PgError{Code: "40001"}
+
+	err := db.WithTransaction(ctx, func(ctx context.Context, _ *sql.Tx) error {
+		result, err := db.WithRetryTransaction(ctx, sql.TxOptions{}, 5, func(context.Context, *sql.Tx) error {
+			return conflict
+		})
+		if result.Attempts != 1 {
+			t.Errorf("attempts inside a transaction = %d, want 1", result.Attempts)
+		}
+		return err
+	})
+	if !errors.Is(err, conflict) {
+		t.Errorf("error = %v, want the conflict for the outer transaction to retry", err)
+	}
+}
+
+// TestWithRetryTransactionResolvesSerializationFailure runs two serializable
+// transactions that read the same rows before writing, so Postgres aborts one
+// of them, and checks the retry lets both commit
+func TestWithRetryTransactionResolvesSerializationFailure(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	opts := sql.TxOptions{Isolation: sql.LevelSerializable}
+
+	var read sync.WaitGroup
+	read.Add(2)
+	run := func(email string) (database.TxResult, error) {
+		attempt := 0
+		return db.WithRetryTransaction(ctx, opts, 5, func(ctx context.Context, tx *sql.Tx) error {
+			attempt++
+			var n int
+			if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM users").Scan(&n); err != nil {
+				return err
+			}
+			// Both first attempts read before either writes
+			if attempt == 1 {
+				read.Done()
+				read.Wait()
+			}
+			return insertUser(ctx, tx, email)
+		})
+	}
+
+	var wg sync.WaitGroup
+	results := make([]database.TxResult, 2)
+	errs := make([]error, 2)
+	for i, email := range []string{"a@example.com", "b@example.com"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = run(email)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+	if total := results[0].Attempts + results[1].Attempts; total < 3 {
+		t.Errorf("attempts = %d and %d, want one transaction retried", results[0].Attempts, results[1].Attempts)
+	}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if n := countUsers(ctx, t, db, email); n != 1 {
+			t.Errorf("%s committed %d times, want once", email, n)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stats describes the connection pool
+type Stats struct {
+	OpenConnections int `json:"open_connections"`
+	InUse           int `json:"in_use"`
+	Idle            int `json:"idle"`
+	// WaitCount is the total number of acquires that waited for a connection
+	WaitCount int64 `json:"wait_count"`
+	// WaitDuration is the total time spent acquiring connections
+	WaitDuration time.Duration `json:"wait_duration"`
+}
+
+// Stats returns statistics for the primary's connection pool. It replaces
+// sql.DB.Stats, which doesn't see connections managed by the pgx pool.
+func (db *DB) Stats() Stats {
+	s := db.pool.Stat()
+	return Stats{
+		OpenConnections: int(s.TotalConns()),
+		InUse:           int(s.AcquiredConns()),
+		Idle:            int(s.IdleConns()),
+		WaitCount:       s.EmptyAcquireCount(),
+		WaitDuration:    s.AcquireDuration(),
+	}
+}
+
+// reportStats logs pool statistics every interval until db.done is closed,
+// warning when requests had to wait for a connection since the last sample
+func (db *DB) reportStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := db.Stats()
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+		}
+
+		stats := db.Stats()
+		fields := []zap.Field{
+			zap.Int("open_connections", stats.OpenConnections),
+			zap.Int("in_use", stats.InUse),
+			zap.Int("idle", stats.Idle),
+			zap.Int64("wait_count", stats.WaitCount),
+			zap.Duration("wait_duration", stats.WaitDuration),
+		}
+
+		if waits := stats.WaitCount - prev.WaitCount; waits > 0 {
+			db.logger.Warn("database pool exhausted, requests waited for a connection", append(fields,
+				zap.Int64("new_waits", waits),
+				zap.Duration("new_wait_duration", stats.WaitDuration-prev.WaitDuration),
+			)...)
+		} else {
+			db.logger.Info("database pool stats", fields...)
+		}
+		prev = stats
+	}
+}
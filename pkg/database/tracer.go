@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// queryTracer logs every statement at debug level, and at warn level when it
+// exceeds the slow query threshold. It is installed on the pgx pool so queries
+// made through database/sql and through Pool are both covered. Argument values
+// are never logged, only their count.
+type queryTracer struct {
+	logger             *zap.Logger
+	slowQueryThreshold time.Duration
+	contextLogger      func(context.Context) *zap.Logger
+	// connLoss is told about failed queries; nil disables it
+	connLoss *connLossMonitor
+}
+
+// queryTraceKey stores the in-progress query in the context passed from
+// TraceQueryStart to TraceQueryEnd
+type queryTraceKey struct{}
+
+// queryTrace describes a query in progress
+type queryTrace struct {
+	sql   string
+	args  int
+	start time.Time
+}
+
+// TraceQueryStart records the query and its start time
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryTraceKey{}, queryTrace{
+		sql:   data.SQL,
+		args:  len(data.Args),
+		start: time.Now(),
+	})
+}
+
+// TraceQueryEnd logs the query with its duration and affected rows
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(queryTraceKey{}).(queryTrace)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(trace.start)
+
+	log := t.logger
+	if t.contextLogger != nil {
+		log = t.contextLogger(ctx)
+	}
+
+	fields := []zap.Field{
+		zap.String("query", compactQuery(trace.sql)),
+		zap.Int("args", trace.args),
+		zap.Duration("duration", elapsed),
+		zap.Float64("duration_ms", float64(elapsed)/float64(time.Millisecond)),
+		zap.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+	if data.Err != nil {
+		fields = append(fields, zap.Error(data.Err))
+		if t.connLoss != nil {
+			t.connLoss.observe(data.Err)
+		}
+	}
+
+	if t.slowQueryThreshold > 0 && elapsed >= t.slowQueryThreshold {
+		log.Warn("slow query", append(fields, zap.Duration("threshold", t.slowQueryThreshold))...)
+		return
+	}
+	log.Debug("query", fields...)
+}
+
+// compactQuery collapses whitespace so multi-line queries log on one line
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
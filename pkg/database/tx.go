@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Querier is satisfied by *DB, *sql.DB and *sql.Tx, letting code run the same
+// statements inside or outside a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// activeTx is the transaction carried by a context
+type activeTx struct {
+	tx *sql.Tx
+	// depth counts the savepoints enclosing the context, 0 at the top level
+	depth int
+}
+
+// TxFromContext returns the transaction started by WithTransaction that ctx
+// carries, if any
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	active, ok := ctx.Value(txKey{}).(activeTx)
+	return active.tx, ok
+}
+
+// ContextWithTx returns ctx carrying tx, so queries made with it through
+// Querier join tx and WithTransaction nests in it with savepoints
+func ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	if active, ok := ctx.Value(txKey{}).(activeTx); ok && active.tx == tx {
+		return ctx
+	}
+	return context.WithValue(ctx, txKey{}, activeTx{tx: tx})
+}
+
+// Querier returns the transaction ctx carries, or db when there is none, so
+// repository calls made inside WithTransaction join the transaction
+func (db *DB) Querier(ctx context.Context) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// withSavepoint runs fn inside a savepoint of the transaction ctx carries.
+// A failure of fn rolls back to the savepoint, leaving the outer transaction
+// usable.
+func (db *DB) withSavepoint(ctx context.Context, active activeTx, fn func(context.Context, *sql.Tx) error) error {
+	active.depth++
+	name := fmt.Sprintf("sp_%d", active.depth)
+	tx := active.tx
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	rollback := func() error {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, active), tx); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			db.logger.Error("failed to rollback to savepoint",
+				zap.String("savepoint", name),
+				zap.Error(rbErr),
+				zap.NamedError("original_error", err),
+			)
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+
+	return nil
+}